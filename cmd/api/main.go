@@ -2,7 +2,9 @@ package main
 
 import (
 	"expo-open-ota/config"
+	"expo-open-ota/internal/cache"
 	"expo-open-ota/internal/metrics"
+	"expo-open-ota/internal/retention"
 	infrastructure "expo-open-ota/internal/router"
 	"log"
 	"os"
@@ -20,6 +22,10 @@ func init() {
 }
 
 func main() {
+	if err := cache.ValidateCacheConfig(); err != nil {
+		log.Fatalf("Invalid cache configuration: %v", err)
+	}
+
 	// Create a new Gin engine
 	router := gin.Default()
 
@@ -41,6 +47,11 @@ func main() {
 	// Setup routes using the router package
 	infrastructure.SetupRoutes(router)
 
+	// Drop the cache keys other replicas invalidate
+	cache.StartInvalidationListener()
+
+	retention.StartBackgroundJob()
+
 	log.Println("Server is running on port 8080")
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
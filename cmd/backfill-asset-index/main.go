@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/update"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// backfill-asset-index writes the asset index and precompressed variants of
+// every uploaded update that predates them, and prints the updates it indexed.
+// It only reports them unless -dry-run=false is passed.
+func main() {
+	dryRun := flag.Bool("dry-run", true, "Only report the updates that would be indexed")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found, continuing with runtime environment variables.")
+	}
+
+	report, err := update.BackfillAssetIndexes(*dryRun)
+	if err != nil {
+		log.Fatalf("Error backfilling asset indexes: %v", err)
+	}
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding report: %v", err)
+	}
+	fmt.Println(string(output))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/keyStore"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// generate-certs creates a root certificate, to embed in the app, and a code
+// signing certificate issued by it. The signing key and certificate chain are
+// stored through the configured keys storage so the server serves them.
+func main() {
+	commonName := flag.String("common-name", "", "Common name of the certificates")
+	years := flag.Int("years", 10, "Validity of the certificates in years")
+	keyType := flag.String("key-type", "rsa", "Key type: rsa, ecdsa or ed25519")
+	keyId := flag.String("key-id", keyStore.DefaultKeyId, "keyid the signing key is stored and served under")
+	projectId := flag.String("project-id", config.GetEnv("EXPO_APP_ID"), "Expo project id written in the signing certificate")
+	scopeKey := flag.String("scope-key", "", "Expo scope key (@owner/slug) written in the signing certificate")
+	outputDir := flag.String("output", "./certs", "Directory receiving the root certificate and its private key")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found, continuing with runtime environment variables.")
+	}
+	if *commonName == "" {
+		log.Fatalf("-common-name is required")
+	}
+	if *years <= 0 {
+		log.Fatalf("-years must be positive")
+	}
+
+	certificates, err := crypto.GenerateCodeSigningCertificates(crypto.CertificateOptions{
+		CommonName: *commonName,
+		Validity:   time.Duration(*years) * 365 * 24 * time.Hour,
+		KeyType:    *keyType,
+		ProjectId:  *projectId,
+		ScopeKey:   *scopeKey,
+	})
+	if err != nil {
+		log.Fatalf("Error generating certificates: %v", err)
+	}
+
+	if err := os.MkdirAll(*outputDir, 0700); err != nil {
+		log.Fatalf("Error creating %s: %v", *outputDir, err)
+	}
+	rootCertificatePath := filepath.Join(*outputDir, "certificate.pem")
+	if err := os.WriteFile(rootCertificatePath, []byte(certificates.RootCertificatePEM), 0644); err != nil {
+		log.Fatalf("Error writing root certificate: %v", err)
+	}
+	rootPrivateKeyPath := filepath.Join(*outputDir, "root-private-key.pem")
+	if err := os.WriteFile(rootPrivateKeyPath, []byte(certificates.RootPrivateKeyPEM), 0600); err != nil {
+		log.Fatalf("Error writing root private key: %v", err)
+	}
+	log.Printf("Root certificate written to %s, embed it in your app.", rootCertificatePath)
+	log.Printf("Root private key written to %s, keep it offline to issue future signing certificates.", rootPrivateKeyPath)
+
+	err = keyStore.StoreExpoKeys(*keyId, keyStore.ExpoKeys{
+		PublicKey:        certificates.SigningPublicKeyPEM,
+		PrivateKey:       certificates.SigningPrivateKeyPEM,
+		CertificateChain: certificates.CertificateChainPEM,
+	})
+	if errors.Is(err, keyStore.ErrReadOnlyKeysStorage) {
+		log.Printf("The keys storage is read-only, set the following environment variables:")
+		fmt.Printf("%s=%s\n", keyStore.KeyIdEnvName("PUBLIC_EXPO_KEY_B64", *keyId), base64.StdEncoding.EncodeToString([]byte(certificates.SigningPublicKeyPEM)))
+		fmt.Printf("%s=%s\n", keyStore.KeyIdEnvName("PRIVATE_EXPO_KEY_B64", *keyId), base64.StdEncoding.EncodeToString([]byte(certificates.SigningPrivateKeyPEM)))
+		fmt.Printf("%s=%s\n", keyStore.KeyIdEnvName("EXPO_CERTIFICATE_CHAIN_B64", *keyId), base64.StdEncoding.EncodeToString([]byte(certificates.CertificateChainPEM)))
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error storing signing key %s: %v", *keyId, err)
+	}
+	log.Printf("Signing key and certificate chain stored under keyid %s.", *keyId)
+}
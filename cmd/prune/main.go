@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/retention"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// prune applies the retention policies configured through RETENTION_KEEP_LAST,
+// RETENTION_MAX_AGE_DAYS and RETENTION_POLICIES, and prints what it deleted.
+// It only reports what would be deleted unless -dry-run=false is passed, and
+// deletes while holding the lease of the servers' retention job.
+func main() {
+	dryRun := flag.Bool("dry-run", true, "Only report the updates and assets that would be deleted")
+	leaseTTL := flag.Duration("lease", time.Hour, "How long the retention lease is held, longer than the run")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found, continuing with runtime environment variables.")
+	}
+	policies, err := retention.LoadPolicies()
+	if err != nil {
+		log.Fatalf("Error loading retention policies: %v", err)
+	}
+	if !policies.IsEnabled() {
+		log.Printf("No retention policy configured, only orphaned assets are pruned")
+	}
+
+	report, err := retention.PruneExclusively(policies, *dryRun, *leaseTTL)
+	if errors.Is(err, retention.ErrLeaseHeld) {
+		log.Fatalf("Not pruning: %v, retry once it is done", err)
+	}
+	if err != nil {
+		log.Fatalf("Error pruning bucket: %v", err)
+	}
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding report: %v", err)
+	}
+	fmt.Println(string(output))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
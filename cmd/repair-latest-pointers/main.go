@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// repair-latest-pointers rebuilds the latest.json pointer of every branch,
+// runtime version and platform from a full scan of the bucket, and prints the
+// runtime versions it repaired.
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file found, continuing with runtime environment variables.")
+	}
+
+	report, err := update.RepairLatestPointers()
+	if err != nil {
+		log.Fatalf("Error repairing latest pointers: %v", err)
+	}
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatalf("Error encoding report: %v", err)
+	}
+	fmt.Println(string(output))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -10,7 +10,8 @@ import (
 )
 
 func validateStorageMode(storageMode string) bool {
-	return storageMode == "local" || storageMode == "s3" || storageMode == "firebase"
+	return storageMode == "local" || storageMode == "s3" || storageMode == "firebase" ||
+		storageMode == "gcs" || storageMode == "azure"
 }
 
 func validateBucketParams(storageMode string) bool {
@@ -22,10 +23,15 @@ func validateBucketParams(storageMode string) bool {
 			return false
 		}
 		region := GetEnv("AWS_REGION")
-		if region == "" {
+		if region == "" && GetEnv("S3_REGION") == "" {
 			log.Printf("AWS_REGION not set")
 			return false
 		}
+		endpoint := GetEnv("S3_ENDPOINT")
+		if endpoint != "" && !helpers.IsValidURL(endpoint) {
+			log.Printf("Invalid S3_ENDPOINT: %s", endpoint)
+			return false
+		}
 	case "firebase":
 		// Check for Firebase project ID or service account credentials
 		projectID := GetEnv("FIREBASE_PROJECT_ID")
@@ -43,6 +49,18 @@ func validateBucketParams(storageMode string) bool {
 			log.Printf("Warning: FIREBASE_STORAGE_BUCKET not set and cannot be derived (no project ID)")
 		}
 		return true
+	case "gcs":
+		if GetEnv("GCS_BUCKET_NAME") == "" {
+			log.Printf("GCS_BUCKET_NAME not set")
+			return false
+		}
+	case "azure":
+		for _, key := range []string{"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY", "AZURE_STORAGE_CONTAINER"} {
+			if GetEnv(key) == "" {
+				log.Printf("%s not set", key)
+				return false
+			}
+		}
 	case "local":
 		// Already handled by default values
 		return true
@@ -65,7 +83,7 @@ func LoadConfig() {
 	if err != nil {
 		log.Printf("No .env file found, continuing with runtime environment variables.")
 	}
-	storageMode := GetEnv("STORAGE_MODE")
+	storageMode := ResolveStorageMode()
 	if !validateStorageMode(storageMode) {
 		log.Fatalf("Invalid STORAGE_MODE: %s", storageMode)
 	}
@@ -92,18 +110,28 @@ func LoadConfig() {
 }
 
 var DefaultEnvValues = map[string]string{
-	"LOCAL_BUCKET_BASE_PATH":      "./updates",
-	"STORAGE_MODE":                "local",
-	"BUCKET_TYPE":                 "local",
-	"BASE_URL":                    "http://localhost:3000",
-	"PUBLIC_LOCAL_EXPO_KEY_PATH":  "./keyStore/public-key.pem",
-	"PRIVATE_LOCAL_EXPO_KEY_PATH": "./keyStore/private-key.pem",
-	"KEYS_STORAGE_TYPE":           "local",
-	"JWT_SECRET":                  "",
-	"AWS_REGION":                  "eu-west-3",
-	"FIREBASE_PROJECT_ID":         "",
-	"FIREBASE_STORAGE_BUCKET":     "",
-	"FIREBASE_SERVICE_ACCOUNT":    "",
+	"LOCAL_BUCKET_BASE_PATH":            "./updates",
+	"STORAGE_MODE":                      "local",
+	"BUCKET_TYPE":                       "local",
+	"BASE_URL":                          "http://localhost:3000",
+	"PUBLIC_LOCAL_EXPO_KEY_PATH":        "./keyStore/public-key.pem",
+	"PRIVATE_LOCAL_EXPO_KEY_PATH":       "./keyStore/private-key.pem",
+	"LOCAL_EXPO_CERTIFICATE_CHAIN_PATH": "./keyStore/certificate-chain.pem",
+	"KEYS_STORAGE_TYPE":                 "local",
+	"JWT_SECRET":                        "",
+	"AWS_REGION":                        "eu-west-3",
+	"FIREBASE_PROJECT_ID":               "",
+	"FIREBASE_STORAGE_BUCKET":           "",
+	"FIREBASE_SERVICE_ACCOUNT":          "",
+}
+
+// ResolveStorageMode returns the configured storage backend: BUCKET_TYPE when
+// it is set, STORAGE_MODE otherwise, local by default.
+func ResolveStorageMode() string {
+	if bucketType := os.Getenv("BUCKET_TYPE"); bucketType != "" {
+		return bucketType
+	}
+	return GetEnv("STORAGE_MODE")
 }
 
 func GetEnv(key string) string {
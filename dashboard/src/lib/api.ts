@@ -1,5 +1,24 @@
 import { getRefreshToken, getToken, logout, setTokens } from '@/lib/auth.ts';
 
+export type Rollout = {
+  percentage: number;
+  status: 'inProgress' | 'completed' | 'aborted';
+  updatedAt: string;
+};
+
+export type BranchWeight = {
+  branch: string;
+  weight: number;
+};
+
+export type Channel = {
+  name: string;
+  branch: string;
+  branches?: BranchWeight[];
+  createdAt: string;
+  updatedAt: string;
+};
+
 export class ApiClient {
   private baseUrl: string;
 
@@ -101,11 +120,87 @@ export class ApiClient {
         updateId: string;
         platform: string;
         commitHash: string;
+        rollout?: Rollout;
       }[]
     >(`/api/updates/${branch}/${runtimeVersion}`, {
       method: 'GET',
     });
   }
+  public async setRolloutPercentage(
+    branch: string,
+    runtimeVersion: string,
+    updateId: string,
+    percentage: number
+  ) {
+    return this.request<Rollout>(`/api/dashboard/rollout/${branch}/${runtimeVersion}/${updateId}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ percentage }),
+    });
+  }
+  public async promoteRollout(branch: string, runtimeVersion: string, updateId: string) {
+    return this.request<Rollout>(
+      `/api/dashboard/rollout/${branch}/${runtimeVersion}/${updateId}/promote`,
+      {
+        method: 'POST',
+      }
+    );
+  }
+  public async abortRollout(branch: string, runtimeVersion: string, updateId: string) {
+    return this.request<Rollout>(
+      `/api/dashboard/rollout/${branch}/${runtimeVersion}/${updateId}/abort`,
+      {
+        method: 'POST',
+      }
+    );
+  }
+  public async createRollback(branch: string, runtimeVersion: string) {
+    return this.request<{ updateId: string; commitTime: string }>(
+      `/api/dashboard/rollback/${branch}/${runtimeVersion}`,
+      {
+        method: 'POST',
+      }
+    );
+  }
+  public async republishUpdate(
+    branch: string,
+    runtimeVersion: string,
+    updateId: string,
+    targetBranch: string
+  ) {
+    return this.request<{ branch: string; runtimeVersion: string; updateId: string }>(
+      `/api/dashboard/republish/${branch}/${runtimeVersion}/${updateId}`,
+      {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ targetBranch }),
+      }
+    );
+  }
+  public async getChannels() {
+    return this.request<Channel[]>('/api/channels', {
+      method: 'GET',
+    });
+  }
+  public async createChannel(name: string, branch: string, branches?: BranchWeight[]) {
+    return this.request<Channel>('/api/channels', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ name, branch, branches }),
+    });
+  }
+  public async updateChannel(name: string, branch: string, branches?: BranchWeight[]) {
+    return this.request<Channel>(`/api/channels/${name}`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ branch, branches }),
+    });
+  }
+  public async deleteChannel(name: string) {
+    return this.request<{ status: string }>(`/api/channels/${name}`, {
+      method: 'DELETE',
+    });
+  }
   public async getSettings() {
     return this.request<{
       BASE_URL: string;
@@ -116,6 +211,9 @@ export class ApiClient {
       REDIS_PORT: string;
       STORAGE_MODE: string;
       S3_BUCKET_NAME: string;
+      S3_ENDPOINT: string;
+      S3_REGION: string;
+      S3_FORCE_PATH_STYLE: boolean;
       LOCAL_BUCKET_BASE_PATH: string;
       KEYS_STORAGE_TYPE: string;
       AWSSM_EXPO_PUBLIC_KEY_SECRET_ID: string;
@@ -1,7 +1,7 @@
-import { useQuery } from '@tanstack/react-query';
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
 import { api } from '@/lib/api.ts';
 import { ApiError } from '@/components/APIError';
-import { GitBranch, Milestone, Rss, Calendar, Hash, Smartphone, ChevronDown, Tag } from 'lucide-react';
+import { GitBranch, Milestone, Rss, Calendar, Hash, Smartphone, ChevronDown, Tag, Undo2 } from 'lucide-react';
 import {
   Breadcrumb,
   BreadcrumbItem,
@@ -50,6 +50,22 @@ export const UpdatesTable = ({
     }
   }, [data]);
 
+  const queryClient = useQueryClient();
+  const rollbackMutation = useMutation({
+    mutationFn: () => api.createRollback(branch, runtimeVersion),
+    onSuccess: () => queryClient.invalidateQueries({ queryKey: ['updates'] }),
+  });
+
+  const handleRollback = () => {
+    if (
+      window.confirm(
+        `Roll back every client on ${branch} (runtime ${runtimeVersion}) to their embedded update?`
+      )
+    ) {
+      rollbackMutation.mutate();
+    }
+  };
+
   const handleLoadMore = () => {
     setVisibleCount(prev => prev + 4);
   };
@@ -193,7 +209,18 @@ export const UpdatesTable = ({
         </BreadcrumbList>
       </Breadcrumb>
       
+      <div className="flex justify-end mb-4">
+        <Button
+          variant="destructive"
+          onClick={handleRollback}
+          disabled={rollbackMutation.isPending}
+          className="flex items-center gap-2">
+          <Undo2 className="w-4 h-4" /> Roll back to embedded
+        </Button>
+      </div>
+
       {!!error && <ApiError error={error} />}
+      {!!rollbackMutation.error && <ApiError error={rollbackMutation.error} />}
       
       {isLoading ? (
         <div className="flex justify-center items-center min-h-[200px]">
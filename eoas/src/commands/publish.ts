@@ -1,13 +1,14 @@
 import { Platform, Env } from '@expo/eas-build-job';
 import { Command, Flags } from '@oclif/core';
 import fs from 'fs-extra';
+import http from 'http';
 import https from 'https';
 import mime from 'mime';
 import url from 'url';
 import path from 'path';
 import spawnAsync from '@expo/spawn-async';
 
-import { computeFilesRequests, requestUploadUrls } from '../lib/assets';
+import { computeFilesIntegrity, computeFilesRequests, requestUploadUrls } from '../lib/assets';
 import {
   RequestedPlatform,
   getExpoConfigUpdateUrl,
@@ -460,7 +461,7 @@ export default class Publish extends Command {
     
     try {
       const result = await requestUploadUrls({
-        body: { fileNames: files.map(f => f.name) },
+        body: { fileNames: files.map(f => f.name), files: await computeFilesIntegrity(files) },
         requestUploadUrl: `${baseUrl}/api/update/request-upload-urls/${branch}`,
         runtimeVersion: runtimeVersions[0].runtimeVersion || '',
         platform: runtimeVersions[0].platform,
@@ -468,9 +469,13 @@ export default class Publish extends Command {
         buildNumber: _buildNumber || updatedAppBuildNumber,
       });
 
-      const { uploadRequests } = result;
+      const { uploadRequests, deduplicatedFiles = [] } = result;
 
       for (const file of files) {
+        if (deduplicatedFiles.includes(file.name)) {
+          Log.debug(`Skipping ${file.name}, already stored on the server`);
+          continue;
+        }
         const uploadUrl = uploadRequests.find(url => url.fileName === file.name);
         if (!uploadUrl) {
           throw new Error(`No upload URL found for file ${file.name}`);
@@ -490,15 +495,19 @@ export default class Publish extends Command {
             
             const options = {
               hostname: parsedUrl.hostname,
+              port: parsedUrl.port || undefined,
               path: parsedUrl.pathname + parsedUrl.search,
               method: 'PUT',
               headers: {
                 'Content-Type': contentType,
-                'Content-Length': fileContent.length
+                'Content-Length': fileContent.length,
+                ...(uploadUrl.headers ?? {}),
               }
             };
+            // Self-hosted storages (MinIO, Azurite...) may be served over plain HTTP
+            const transport = parsedUrl.protocol === 'http:' ? http : https;
             
-            const req = https.request(options, (res) => {
+            const req = transport.request(options, (res) => {
               let responseBody = '';
               
               res.on('data', (chunk) => {
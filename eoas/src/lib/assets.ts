@@ -1,5 +1,6 @@
 // This file is partially copied from eas-cli[https://github.com/expo/eas-cli] to ensure consistent user experience across the CLI.
 import { Platform } from '@expo/config';
+import crypto from 'crypto';
 import fs from 'fs-extra';
 import Joi from 'joi';
 import fetch from 'node-fetch';
@@ -154,6 +155,27 @@ export interface RequestUploadUrlItem {
   requestUploadUrl: string;
   fileName: string;
   filePath: string;
+  headers?: Record<string, string>;
+}
+
+export interface UploadFileIntegrity {
+  name: string;
+  sha256: string;
+  size: number;
+}
+
+// Hashes announced to the server, which checks the uploaded objects against them
+export async function computeFilesIntegrity(files: AssetToUpload[]): Promise<UploadFileIntegrity[]> {
+  return Promise.all(
+    files.map(async file => {
+      const content = await fs.readFile(file.path);
+      return {
+        name: file.name,
+        sha256: crypto.createHash('sha256').update(content).digest('hex'),
+        size: content.length,
+      };
+    })
+  );
 }
 
 export async function requestUploadUrls({
@@ -165,14 +187,18 @@ export async function requestUploadUrls({
   commitHash,
   buildNumber,
 }: {
-  body: { fileNames: string[] };
+  body: { fileNames: string[]; files?: UploadFileIntegrity[] };
   requestUploadUrl: string;
   auth?: ExpoCredentials;
   runtimeVersion: string;
   platform: string;
   commitHash?: string;
   buildNumber?: string;
-}): Promise<{ uploadRequests: RequestUploadUrlItem[]; updateId: string }> {
+}): Promise<{
+  uploadRequests: RequestUploadUrlItem[];
+  updateId: string;
+  deduplicatedFiles?: string[];
+}> {
   const headers: Record<string, string> = {
     'Content-Type': 'application/json',
   };
@@ -203,7 +229,7 @@ export async function requestUploadUrls({
     {
       method: 'POST',
       headers,
-      body: JSON.stringify({ fileNames: body.fileNames }),
+      body: JSON.stringify({ fileNames: body.fileNames, files: body.files }),
     }
   );
   if (!response.ok) {
@@ -1,18 +1,17 @@
 package assets
 
 import (
+	"errors"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/cdn"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
-	"io"
 	"log"
 	"mime"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type AssetsRequest struct {
@@ -21,6 +20,11 @@ type AssetsRequest struct {
 	RuntimeVersion string
 	Platform       string
 	RequestID      string
+	// UpdateId names the update the asset belongs to, the newest update of
+	// the runtime version is used when empty
+	UpdateId string
+	// Encodings are the content encodings the client accepts, preferred first
+	Encodings []string
 }
 
 type AssetsResponse struct {
@@ -29,9 +33,12 @@ type AssetsResponse struct {
 	Body        []byte
 	ContentType string
 	URL         string
+	// File is the resolved asset of a successful HandleAssetsWithFile, to be
+	// streamed with ServeAssetFile.
+	File *types.BucketFile
 }
 
-func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *types.BucketFile, string, error) {
+func getAssetMetadata(req AssetsRequest) (AssetsResponse, *types.BucketFile, string, error) {
 	requestID := req.RequestID
 
 	if req.AssetName == "" {
@@ -49,81 +56,38 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("No runtime version provided")}, nil, "", nil
 	}
 
-	// Get all updates for this runtime version
-	allUpdates, err := update.GetAllUpdatesForRuntimeVersion(req.Branch, req.RuntimeVersion)
-	if err != nil || len(allUpdates) == 0 {
-		log.Printf("[RequestID: %s] No updates found for runtimeVersion: %s, error: %v", requestID, req.RuntimeVersion, err)
-		return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("No updates found")}, nil, "", nil
-	}
-
-	// Sort updates by build number (descending order - newest first)
-	sort.Slice(allUpdates, func(i, j int) bool {
-		// Extract build numbers if possible
-		buildNumI := 0
-		buildNumJ := 0
-
-		// Try to parse build numbers from BuildNumber field
-		if allUpdates[i].BuildNumber != "" {
-			if num, err := strconv.Atoi(allUpdates[i].BuildNumber); err == nil {
-				buildNumI = num
-			}
+	var allUpdates []types.Update
+	cacheControl := "private, max-age=0"
+	if req.UpdateId != "" {
+		// The asset of the exact update is requested, it never changes
+		if !isValidUpdateId(req.UpdateId) {
+			log.Printf("[RequestID: %s] Invalid update id: %s", requestID, req.UpdateId)
+			return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("Invalid update id")}, nil, "", nil
 		}
-
-		if allUpdates[j].BuildNumber != "" {
-			if num, err := strconv.Atoi(allUpdates[j].BuildNumber); err == nil {
-				buildNumJ = num
+		requestedUpdate, err := bucket.GetBucket().GetUpdate(req.Branch, req.RuntimeVersion, req.UpdateId)
+		if err != nil {
+			log.Printf("[RequestID: %s] Update %s not found: %v", requestID, req.UpdateId, err)
+			if errors.Is(err, bucket.ErrUpdateNotFound) {
+				return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("Update not found")}, nil, "", nil
 			}
+			return AssetsResponse{StatusCode: http.StatusInternalServerError, Body: []byte("Error getting update")}, nil, "", nil
 		}
-
-		// If both have build numbers, compare them
-		if buildNumI > 0 && buildNumJ > 0 {
-			return buildNumI > buildNumJ // Descending order
-		}
-
-		// If build numbers can't be compared, try to extract from UpdateId for "build-X-..." format
-		if strings.HasPrefix(allUpdates[i].UpdateId, "build-") && strings.HasPrefix(allUpdates[j].UpdateId, "build-") {
-			partsI := strings.SplitN(allUpdates[i].UpdateId, "-", 3)
-			partsJ := strings.SplitN(allUpdates[j].UpdateId, "-", 3)
-
-			if len(partsI) >= 2 && len(partsJ) >= 2 {
-				if numI, err := strconv.Atoi(partsI[1]); err == nil {
-					if numJ, err := strconv.Atoi(partsJ[1]); err == nil {
-						return numI > numJ // Descending order
-					}
-				}
-			}
+		allUpdates = []types.Update{*requestedUpdate}
+		cacheControl = "public, max-age=31536000, immutable"
+	} else {
+		var errUpdates error
+		allUpdates, errUpdates = findLatestUpdates(req)
+		if errUpdates != nil || len(allUpdates) == 0 {
+			log.Printf("[RequestID: %s] No updates found for runtimeVersion: %s, error: %v", requestID, req.RuntimeVersion, errUpdates)
+			return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("No updates found")}, nil, "", nil
 		}
-
-		// Default to comparing UpdateId as strings (less reliable)
-		return allUpdates[i].UpdateId > allUpdates[j].UpdateId
-	})
-
-	// For debugging purposes, log all available updates in sorted order
-	log.Printf("[RequestID: %s] Found %d updates for runtimeVersion: %s (sorted newest first)",
-		requestID, len(allUpdates), req.RuntimeVersion)
-	for i, update := range allUpdates {
-		log.Printf("[RequestID: %s] Sorted update %d: ID=%s, BuildNumber=%s",
-			requestID, i+1, update.UpdateId, update.BuildNumber)
 	}
 
-	// Use the newest update
+	// Use the requested update, or the newest one
 	latestUpdate := allUpdates[0]
-	log.Printf("[RequestID: %s] Using latest update: ID=%s, BuildNumber=%s",
+	log.Printf("[RequestID: %s] Using update: ID=%s, BuildNumber=%s",
 		requestID, latestUpdate.UpdateId, latestUpdate.BuildNumber)
 
-	// For non-asset return cases (just metadata)
-	if !returnAsset {
-		headers := map[string]string{
-			"expo-protocol-version": "1",
-			"expo-sfv-version":      "0",
-			"Cache-Control":         "public, max-age=31536000",
-		}
-		return AssetsResponse{
-			StatusCode: http.StatusOK,
-			Headers:    headers,
-		}, nil, latestUpdate.UpdateId, nil
-	}
-
 	// Get the metadata for this update
 	metadata, err := update.GetMetadata(latestUpdate)
 	if err != nil {
@@ -149,8 +113,6 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("Platform not supported")}, nil, "", nil
 	}
 
-	// Identify if this is a launch asset (main JS bundle)
-	isLaunchAsset := false
 	var assetPath string
 	var contentType string
 
@@ -161,7 +123,6 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	// Check if this is the launch asset (main JS bundle)
 	if req.AssetName == platformMetadata.Bundle {
 		log.Printf("[RequestID: %s] Request is for the launch asset (main bundle)", requestID)
-		isLaunchAsset = true
 		assetPath = platformMetadata.Bundle
 		contentType = "application/javascript"
 	} else {
@@ -188,89 +149,17 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		}
 	}
 
-	// Get the bucket
-	resolvedBucket := bucket.GetBucket()
-
 	// Try to retrieve the asset file
 	log.Printf("[RequestID: %s] ASSET-DEBUG: Looking for asset %s in update %s/%s/%s",
 		requestID, assetPath, latestUpdate.Branch, latestUpdate.RuntimeVersion, latestUpdate.UpdateId)
 
-	// Create a function to try different asset path variations
-	tryAssetPaths := func() (io.ReadCloser, error) {
-		// Paths to try in order - add more variations to increase chances of finding assets
-		pathsToTry := []string{
-			assetPath, // Original path from metadata
-		}
-
-		// For launch assets (main bundle), add additional path variations
-		if isLaunchAsset {
-			// Common variations for bundle paths
-			pathsToTry = append(pathsToTry,
-				strings.TrimPrefix(assetPath, "_expo/"),
-				"bundles/"+assetPath,
-				"bundle.js",
-				"index.bundle",
-				"app.bundle",
-				"app.js",
-				"index.js")
-
-			// Extract filename only
-			parts := strings.Split(assetPath, "/")
-			if len(parts) > 0 {
-				pathsToTry = append(pathsToTry, parts[len(parts)-1])
-			}
-		} else {
-			// For regular assets, try more path variations
-			if strings.HasPrefix(assetPath, "assets/") {
-				pathsToTry = append(pathsToTry, strings.TrimPrefix(assetPath, "assets/"))
-			}
-
-			// Try with assets prefix if not already there
-			if !strings.HasPrefix(assetPath, "assets/") {
-				pathsToTry = append(pathsToTry, "assets/"+assetPath)
-			}
-
-			// Try just the asset hash (last part)
-			parts := strings.Split(assetPath, "/")
-			if len(parts) > 0 {
-				pathsToTry = append(pathsToTry, parts[len(parts)-1])
-			}
-		}
-
-		// Log all paths we're going to try
-		log.Printf("[RequestID: %s] ASSET-DEBUG: Will try %d path variations for asset",
-			requestID, len(pathsToTry))
-
-		// Try each path
-		var lastErr error
-		for _, pathToTry := range pathsToTry {
-			log.Printf("[RequestID: %s] ASSET-DEBUG: Trying path: %s", requestID, pathToTry)
-			file, err := resolvedBucket.GetFile(
-				latestUpdate.Branch,
-				latestUpdate.RuntimeVersion,
-				latestUpdate.UpdateId,
-				pathToTry)
-
-			if err == nil {
-				log.Printf("[RequestID: %s] ASSET-DEBUG: Successfully found asset using path: %s", requestID, pathToTry)
-				return file, nil
-			}
-
-			lastErr = err
-			log.Printf("[RequestID: %s] ASSET-DEBUG: Failed to find asset using path %s: %v", requestID, pathToTry, err)
-		}
-
-		return nil, lastErr
-	}
-
-	// Try to get the asset
-	asset, err := tryAssetPaths()
+	// The asset index maps the path to the exact object holding it
+	bucketFile, err := update.ResolveIndexedAssetFile(latestUpdate, assetPath, req.Encodings)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting asset: %v", requestID, err)
 
 		// Try older updates as fallback
 		log.Printf("[RequestID: %s] ASSET-DEBUG: Trying older updates as fallback", requestID)
-		var fallbackAsset io.ReadCloser
 		var foundInFallback bool
 
 		for i := 1; i < len(allUpdates); i++ {
@@ -278,19 +167,14 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 			log.Printf("[RequestID: %s] ASSET-DEBUG: Trying fallback update %s for asset %s",
 				requestID, fallbackUpdate.UpdateId, assetPath)
 
-			// Try all path variations in this update
-			fallbackAsset, err = resolvedBucket.GetFile(
-				fallbackUpdate.Branch,
-				fallbackUpdate.RuntimeVersion,
-				fallbackUpdate.UpdateId,
-				assetPath)
+			fallbackFile, err := update.ResolveIndexedAssetFile(fallbackUpdate, assetPath, req.Encodings)
 
 			if err == nil {
 				log.Printf("[RequestID: %s] ASSET-DEBUG: Found asset in fallback update %s!",
 					requestID, fallbackUpdate.UpdateId)
 				foundInFallback = true
 				latestUpdate = fallbackUpdate
-				asset = fallbackAsset
+				bucketFile = fallbackFile
 				break
 			}
 		}
@@ -304,15 +188,10 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	headers := map[string]string{
 		"expo-protocol-version": "1",
 		"expo-sfv-version":      "0",
-		"Cache-Control":         "public, max-age=31536000",
+		"Cache-Control":         cacheControl,
 		"Content-Type":          contentType,
 	}
 
-	bucketFile := &types.BucketFile{
-		Reader:    asset,
-		CreatedAt: time.Now(), // Since we don't have the actual creation time
-	}
-
 	return AssetsResponse{
 		StatusCode:  http.StatusOK,
 		Headers:     headers,
@@ -320,11 +199,79 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	}, bucketFile, latestUpdate.UpdateId, nil
 }
 
+// findLatestUpdates returns the updates of a runtime version newest first, for
+// asset URLs that do not name their update.
+func findLatestUpdates(req AssetsRequest) ([]types.Update, error) {
+	// Get all updates for this runtime version
+	allUpdates, err := update.GetAllUpdatesForRuntimeVersion(req.Branch, req.RuntimeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort updates by build number (descending order - newest first)
+	sort.Slice(allUpdates, func(i, j int) bool {
+		// Extract build numbers if possible
+		buildNumI := 0
+		buildNumJ := 0
+
+		// Try to parse build numbers from BuildNumber field
+		if allUpdates[i].BuildNumber != "" {
+			if num, err := strconv.Atoi(allUpdates[i].BuildNumber); err == nil {
+				buildNumI = num
+			}
+		}
+
+		if allUpdates[j].BuildNumber != "" {
+			if num, err := strconv.Atoi(allUpdates[j].BuildNumber); err == nil {
+				buildNumJ = num
+			}
+		}
+
+		// If both have build numbers, compare them
+		if buildNumI > 0 && buildNumJ > 0 {
+			return buildNumI > buildNumJ // Descending order
+		}
+
+		// If build numbers can't be compared, try to extract from UpdateId for "build-X-..." format
+		if strings.HasPrefix(allUpdates[i].UpdateId, "build-") && strings.HasPrefix(allUpdates[j].UpdateId, "build-") {
+			partsI := strings.SplitN(allUpdates[i].UpdateId, "-", 3)
+			partsJ := strings.SplitN(allUpdates[j].UpdateId, "-", 3)
+
+			if len(partsI) >= 2 && len(partsJ) >= 2 {
+				if numI, err := strconv.Atoi(partsI[1]); err == nil {
+					if numJ, err := strconv.Atoi(partsJ[1]); err == nil {
+						return numI > numJ // Descending order
+					}
+				}
+			}
+		}
+
+		// Default to comparing UpdateId as strings (less reliable)
+		return allUpdates[i].UpdateId > allUpdates[j].UpdateId
+	})
+
+	// For debugging purposes, log all available updates in sorted order
+	log.Printf("[RequestID: %s] Found %d updates for runtimeVersion: %s (sorted newest first)",
+		req.RequestID, len(allUpdates), req.RuntimeVersion)
+	for i, update := range allUpdates {
+		log.Printf("[RequestID: %s] Sorted update %d: ID=%s, BuildNumber=%s",
+			req.RequestID, i+1, update.UpdateId, update.BuildNumber)
+	}
+	return allUpdates, nil
+}
+
+// isValidUpdateId rejects update ids that are not a single path segment.
+func isValidUpdateId(updateId string) bool {
+	return updateId != "." && updateId != ".." && !strings.ContainsAny(updateId, "/\\")
+}
+
+// HandleAssetsWithFile resolves an asset of the latest update, the File of a
+// 200 response is read when streamed.
 func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 	log.Printf("[RequestID: %s] ASSET-DEBUG: Starting asset lookup for %s (platform: %s, runtimeVersion: %s)",
 		req.RequestID, req.AssetName, req.Platform, req.RuntimeVersion)
 
-	resp, bucketFile, _, err := getAssetMetadata(req, true)
+	resp, bucketFile, _, err := getAssetMetadata(req)
 	if err != nil {
 		log.Printf("[RequestID: %s] ASSET-DEBUG: Error getting asset metadata: %v", req.RequestID, err)
 		return resp, err
@@ -345,24 +292,17 @@ func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 		}, nil
 	}
 
-	log.Printf("[RequestID: %s] ASSET-DEBUG: Successfully found file, reading contents", req.RequestID)
-	buffer, err := io.ReadAll(bucketFile.Reader)
-	defer bucketFile.Reader.Close()
-	if err != nil {
-		log.Printf("[RequestID: %s] ASSET-DEBUG: Error converting asset to buffer: %v", req.RequestID, err)
-		return AssetsResponse{
-			StatusCode: http.StatusInternalServerError,
-			Body:       []byte("Error converting asset to buffer"),
-		}, err
-	}
-
-	log.Printf("[RequestID: %s] ASSET-DEBUG: Successfully read %d bytes from asset", req.RequestID, len(buffer))
-	resp.Body = buffer
+	log.Printf("[RequestID: %s] ASSET-DEBUG: Successfully found file of %d bytes", req.RequestID, bucketFile.Size)
+	resp.File = bucketFile
 	return resp, nil
 }
 
+// HandleAssetsWithURL resolves an asset of the latest update like
+// HandleAssetsWithFile, and signs a CDN URL for the object holding it. The
+// identity object is signed, the CDN negotiates compression itself.
 func HandleAssetsWithURL(req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse, error) {
-	resp, _, updateId, err := getAssetMetadata(req, false)
+	req.Encodings = nil
+	resp, bucketFile, _, err := getAssetMetadata(req)
 	if err != nil {
 		return resp, err
 	}
@@ -372,7 +312,7 @@ func HandleAssetsWithURL(req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse
 			Body:       resp.Body,
 		}, nil
 	}
-	resp.URL, err = resolvedCDN.ComputeRedirectionURLForAsset(req.Branch, req.RuntimeVersion, updateId, req.AssetName)
+	resp.URL, err = resolvedCDN.ComputeRedirectionURLForObject(bucketFile.Key)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error computing redirection URL: %v", req.RequestID, err)
 		return AssetsResponse{
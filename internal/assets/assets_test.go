@@ -0,0 +1,76 @@
+package assets
+
+import (
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAssetsWithFileServesRequestedUpdate(t *testing.T) {
+	t.Setenv("BUCKET_TYPE", "local")
+	t.Setenv("STORAGE_MODE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	bucket.ResetBucketInstance()
+	t.Cleanup(bucket.ResetBucketInstance)
+	resolvedBucket := bucket.GetBucket()
+
+	publish := func(updateId string, bundle string) {
+		published := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: updateId}
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, "metadata.json",
+			strings.NewReader(`{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[]}}}`)))
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, "bundles/ios.js", strings.NewReader(bundle)))
+		_, err := update.IndexUpdateAssets(published)
+		require.NoError(t, err)
+	}
+	// The second update is published while clients download the first
+	publish("1700000000000", "first bundle")
+	publish("1700000000001", "second bundle")
+
+	request := AssetsRequest{Branch: "main", RuntimeVersion: "1.0.0", Platform: "ios", AssetName: "bundles/ios.js", RequestID: "test"}
+	read := func(req AssetsRequest) (AssetsResponse, string) {
+		response, err := HandleAssetsWithFile(req)
+		require.NoError(t, err)
+		if response.File == nil {
+			return response, ""
+		}
+		opened, err := response.File.Open(0, response.File.Size)
+		require.NoError(t, err)
+		defer opened.Close()
+		content, err := io.ReadAll(opened)
+		require.NoError(t, err)
+		return response, string(content)
+	}
+
+	exact := request
+	exact.UpdateId = "1700000000000"
+	response, content := read(exact)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "first bundle", content)
+	assert.Equal(t, "public, max-age=31536000, immutable", response.Headers["Cache-Control"])
+
+	// Without an update id the newest update answers, and must be revalidated
+	response, content = read(request)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "second bundle", content)
+	assert.Equal(t, "private, max-age=0", response.Headers["Cache-Control"])
+
+	exact.UpdateId = "1700000000002"
+	response, _ = read(exact)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	exact.UpdateId = ".."
+	response, _ = read(exact)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// The manifest points at the exact update
+	assetUrl, err := update.BuildUpdateAssetUrl(types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}, "bundles/ios.js", "ios")
+	require.NoError(t, err)
+	assert.Contains(t, assetUrl, "updateId=1700000000000")
+	assert.Contains(t, assetUrl, "branch=main")
+}
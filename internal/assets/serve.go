@@ -0,0 +1,176 @@
+package assets
+
+import (
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeAssetFile streams an asset, or its precompressed variant, to the
+// client. The asset hash is its ETag and the object time its Last-Modified, so
+// conditional requests are answered with 304 before the object is read. A
+// single byte range is served for resumable downloads, read with a ranged
+// request.
+func ServeAssetFile(w http.ResponseWriter, r *http.Request, file *types.BucketFile, contentType string, requestID string) {
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("ETag", assetETag(file.SHA256, file.Encoding))
+	header.Set("Vary", "Accept-Encoding")
+	if file.Encoding != "" {
+		header.Set("Content-Encoding", file.Encoding)
+	}
+	if !file.LastModified.IsZero() {
+		header.Set("Last-Modified", file.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if file.Size > 0 {
+		header.Set("Accept-Ranges", "bytes")
+	}
+
+	if isNotModified(r, file) {
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	start, length, status := int64(0), file.Size, http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && file.Size > 0 && ifRangeMatches(r, file) {
+		rangeStart, rangeLength, ok, satisfiable := parseByteRange(rangeHeader, file.Size)
+		if ok && !satisfiable {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			start, length, status = rangeStart, rangeLength, http.StatusPartialContent
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, file.Size))
+		}
+	}
+
+	if status == http.StatusPartialContent || file.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	reader, err := file.Open(start, length)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error reading asset bytes %d-%d: %v", requestID, start, start+length-1, err)
+		header.Del("Content-Range")
+		header.Del("Content-Length")
+		http.Error(w, "Error reading asset", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("[RequestID: %s] Error streaming asset: %v", requestID, err)
+	}
+}
+
+// assetETag is the strong validator of an asset in an encoding, every
+// encoding of the same content needs its own.
+func assetETag(sha256Hex string, encoding string) string {
+	if encoding == "" {
+		return `"` + sha256Hex + `"`
+	}
+	return `"` + sha256Hex + "-" + encoding + `"`
+}
+
+// etagMatches reports whether an If-None-Match or If-Range header names the
+// asset, in any encoding.
+func etagMatches(headerValue string, sha256Hex string) bool {
+	for _, tag := range strings.Split(headerValue, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+		hash, _, _ := strings.Cut(strings.Trim(tag, `"`), "-")
+		if sha256Hex != "" && hash == sha256Hex {
+			return true
+		}
+	}
+	return false
+}
+
+func isNotModified(r *http.Request, file *types.BucketFile) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, file.SHA256)
+	}
+	if file.LastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !file.LastModified.Truncate(time.Second).After(since)
+}
+
+// ifRangeMatches reports whether a range request still applies to the asset,
+// clients resuming a download of other content get the whole asset.
+func ifRangeMatches(r *http.Request, file *types.BucketFile) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == assetETag(file.SHA256, file.Encoding)
+	}
+	since, err := http.ParseTime(ifRange)
+	if err != nil || file.LastModified.IsZero() {
+		return false
+	}
+	return file.LastModified.Truncate(time.Second).Equal(since)
+}
+
+// parseByteRange returns the range a Range header asks for in an asset of
+// size bytes. ok is false when the header is ignored and the whole asset
+// served: malformed headers and multiple ranges.
+func parseByteRange(rangeHeader string, size int64) (start int64, length int64, ok bool, satisfiable bool) {
+	spec, found := strings.CutPrefix(rangeHeader, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+	if first == "" {
+		// Suffix range, the last bytes of the asset
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, false
+		}
+		if suffix == 0 {
+			return 0, 0, true, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end - start + 1, true, true
+}
@@ -0,0 +1,124 @@
+package assets
+
+import (
+	"expo-open-ota/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAssetHash = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+// openedRange records the section of an asset a request read.
+type openedRange struct {
+	offset int64
+	length int64
+}
+
+// openContent serves content like a bucket object, recording every read.
+func openContent(content string, opened *[]openedRange) func(offset int64, length int64) (io.ReadCloser, error) {
+	return func(offset int64, length int64) (io.ReadCloser, error) {
+		*opened = append(*opened, openedRange{offset, length})
+		return io.NopCloser(strings.NewReader(content[offset : offset+length])), nil
+	}
+}
+
+func serveTestAssetReads(t *testing.T, contentType string, headers map[string]string) (*httptest.ResponseRecorder, []openedRange) {
+	t.Helper()
+	opened := []openedRange{}
+	file := &types.BucketFile{
+		Open:         openContent("0123456789", &opened),
+		SHA256:       testAssetHash,
+		Size:         10,
+		LastModified: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	request := httptest.NewRequest(http.MethodGet, "/assets", nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	ServeAssetFile(recorder, request, file, contentType, "test")
+	return recorder, opened
+}
+
+func serveTestAsset(t *testing.T, contentType string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder, _ := serveTestAssetReads(t, contentType, headers)
+	return recorder
+}
+
+func TestServeAssetFile(t *testing.T) {
+	response := serveTestAsset(t, "image/png", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "0123456789", response.Body.String())
+	assert.Equal(t, "10", response.Header().Get("Content-Length"))
+	assert.Equal(t, `"`+testAssetHash+`"`, response.Header().Get("ETag"))
+	assert.Equal(t, "Wed, 01 May 2024 12:00:00 GMT", response.Header().Get("Last-Modified"))
+	assert.Equal(t, "bytes", response.Header().Get("Accept-Ranges"))
+
+	t.Run("Range", func(t *testing.T) {
+		for rangeHeader, expected := range map[string]string{"bytes=2-5": "2345", "bytes=7-": "789", "bytes=-3": "789", "bytes=8-20": "89"} {
+			response := serveTestAsset(t, "application/javascript", map[string]string{"Range": rangeHeader, "Accept-Encoding": "gzip"})
+			assert.Equal(t, http.StatusPartialContent, response.Code, rangeHeader)
+			assert.Equal(t, expected, response.Body.String(), rangeHeader)
+			assert.Empty(t, response.Header().Get("Content-Encoding"), rangeHeader)
+		}
+		response, opened := serveTestAssetReads(t, "image/png", map[string]string{"Range": "bytes=2-5"})
+		assert.Equal(t, "bytes 2-5/10", response.Header().Get("Content-Range"))
+		// Only the range is read from the bucket
+		assert.Equal(t, []openedRange{{2, 4}}, opened)
+
+		response = serveTestAsset(t, "image/png", map[string]string{"Range": "bytes=10-"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, response.Code)
+		assert.Equal(t, "bytes */10", response.Header().Get("Content-Range"))
+
+		// Multiple ranges and stale If-Range get the whole asset
+		response = serveTestAsset(t, "image/png", map[string]string{"Range": "bytes=0-1,4-5"})
+		assert.Equal(t, http.StatusOK, response.Code)
+		response = serveTestAsset(t, "image/png", map[string]string{"Range": "bytes=2-5", "If-Range": `"other"`})
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "0123456789", response.Body.String())
+		response = serveTestAsset(t, "image/png", map[string]string{"Range": "bytes=2-5", "If-Range": `"` + testAssetHash + `"`})
+		assert.Equal(t, http.StatusPartialContent, response.Code)
+	})
+
+	t.Run("Conditional", func(t *testing.T) {
+		response, opened := serveTestAssetReads(t, "image/png", map[string]string{"If-None-Match": `"other", "` + testAssetHash + `"`})
+		assert.Equal(t, http.StatusNotModified, response.Code)
+		assert.Empty(t, response.Body.String())
+		assert.Empty(t, opened)
+		response = serveTestAsset(t, "image/png", map[string]string{"If-None-Match": `"` + testAssetHash + `-gzip"`})
+		assert.Equal(t, http.StatusNotModified, response.Code)
+		response = serveTestAsset(t, "image/png", map[string]string{"If-None-Match": `"other"`})
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		response = serveTestAsset(t, "image/png", map[string]string{"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"})
+		assert.Equal(t, http.StatusNotModified, response.Code)
+		response = serveTestAsset(t, "image/png", map[string]string{"If-Modified-Since": "Tue, 30 Apr 2024 12:00:00 GMT"})
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("PrecompressedVariant", func(t *testing.T) {
+		opened := []openedRange{}
+		file := &types.BucketFile{
+			Open:     openContent("compressed", &opened),
+			SHA256:   testAssetHash,
+			Size:     10,
+			Encoding: "br",
+		}
+		request := httptest.NewRequest(http.MethodGet, "/assets", nil)
+		response := httptest.NewRecorder()
+		ServeAssetFile(response, request, file, "application/javascript", "test")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "br", response.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", response.Header().Get("Vary"))
+		assert.Equal(t, `"`+testAssetHash+`-br"`, response.Header().Get("ETag"))
+		assert.Equal(t, "10", response.Header().Get("Content-Length"))
+		assert.Equal(t, "compressed", response.Body.String())
+	})
+}
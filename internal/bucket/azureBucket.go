@@ -0,0 +1,234 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// AzureBucket stores updates in an Azure Blob Storage container. Requests are
+// authorized with the account key, which also signs the SAS URLs clients
+// upload to directly. AZURE_STORAGE_ENDPOINT points it at Azurite.
+type AzureBucket struct {
+	objectStoreBucket
+	ContainerName string
+}
+
+type azureStore struct {
+	client *container.Client
+}
+
+func NewAzureBucket() (*AzureBucket, error) {
+	account := config.GetEnv("AZURE_STORAGE_ACCOUNT")
+	accountKey := config.GetEnv("AZURE_STORAGE_KEY")
+	containerName := config.GetEnv("AZURE_STORAGE_CONTAINER")
+	if account == "" || accountKey == "" || containerName == "" {
+		return nil, errors.New("AZURE_STORAGE_ACCOUNT, AZURE_STORAGE_KEY and AZURE_STORAGE_CONTAINER are required")
+	}
+	endpoint := config.GetEnv("AZURE_STORAGE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	store, err := newAzureStore(strings.TrimSuffix(endpoint, "/")+"/"+containerName, account, accountKey)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureBucket{
+		objectStoreBucket: objectStoreBucket{store: store},
+		ContainerName:     containerName,
+	}, nil
+}
+
+func newAzureStore(containerUrl string, account string, accountKey string) (*azureStore, error) {
+	credential, err := container.NewSharedKeyCredential(account, accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding AZURE_STORAGE_KEY: %w", err)
+	}
+	client, err := container.NewClientWithSharedKeyCredential(containerUrl, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Azure client: %w", err)
+	}
+	return &azureStore{client: client}, nil
+}
+
+func isAzureNotFound(err error) bool {
+	return bloberror.HasCode(err, bloberror.BlobNotFound)
+}
+
+func (s *azureStore) list(prefix string, delimiter string) ([]storedObject, []string, error) {
+	objects := []storedObject{}
+	prefixes := []string{}
+	appendBlobs := func(blobs []*container.BlobItem) {
+		for _, item := range blobs {
+			object := storedObject{Key: *item.Name}
+			if item.Properties != nil {
+				if item.Properties.LastModified != nil {
+					object.LastModified = *item.Properties.LastModified
+				}
+				if item.Properties.ContentLength != nil {
+					object.Size = *item.Properties.ContentLength
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+	ctx := context.Background()
+	if delimiter == "" {
+		pager := s.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error listing %s: %w", prefix, err)
+			}
+			appendBlobs(page.Segment.BlobItems)
+		}
+		return objects, prefixes, nil
+	}
+	pager := s.client.NewListBlobsHierarchyPager(delimiter, &container.ListBlobsHierarchyOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+		appendBlobs(page.Segment.BlobItems)
+		for _, blobPrefix := range page.Segment.BlobPrefixes {
+			prefixes = append(prefixes, *blobPrefix.Name)
+		}
+	}
+	return objects, prefixes, nil
+}
+
+func (s *azureStore) download(key string, options *blob.DownloadStreamOptions) (io.ReadCloser, error) {
+	response, err := s.client.NewBlobClient(key).DownloadStream(context.Background(), options)
+	if isAzureNotFound(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return response.Body, nil
+}
+
+func (s *azureStore) read(key string) (io.ReadCloser, error) {
+	return s.download(key, nil)
+}
+
+func (s *azureStore) readRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	return s.download(key, &blob.DownloadStreamOptions{Range: blob.HTTPRange{Offset: offset, Count: length}})
+}
+
+func (s *azureStore) write(key string, content io.Reader) error {
+	// Content is staged in blocks as it is read, small objects take a single request
+	if _, err := s.client.NewBlockBlobClient(key).UploadStream(context.Background(), content, nil); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *azureStore) readVersion(key string) (io.ReadCloser, string, error) {
+	response, err := s.client.NewBlobClient(key).DownloadStream(context.Background(), nil)
+	if isAzureNotFound(err) {
+		return nil, "", ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %w", key, err)
+	}
+	version := ""
+	if response.ETag != nil {
+		version = string(*response.ETag)
+	}
+	return response.Body, version, nil
+}
+
+func (s *azureStore) writeIf(key string, content io.Reader, version string) error {
+	conditions := &blob.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)}
+	if version != "" {
+		conditions = &blob.ModifiedAccessConditions{IfMatch: to.Ptr(azcore.ETag(version))}
+	}
+	_, err := s.client.NewBlockBlobClient(key).UploadStream(context.Background(), content, &blockblob.UploadStreamOptions{
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: conditions},
+	})
+	if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *azureStore) remove(key string) error {
+	_, err := s.client.NewBlobClient(key).Delete(context.Background(), nil)
+	if err != nil && !isAzureNotFound(err) {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *azureStore) copy(sourceKey string, targetKey string) error {
+	ctx := context.Background()
+	// The account key authorizes reading sources of the same account
+	source := s.client.NewBlobClient(sourceKey).URL()
+	target := s.client.NewBlobClient(targetKey)
+	response, err := target.StartCopyFromURL(ctx, source, nil)
+	if isAzureNotFound(err) || bloberror.HasCode(err, bloberror.CannotVerifyCopySource) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", sourceKey, targetKey, err)
+	}
+	// Copies within an account usually complete synchronously
+	status := response.CopyStatus
+	for attempt := 0; status != nil && *status == blob.CopyStatusTypePending && attempt < 60; attempt++ {
+		time.Sleep(500 * time.Millisecond)
+		properties, err := target.GetProperties(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error reading copy status of %s: %w", targetKey, err)
+		}
+		status = properties.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("error copying %s to %s: status %s", sourceKey, targetKey, *status)
+	}
+	return nil
+}
+
+func (s *azureStore) stat(key string) (*storedObject, error) {
+	properties, err := s.client.NewBlobClient(key).GetProperties(context.Background(), nil)
+	if isAzureNotFound(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading properties of %s: %w", key, err)
+	}
+	object := &storedObject{Key: key}
+	if properties.LastModified != nil {
+		object.LastModified = *properties.LastModified
+	}
+	if properties.ContentLength != nil {
+		object.Size = *properties.ContentLength
+	}
+	return object, nil
+}
+
+func (s *azureStore) signUpload(key string, validity time.Duration) (string, map[string]string, error) {
+	signedUrl, err := s.client.NewBlockBlobClient(key).GetSASURL(sas.BlobPermissions{Create: true, Write: true}, time.Now().Add(validity), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("error signing upload URL of %s: %w", key, err)
+	}
+	return signedUrl, map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+	}, nil
+}
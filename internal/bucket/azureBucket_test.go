@@ -0,0 +1,280 @@
+package bucket
+
+import (
+	"bytes"
+	"encoding/xml"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const standInAzureAccount = "devstoreaccount1"
+
+// azureStandIn is an in-memory server speaking the part of the Blob service
+// API the bucket uses, addressed path-style like Azurite.
+type azureStandIn struct {
+	mutex         sync.Mutex
+	containerName string
+	blobs         map[string]standInObject
+	// blocks are the staged, uncommitted blocks by blob and block id
+	blocks   map[string]map[string][]byte
+	requests []string
+}
+
+type azureStandInBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified  string `xml:"Last-Modified"`
+		ContentLength int    `xml:"Content-Length"`
+		BlobType      string `xml:"BlobType"`
+	} `xml:"Properties"`
+}
+
+type azureStandInPrefix struct {
+	Name string `xml:"Name"`
+}
+
+type azureStandInListResult struct {
+	XMLName         xml.Name `xml:"EnumerationResults"`
+	ServiceEndpoint string   `xml:"ServiceEndpoint,attr"`
+	ContainerName   string   `xml:"ContainerName,attr"`
+	Prefix          string   `xml:"Prefix"`
+	Delimiter       string   `xml:"Delimiter,omitempty"`
+	Blobs           struct {
+		Blob       []azureStandInBlob   `xml:"Blob"`
+		BlobPrefix []azureStandInPrefix `xml:"BlobPrefix"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+type azureStandInBlockList struct {
+	Latest []string `xml:"Latest"`
+}
+
+func writeAzureStandInError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"utf-8\"?><Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *azureStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	query := r.URL.Query()
+	// Requests are signed with the account key, or carry a SAS
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey "+standInAzureAccount+":") && query.Get("sig") == "" {
+		writeAzureStandInError(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+	s.requests = append(s.requests, r.Method+" "+query.Get("comp"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+standInAzureAccount+"/")
+	containerName, key, _ := strings.Cut(path, "/")
+	if containerName != s.containerName {
+		writeAzureStandInError(w, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("comp") == "list":
+		s.list(w, query.Get("prefix"), query.Get("delimiter"))
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		body, _ := io.ReadAll(r.Body)
+		if s.blocks[key] == nil {
+			s.blocks[key] = map[string][]byte{}
+		}
+		s.blocks[key][query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var blockList azureStandInBlockList
+		if err := xml.NewDecoder(r.Body).Decode(&blockList); err != nil {
+			writeAzureStandInError(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+		content := []byte{}
+		for _, blockId := range blockList.Latest {
+			block, ok := s.blocks[key][blockId]
+			if !ok {
+				writeAzureStandInError(w, http.StatusBadRequest, "InvalidBlockList")
+				return
+			}
+			content = append(content, block...)
+		}
+		if !s.checkPreconditions(w, r, key) {
+			return
+		}
+		delete(s.blocks, key)
+		s.blobs[key] = newStandInObject(content)
+		w.Header().Set("ETag", s.blobs[key].etag)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-copy-source") != "":
+		source, err := url.Parse(r.Header.Get("x-ms-copy-source"))
+		if err != nil {
+			writeAzureStandInError(w, http.StatusBadRequest, "InvalidHeaderValue")
+			return
+		}
+		_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source.Path, "/"+standInAzureAccount+"/"), "/")
+		object, ok := s.blobs[sourceKey]
+		if !ok {
+			writeAzureStandInError(w, http.StatusNotFound, "CannotVerifyCopySource")
+			return
+		}
+		s.blobs[key] = newStandInObject(object.content)
+		w.Header().Set("x-ms-copy-id", "standin")
+		w.Header().Set("x-ms-copy-status", "success")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			writeAzureStandInError(w, http.StatusBadRequest, "MissingRequiredHeader")
+			return
+		}
+		if !s.checkPreconditions(w, r, key) {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.blobs[key] = newStandInObject(body)
+		w.Header().Set("ETag", s.blobs[key].etag)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := s.blobs[key]
+		if !ok {
+			writeAzureStandInError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		content, status := object.content, http.StatusOK
+		if rangeHeader := r.Header.Get("x-ms-range"); rangeHeader != "" && r.Method == http.MethodGet {
+			var first, last int
+			if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &first, &last); err != nil || first >= len(content) {
+				writeAzureStandInError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			last = min(last, len(content)-1)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(content)))
+			content, status = content[first:last+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", object.lastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := s.blobs[key]; !ok {
+			writeAzureStandInError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(s.blobs, key)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeAzureStandInError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// checkPreconditions answers writes whose If-Match or If-None-Match header
+// rejects the current blob, like the Blob service does.
+func (s *azureStandIn) checkPreconditions(w http.ResponseWriter, r *http.Request, key string) bool {
+	current, ok := s.blobs[key]
+	if !standInPreconditionFails(r, current, ok) {
+		return true
+	}
+	if r.Header.Get("If-None-Match") == "*" {
+		writeAzureStandInError(w, http.StatusConflict, "BlobAlreadyExists")
+	} else {
+		writeAzureStandInError(w, http.StatusPreconditionFailed, "ConditionNotMet")
+	}
+	return false
+}
+
+func (s *azureStandIn) list(w http.ResponseWriter, prefix string, delimiter string) {
+	result := azureStandInListResult{ContainerName: s.containerName, Prefix: prefix, Delimiter: delimiter}
+	keys := make([]string, 0, len(s.blobs))
+	for key := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	seenPrefixes := map[string]bool{}
+	for _, key := range keys {
+		if delimiter != "" {
+			if index := strings.Index(key[len(prefix):], delimiter); index >= 0 {
+				blobPrefix := key[:len(prefix)+index+len(delimiter)]
+				if !seenPrefixes[blobPrefix] {
+					seenPrefixes[blobPrefix] = true
+					result.Blobs.BlobPrefix = append(result.Blobs.BlobPrefix, azureStandInPrefix{Name: blobPrefix})
+				}
+				continue
+			}
+		}
+		blob := azureStandInBlob{Name: key}
+		blob.Properties.LastModified = s.blobs[key].lastModified.UTC().Format(http.TimeFormat)
+		blob.Properties.ContentLength = len(s.blobs[key].content)
+		blob.Properties.BlobType = "BlockBlob"
+		result.Blobs.Blob = append(result.Blobs.Blob, blob)
+	}
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	_ = xml.NewEncoder(&body).Encode(result)
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(body.Bytes())
+}
+
+func newStandInAzureBucket(t *testing.T) (*azureStandIn, *AzureBucket) {
+	standIn := &azureStandIn{
+		containerName: "ota-updates",
+		blobs:         map[string]standInObject{},
+		blocks:        map[string]map[string][]byte{},
+	}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	t.Setenv("AZURE_STORAGE_ACCOUNT", standInAzureAccount)
+	t.Setenv("AZURE_STORAGE_KEY", azuriteAccountKey)
+	t.Setenv("AZURE_STORAGE_CONTAINER", standIn.containerName)
+	t.Setenv("AZURE_STORAGE_ENDPOINT", server.URL+"/"+standInAzureAccount)
+	azureBucket, err := NewAzureBucket()
+	require.NoError(t, err)
+	return standIn, azureBucket
+}
+
+func TestAzureBucketStreamsUploadsInBlocks(t *testing.T) {
+	standIn, azureBucket := newStandInAzureBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+
+	// A reader of unknown length is staged block by block, not buffered whole
+	content := strings.Repeat("0123456789abcdef", 160*1024)
+	require.NoError(t, azureBucket.UploadFileIntoUpdate(update, "bundles/ios.js", io.LimitReader(strings.NewReader(content), int64(len(content)))))
+	assert.Equal(t, 3, countRequests(standIn, "PUT block"))
+	assert.Equal(t, 1, countRequests(standIn, "PUT blocklist"))
+	file, err := azureBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "bundles/ios.js")
+	require.NoError(t, err)
+	assert.Equal(t, content, readAll(t, file))
+
+	section, err := azureBucket.GetFileRange(update.Branch, update.RuntimeVersion, update.UpdateId, "bundles/ios.js", int64(len(content))-16, 16)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", readAll(t, section))
+}
+
+func countRequests(standIn *azureStandIn, request string) int {
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	count := 0
+	for _, made := range standIn.requests {
+		if made == request {
+			count++
+		}
+	}
+	return count
+}
@@ -2,13 +2,19 @@ package bucket
 
 import (
 	"bytes"
+	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/types"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type RuntimeVersionWithStats struct {
@@ -24,54 +30,195 @@ const (
 	S3BucketType       BucketType = "s3"
 	LocalBucketType    BucketType = "local"
 	FirebaseBucketType BucketType = "firebase"
+	GCSBucketType      BucketType = "gcs"
+	AzureBucketType    BucketType = "azure"
 )
 
+// Bucket is the storage backend holding updates. Every implementation must
+// pass the conformance suite in conformance_test.go: listings of a missing
+// branch or runtime version are empty rather than errors, and storage errors
+// are returned, never swallowed.
 type Bucket interface {
+	// GetUpdate returns an update holding a metadata.json, or an error
+	// wrapping ErrUpdateNotFound.
 	GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error)
+	// GetUpdates returns the updates listed by ListUpdates, newest first.
 	GetUpdates(branch string, runtimeVersion string) ([]types.Update, error)
+	// GetBranches returns the branch names sorted, without SystemPrefix.
 	GetBranches() ([]string, error)
+	// GetRuntimeVersions returns the runtime versions holding updates, sorted by name.
 	GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error)
 	GetFile(branch string, runtimeVersion string, updateId string, fileName string) (io.ReadCloser, error)
+	// GetFileRange reads length bytes of a file of an update from offset,
+	// with a ranged request on remote storages.
+	GetFileRange(branch string, runtimeVersion string, updateId string, fileName string, offset int64, length int64) (io.ReadCloser, error)
+	// StatFile describes a file of an update, or returns an error wrapping
+	// ErrObjectNotFound.
+	StatFile(branch string, runtimeVersion string, updateId string, fileName string) (ObjectInfo, error)
 	UploadFileIntoUpdate(update types.Update, fileName string, content io.Reader) error
+	// DeleteUpdateFolder removes every file of an update, missing updates are ignored.
 	DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error
+	// RequestUploadUrlsForFileUpdates returns one request per file, its Path is
+	// always "branch/runtimeVersion/updateId/fileName".
 	RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]types.FileUpdateRequest, error)
+	// ListUpdates returns the update ids of a runtime version sorted.
 	ListUpdates(branch string, runtimeVersion string) ([]string, error)
+	// CopyFile copies a file of an update into another update server-side.
+	CopyFile(source types.Update, target types.Update, fileName string) error
+	// GetObject, PutObject and DeleteObject manage server-owned files that are
+	// not part of an update (channel registry, indexes...), stored under SystemPrefix.
+	GetObject(key string) (io.ReadCloser, error)
+	// GetObjectRange reads length bytes of a server-owned object from offset.
+	GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error)
+	PutObject(key string, content io.Reader) error
+	// GetObjectWithVersion reads a server-owned object along with its
+	// version (ETag, generation...), or returns ErrObjectNotFound.
+	GetObjectWithVersion(key string) (io.ReadCloser, string, error)
+	// PutObjectIfVersion writes a server-owned object only while its version
+	// is still version, or with an empty version only if it does not exist.
+	// The check and the write are atomic on the storage, it returns
+	// ErrVersionConflict when another writer got there first.
+	PutObjectIfVersion(key string, content io.Reader, version string) error
+	DeleteObject(key string) error
+	ObjectExists(key string) (bool, error)
+	// StatObject describes a server-owned object, or returns ErrObjectNotFound.
+	StatObject(key string) (ObjectInfo, error)
+	// MoveFileToObject moves a file of an update to a server-owned object.
+	MoveFileToObject(update types.Update, fileName string, key string) error
+	// ListObjects lists the server-owned objects whose key starts with prefix.
+	ListObjects(prefix string) ([]ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored file. The key of a server-owned object is
+// relative to SystemPrefix, the key of an update file is its file name.
+type ObjectInfo struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+// rangeHeader is the HTTP Range header value of length bytes from offset.
+func rangeHeader(offset int64, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// SystemPrefix is the top-level folder holding server-owned objects. It is
+// never reported as a branch.
+const SystemPrefix = "_ota"
+
+var ErrObjectNotFound = errors.New("object not found")
+
+var ErrUpdateNotFound = errors.New("update not found")
+
+var ErrVersionConflict = errors.New("object was modified concurrently")
+
+func isSystemFolder(name string) bool {
+	return name == SystemPrefix
+}
+
+func updateNotFound(branch string, runtimeVersion string, updateId string) error {
+	return fmt.Errorf("%w: %s/%s/%s", ErrUpdateNotFound, branch, runtimeVersion, updateId)
+}
+
+// updateObjectKey is the slash-separated path of an update file, relative to
+// the bucket root.
+func updateObjectKey(branch string, runtimeVersion string, updateId string, fileName string) string {
+	return path.Join(branch, runtimeVersion, updateId, fileName)
+}
+
+// updateCreatedAt derives the creation time of an update from its id when it
+// is a millisecond timestamp.
+func updateCreatedAt(updateId string) time.Duration {
+	timestamp, err := strconv.ParseInt(updateId, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(timestamp) * time.Millisecond
+}
+
+// updateBuildNumber returns N for build-N-uuid update ids, -1 otherwise.
+func updateBuildNumber(updateId string) int {
+	if !strings.HasPrefix(updateId, "build-") {
+		return -1
+	}
+	parts := strings.SplitN(updateId, "-", 3)
+	buildNumber, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return -1
+	}
+	return buildNumber
+}
+
+// newUpdates builds the updates of a runtime version from their ids, newest
+// first: by creation time, then build number, then id.
+func newUpdates(branch string, runtimeVersion string, updateIds []string) []types.Update {
+	updates := make([]types.Update, 0, len(updateIds))
+	for _, updateId := range updateIds {
+		updates = append(updates, types.Update{
+			Branch:         branch,
+			RuntimeVersion: runtimeVersion,
+			UpdateId:       updateId,
+			CreatedAt:      updateCreatedAt(updateId),
+		})
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
+		if updates[i].CreatedAt != updates[j].CreatedAt {
+			return updates[i].CreatedAt > updates[j].CreatedAt
+		}
+		buildI, buildJ := updateBuildNumber(updates[i].UpdateId), updateBuildNumber(updates[j].UpdateId)
+		if buildI != buildJ {
+			return buildI > buildJ
+		}
+		return updates[i].UpdateId > updates[j].UpdateId
+	})
+	return updates
+}
+
+// newRuntimeVersionStats summarizes the updates of a runtime version, the
+// dates come from the timestamp ids.
+func newRuntimeVersionStats(runtimeVersion string, updateIds []string) RuntimeVersionWithStats {
+	stats := RuntimeVersionWithStats{
+		RuntimeVersion:  runtimeVersion,
+		NumberOfUpdates: len(updateIds),
+	}
+	var timestamps []time.Duration
+	for _, updateId := range updateIds {
+		if createdAt := updateCreatedAt(updateId); createdAt > 0 {
+			timestamps = append(timestamps, createdAt)
+		}
+	}
+	if len(timestamps) > 0 {
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+		stats.CreatedAt = time.UnixMilli(timestamps[0].Milliseconds()).UTC().Format(time.RFC3339)
+		stats.LastUpdatedAt = time.UnixMilli(timestamps[len(timestamps)-1].Milliseconds()).UTC().Format(time.RFC3339)
+	}
+	return stats
 }
 
 var bucket Bucket
 var bucketInitError error
 
 func init() {
-	// Get bucket configuration
-	bucketType := config.GetEnv("BUCKET_TYPE")
-	storageMode := config.GetEnv("STORAGE_MODE")
-
-	// Align storage mode with bucket type if needed
-	if bucketType != "" && (storageMode == "" || storageMode != string(bucketType)) {
-		log.Printf("STORAGE_MODE (%s) doesn't match BUCKET_TYPE (%s), setting STORAGE_MODE=%s",
-			storageMode, bucketType, bucketType)
-		// Update the storage mode to match bucket type
-		os.Setenv("STORAGE_MODE", string(bucketType))
-		storageMode = string(bucketType)
-	} else if bucketType == "" && storageMode != "" {
-		// If bucket type is not set but storage mode is, set bucket type to match storage mode
-		log.Printf("BUCKET_TYPE not set but STORAGE_MODE is %s, setting BUCKET_TYPE=%s", storageMode, storageMode)
-		os.Setenv("BUCKET_TYPE", storageMode)
-		bucketType = storageMode
-	}
-
-	if bucketType == "" {
-		bucketType = string(LocalBucketType)
-		log.Printf("No BUCKET_TYPE or STORAGE_MODE specified, using default: %s", bucketType)
-		os.Setenv("BUCKET_TYPE", bucketType)
-		os.Setenv("STORAGE_MODE", bucketType)
-	} else {
-		log.Printf("Using bucket type: %s", bucketType)
+	initBucket()
+}
+
+// ResolveBucketType returns the configured bucket type, see
+// config.ResolveStorageMode.
+func ResolveBucketType() BucketType {
+	return BucketType(config.ResolveStorageMode())
+}
+
+func initBucket() {
+	bucketType := ResolveBucketType()
+	if storageMode := os.Getenv("STORAGE_MODE"); storageMode != "" && storageMode != string(bucketType) {
+		log.Printf("STORAGE_MODE (%s) doesn't match BUCKET_TYPE (%s), using %s", storageMode, bucketType, bucketType)
 	}
+	log.Printf("Using bucket type: %s", bucketType)
+	bucketInitError = nil
 
 	// First try to initialize the configured bucket type
 	var initErr error
-	switch BucketType(bucketType) {
+	switch bucketType {
 	case LocalBucketType:
 		log.Printf("Initializing local bucket with path: %s", config.GetEnv("LOCAL_BUCKET_BASE_PATH"))
 		bucket = NewLocalBucket()
@@ -94,8 +241,26 @@ func init() {
 			}
 		}
 	case S3BucketType:
-		log.Printf("Initializing S3 bucket: %s in region %s", config.GetEnv("S3_BUCKET_NAME"), config.GetEnv("AWS_REGION"))
+		if endpoint := config.GetEnv("S3_ENDPOINT"); endpoint != "" {
+			log.Printf("Initializing S3-compatible bucket: %s at %s", config.GetEnv("S3_BUCKET_NAME"), endpoint)
+		} else {
+			log.Printf("Initializing S3 bucket: %s in region %s", config.GetEnv("S3_BUCKET_NAME"), config.GetEnv("AWS_REGION"))
+		}
 		bucket = &S3Bucket{BucketName: config.GetEnv("S3_BUCKET_NAME")}
+	case GCSBucketType:
+		log.Printf("Initializing Cloud Storage bucket: %s", config.GetEnv("GCS_BUCKET_NAME"))
+		var err error
+		bucket, err = NewGCSBucket()
+		if err != nil {
+			initErr = fmt.Errorf("error creating Cloud Storage bucket: %w", err)
+		}
+	case AzureBucketType:
+		log.Printf("Initializing Azure Blob Storage container: %s", config.GetEnv("AZURE_STORAGE_CONTAINER"))
+		var err error
+		bucket, err = NewAzureBucket()
+		if err != nil {
+			initErr = fmt.Errorf("error creating Azure Blob Storage bucket: %w", err)
+		}
 	default:
 		initErr = fmt.Errorf("unknown bucket type: %s", bucketType)
 	}
@@ -112,6 +277,9 @@ func init() {
 }
 
 func GetBucket() Bucket {
+	if bucket == nil {
+		initBucket()
+	}
 	if bucketInitError != nil {
 		log.Printf("WARNING: Using fallback bucket due to initialization error: %v", bucketInitError)
 	}
@@ -132,9 +300,10 @@ func ResetBucketInstance() {
 }
 
 type FileUploadRequest struct {
-	RequestUploadUrl string `json:"requestUploadUrl"`
-	FileName         string `json:"fileName"`
-	FilePath         string `json:"filePath"`
+	RequestUploadUrl string            `json:"requestUploadUrl"`
+	FileName         string            `json:"fileName"`
+	FilePath         string            `json:"filePath"`
+	Headers          map[string]string `json:"headers,omitempty"`
 }
 
 func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]FileUploadRequest, error) {
@@ -165,6 +334,7 @@ func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updat
 					RequestUploadUrl: fileRequests[0].Url,
 					FileName:         fileName,
 					FilePath:         fileRequests[0].Path,
+					Headers:          fileRequests[0].Headers,
 				})
 				mu.Unlock()
 			}
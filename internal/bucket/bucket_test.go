@@ -2,6 +2,7 @@ package bucket
 
 import (
 	"bytes"
+	"expo-open-ota/internal/types"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -31,6 +32,21 @@ func TestResolveS3BucketType(t *testing2.T) {
 	assert.Equal(t, S3BucketType, bucketType)
 }
 
+func TestResolveBucketTypeLeavesEnvironmentUnchanged(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	t.Setenv("BUCKET_TYPE", "s3")
+	t.Setenv("STORAGE_MODE", "local")
+	assert.Equal(t, S3BucketType, ResolveBucketType())
+	assert.Equal(t, "local", os.Getenv("STORAGE_MODE"))
+
+	t.Setenv("BUCKET_TYPE", "")
+	t.Setenv("STORAGE_MODE", "")
+	assert.Equal(t, LocalBucketType, ResolveBucketType())
+	assert.Equal(t, "", os.Getenv("BUCKET_TYPE"))
+	assert.Equal(t, "", os.Getenv("STORAGE_MODE"))
+}
+
 func TestConvertReadCloserToBytes(t *testing2.T) {
 	teardown := setup(t)
 	defer teardown()
@@ -85,3 +101,47 @@ func TestGetLocalBucket(t *testing2.T) {
 	bucket := GetBucket()
 	assert.IsType(t, &LocalBucket{}, bucket)
 }
+
+func TestLocalBucketSystemObjects(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	bucket := &LocalBucket{BasePath: t.TempDir()}
+
+	_, err := bucket.GetObject("channels.json")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	err = bucket.PutObject("channels.json", bytes.NewReader([]byte("[]")))
+	assert.Nil(t, err)
+	object, err := bucket.GetObject("channels.json")
+	assert.Nil(t, err)
+	content, err := ConvertReadCloserToBytes(object)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("[]"), content)
+
+	branches, err := bucket.GetBranches()
+	assert.Nil(t, err)
+	assert.NotContains(t, branches, SystemPrefix)
+
+	assert.Nil(t, bucket.DeleteObject("channels.json"))
+	_, err = bucket.GetObject("channels.json")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestLocalBucketMoveFileToObject(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	bucket := &LocalBucket{BasePath: t.TempDir()}
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1"}
+
+	assert.Nil(t, bucket.UploadFileIntoUpdate(update, "assets/icon", bytes.NewReader([]byte("icon"))))
+	exists, err := bucket.ObjectExists("assets/abc")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	assert.Nil(t, bucket.MoveFileToObject(update, "assets/icon", "assets/abc"))
+	exists, err = bucket.ObjectExists("assets/abc")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	_, err = bucket.GetFile("main", "1.0.0", "1", "assets/icon")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+}
@@ -0,0 +1,396 @@
+package bucket
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// azuriteAccountKey is the well-known key of the Azurite emulator account.
+const azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+type conformanceOptions struct {
+	// directUploads is set for backends handing out URLs clients PUT files to.
+	directUploads bool
+}
+
+func uploadFile(t *testing.T, b Bucket, update types.Update, fileName string, content string) {
+	require.NoError(t, b.UploadFileIntoUpdate(update, fileName, strings.NewReader(content)))
+}
+
+func readFile(t *testing.T, b Bucket, update types.Update, fileName string) string {
+	file, err := b.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	require.NoError(t, err)
+	require.NotNil(t, file)
+	return readAll(t, file)
+}
+
+// runBucketConformance checks the behaviour every Bucket implementation must
+// share. newBucket returns an empty bucket for each subtest.
+func runBucketConformance(t *testing.T, newBucket func(t *testing.T) Bucket, options conformanceOptions) {
+	first := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	second := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000001"}
+	other := types.Update{Branch: "staging", RuntimeVersion: "2.0.0", UpdateId: "1700000000002"}
+
+	t.Run("UpdateFiles", func(t *testing.T) {
+		b := newBucket(t)
+		uploadFile(t, b, first, "metadata.json", `{"version":0}`)
+		uploadFile(t, b, first, "assets/icon.png", "png")
+		assert.Equal(t, `{"version":0}`, readFile(t, b, first, "metadata.json"))
+		assert.Equal(t, "png", readFile(t, b, first, "assets/icon.png"))
+
+		_, err := b.GetFile(first.Branch, first.RuntimeVersion, first.UpdateId, "missing.json")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		section, err := b.GetFileRange(first.Branch, first.RuntimeVersion, first.UpdateId, "metadata.json", 2, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "version", readAll(t, section))
+		_, err = b.GetFileRange(first.Branch, first.RuntimeVersion, first.UpdateId, "missing.json", 0, 1)
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		info, err := b.StatFile(first.Branch, first.RuntimeVersion, first.UpdateId, "assets/icon.png")
+		require.NoError(t, err)
+		assert.Equal(t, "assets/icon.png", info.Key)
+		assert.Equal(t, int64(3), info.Size)
+		assert.WithinDuration(t, time.Now(), info.LastModified, time.Hour)
+		_, err = b.StatFile(first.Branch, first.RuntimeVersion, first.UpdateId, "missing.json")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+	})
+
+	t.Run("GetUpdate", func(t *testing.T) {
+		b := newBucket(t)
+		uploadFile(t, b, first, "metadata.json", `{"version":0}`)
+		// A folder without metadata.json is an upload that never completed
+		uploadFile(t, b, second, "assets/icon.png", "png")
+
+		update, err := b.GetUpdate(first.Branch, first.RuntimeVersion, first.UpdateId)
+		require.NoError(t, err)
+		require.NotNil(t, update)
+		assert.Equal(t, first.UpdateId, update.UpdateId)
+		assert.Equal(t, first.Branch, update.Branch)
+		assert.Equal(t, first.RuntimeVersion, update.RuntimeVersion)
+		assert.Equal(t, 1700000000000*time.Millisecond, update.CreatedAt)
+
+		update, err = b.GetUpdate(second.Branch, second.RuntimeVersion, second.UpdateId)
+		assert.ErrorIs(t, err, ErrUpdateNotFound)
+		assert.Nil(t, update)
+		update, err = b.GetUpdate(other.Branch, other.RuntimeVersion, other.UpdateId)
+		assert.ErrorIs(t, err, ErrUpdateNotFound)
+		assert.Nil(t, update)
+	})
+
+	t.Run("EmptyListing", func(t *testing.T) {
+		b := newBucket(t)
+		require.NoError(t, b.PutObject("channels.json", strings.NewReader("[]")))
+
+		runtimeVersions, err := b.GetRuntimeVersions("main")
+		require.NoError(t, err)
+		assert.NotNil(t, runtimeVersions)
+		assert.Empty(t, runtimeVersions)
+		updateIds, err := b.ListUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		assert.NotNil(t, updateIds)
+		assert.Empty(t, updateIds)
+		updates, err := b.GetUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		assert.Empty(t, updates)
+		// Listing must not create anything
+		branches, err := b.GetBranches()
+		require.NoError(t, err)
+		assert.NotNil(t, branches)
+		assert.Empty(t, branches)
+	})
+
+	t.Run("Listing", func(t *testing.T) {
+		b := newBucket(t)
+		for _, update := range []types.Update{first, second, other} {
+			uploadFile(t, b, update, "metadata.json", `{"version":0}`)
+		}
+		require.NoError(t, b.PutObject("channels.json", strings.NewReader("[]")))
+
+		branches, err := b.GetBranches()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"main", "staging"}, branches)
+
+		updateIds, err := b.ListUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{first.UpdateId, second.UpdateId}, updateIds)
+
+		updates, err := b.GetUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		listedIds := []string{}
+		for _, update := range updates {
+			listedIds = append(listedIds, update.UpdateId)
+		}
+		assert.ElementsMatch(t, []string{first.UpdateId, second.UpdateId}, listedIds)
+
+		runtimeVersions, err := b.GetRuntimeVersions("main")
+		require.NoError(t, err)
+		require.Len(t, runtimeVersions, 1)
+		assert.Equal(t, "1.0.0", runtimeVersions[0].RuntimeVersion)
+		assert.Equal(t, 2, runtimeVersions[0].NumberOfUpdates)
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		b := newBucket(t)
+		updateIds := []string{"1700000000001", "build-2-b", "1700000000003", "build-10-a", "1700000000002"}
+		for _, updateId := range updateIds {
+			uploadFile(t, b, types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: updateId}, "metadata.json", `{"version":0}`)
+		}
+		for _, update := range []types.Update{
+			{Branch: "staging", RuntimeVersion: "2.0.0", UpdateId: "1"},
+			{Branch: "main", RuntimeVersion: "0.9.0", UpdateId: "1"},
+			{Branch: "develop", RuntimeVersion: "1.0.0", UpdateId: "1"},
+		} {
+			uploadFile(t, b, update, "metadata.json", `{"version":0}`)
+		}
+
+		branches, err := b.GetBranches()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"develop", "main", "staging"}, branches)
+
+		listedIds, err := b.ListUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1700000000001", "1700000000002", "1700000000003", "build-10-a", "build-2-b"}, listedIds)
+
+		updates, err := b.GetUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		newestFirst := []string{}
+		for _, update := range updates {
+			newestFirst = append(newestFirst, update.UpdateId)
+		}
+		assert.Equal(t, []string{"1700000000003", "1700000000002", "1700000000001", "build-10-a", "build-2-b"}, newestFirst)
+
+		runtimeVersions, err := b.GetRuntimeVersions("main")
+		require.NoError(t, err)
+		require.Len(t, runtimeVersions, 2)
+		assert.Equal(t, "0.9.0", runtimeVersions[0].RuntimeVersion)
+		assert.Equal(t, "1.0.0", runtimeVersions[1].RuntimeVersion)
+		assert.Equal(t, len(updateIds), runtimeVersions[1].NumberOfUpdates)
+		assert.Equal(t, "2023-11-14T22:13:20Z", runtimeVersions[1].CreatedAt)
+		assert.Equal(t, "2023-11-14T22:13:20Z", runtimeVersions[1].LastUpdatedAt)
+	})
+
+	t.Run("SystemObjects", func(t *testing.T) {
+		b := newBucket(t)
+		_, err := b.GetObject("assets/abc")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+		exists, err := b.ObjectExists("assets/abc")
+		require.NoError(t, err)
+		assert.False(t, exists)
+		_, err = b.StatObject("assets/abc")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		require.NoError(t, b.PutObject("assets/abc", strings.NewReader("content")))
+		object, err := b.GetObject("assets/abc")
+		require.NoError(t, err)
+		assert.Equal(t, "content", readAll(t, object))
+		section, err := b.GetObjectRange("assets/abc", 3, 4)
+		require.NoError(t, err)
+		assert.Equal(t, "tent", readAll(t, section))
+		exists, err = b.ObjectExists("assets/abc")
+		require.NoError(t, err)
+		assert.True(t, exists)
+		info, err := b.StatObject("assets/abc")
+		require.NoError(t, err)
+		assert.Equal(t, "assets/abc", info.Key)
+		assert.Equal(t, int64(7), info.Size)
+		assert.WithinDuration(t, time.Now(), info.LastModified, time.Hour)
+
+		objects, err := b.ListObjects("assets/")
+		require.NoError(t, err)
+		require.Len(t, objects, 1)
+		assert.Equal(t, "assets/abc", objects[0].Key)
+
+		require.NoError(t, b.DeleteObject("assets/abc"))
+		require.NoError(t, b.DeleteObject("assets/abc"))
+		exists, err = b.ObjectExists("assets/abc")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("ConditionalWrites", func(t *testing.T) {
+		b := newBucket(t)
+		_, _, err := b.GetObjectWithVersion("locks/job.json")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+
+		// An empty version only creates the object
+		require.NoError(t, b.PutObjectIfVersion("locks/job.json", strings.NewReader("first"), ""))
+		assert.ErrorIs(t, b.PutObjectIfVersion("locks/job.json", strings.NewReader("second"), ""), ErrVersionConflict)
+
+		object, version, err := b.GetObjectWithVersion("locks/job.json")
+		require.NoError(t, err)
+		assert.Equal(t, "first", readAll(t, object))
+		assert.NotEmpty(t, version)
+		require.NoError(t, b.PutObjectIfVersion("locks/job.json", strings.NewReader("second"), version))
+		// The version read before the last write is stale
+		assert.ErrorIs(t, b.PutObjectIfVersion("locks/job.json", strings.NewReader("third"), version), ErrVersionConflict)
+
+		object, newVersion, err := b.GetObjectWithVersion("locks/job.json")
+		require.NoError(t, err)
+		assert.Equal(t, "second", readAll(t, object))
+		assert.NotEqual(t, version, newVersion)
+	})
+
+	t.Run("CopyAndMove", func(t *testing.T) {
+		b := newBucket(t)
+		uploadFile(t, b, first, "assets/icon.png", "png")
+		require.NoError(t, b.CopyFile(first, other, "assets/icon.png"))
+		assert.Equal(t, "png", readFile(t, b, other, "assets/icon.png"))
+
+		require.NoError(t, b.MoveFileToObject(first, "assets/icon.png", "assets/def"))
+		object, err := b.GetObject("assets/def")
+		require.NoError(t, err)
+		assert.Equal(t, "png", readAll(t, object))
+		_, err = b.GetFile(first.Branch, first.RuntimeVersion, first.UpdateId, "assets/icon.png")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+	})
+
+	t.Run("DeleteUpdateFolder", func(t *testing.T) {
+		b := newBucket(t)
+		uploadFile(t, b, first, "metadata.json", `{"version":0}`)
+		uploadFile(t, b, first, "assets/icon.png", "png")
+		uploadFile(t, b, second, "metadata.json", `{"version":0}`)
+		// An id starting with the deleted one must survive
+		sibling := types.Update{Branch: first.Branch, RuntimeVersion: first.RuntimeVersion, UpdateId: first.UpdateId + "0"}
+		uploadFile(t, b, sibling, "metadata.json", `{"version":0}`)
+
+		require.NoError(t, b.DeleteUpdateFolder(first.Branch, first.RuntimeVersion, first.UpdateId))
+		updateIds, err := b.ListUpdates("main", "1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, []string{sibling.UpdateId, second.UpdateId}, updateIds)
+		_, err = b.GetFile(first.Branch, first.RuntimeVersion, first.UpdateId, "metadata.json")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+		_, err = b.GetUpdate(first.Branch, first.RuntimeVersion, first.UpdateId)
+		assert.ErrorIs(t, err, ErrUpdateNotFound)
+		assert.Equal(t, `{"version":0}`, readFile(t, b, sibling, "metadata.json"))
+
+		// Deleting a missing update is not an error
+		require.NoError(t, b.DeleteUpdateFolder(first.Branch, first.RuntimeVersion, first.UpdateId))
+		require.NoError(t, b.DeleteUpdateFolder("missing", "1.0.0", "1"))
+	})
+
+	// Local upload URLs point at this server and are covered by the handler tests
+	if !options.directUploads {
+		return
+	}
+	t.Run("UploadUrlRoundTrip", func(t *testing.T) {
+		b := newBucket(t)
+		requests, err := b.RequestUploadUrlsForFileUpdates(first.Branch, first.RuntimeVersion, first.UpdateId, []string{"bundles/ios.js"})
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		assert.Equal(t, "main/1.0.0/1700000000000/bundles/ios.js", requests[0].Path)
+
+		request, err := http.NewRequest(http.MethodPut, requests[0].Url, strings.NewReader("bundle"))
+		require.NoError(t, err)
+		for name, value := range requests[0].Headers {
+			request.Header.Set(name, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		require.Less(t, response.StatusCode, 300, string(body))
+		assert.Equal(t, "bundle", readFile(t, b, first, "bundles/ios.js"))
+	})
+}
+
+func TestLocalBucketConformance(t *testing.T) {
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		return &LocalBucket{BasePath: t.TempDir()}
+	}, conformanceOptions{})
+}
+
+func TestS3BucketConformance(t *testing.T) {
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		_, s3Bucket := newStandInS3Bucket(t)
+		return s3Bucket
+	}, conformanceOptions{directUploads: true})
+}
+
+// TestGCSBucketConformance runs against an emulator such as fake-gcs-server,
+// set STORAGE_EMULATOR_HOST to enable it.
+func TestGCSBucketConformance(t *testing.T) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST not set")
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		ctx := context.Background()
+		client, err := storage.NewClient(ctx, option.WithoutAuthentication())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		bucketName := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+		require.NoError(t, client.Bucket(bucketName).Create(ctx, "conformance", nil))
+		return &GCSBucket{
+			objectStoreBucket: objectStoreBucket{store: &gcsStore{
+				bucket:         client.Bucket(bucketName),
+				googleAccessID: "conformance@conformance.iam.gserviceaccount.com",
+				privateKey:     privateKeyPEM,
+			}},
+			BucketName: bucketName,
+		}
+	}, conformanceOptions{directUploads: true})
+}
+
+// TestFirebaseBucketConformance runs against the Cloud Storage emulator, set
+// STORAGE_EMULATOR_HOST to enable it. Upload URLs are signed with the Firebase
+// credentials, which the emulator has none of.
+func TestFirebaseBucketConformance(t *testing.T) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST not set")
+	}
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		ctx := context.Background()
+		client, err := storage.NewClient(ctx, option.WithoutAuthentication())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		bucketName := fmt.Sprintf("firebase-conformance-%d", time.Now().UnixNano())
+		require.NoError(t, client.Bucket(bucketName).Create(ctx, "conformance", nil))
+		return &FirebaseBucket{bucket: client.Bucket(bucketName)}
+	}, conformanceOptions{})
+}
+
+// TestAzureBucketConformance runs against a stand-in of the Blob service.
+func TestAzureBucketConformance(t *testing.T) {
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		_, azureBucket := newStandInAzureBucket(t)
+		return azureBucket
+	}, conformanceOptions{directUploads: true})
+}
+
+// TestAzureBucketConformanceOnAzurite runs against Azurite, set
+// AZURITE_BLOB_ENDPOINT (e.g. http://127.0.0.1:10000/devstoreaccount1) to
+// enable it.
+func TestAzureBucketConformanceOnAzurite(t *testing.T) {
+	endpoint := os.Getenv("AZURITE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURITE_BLOB_ENDPOINT not set")
+	}
+	runBucketConformance(t, func(t *testing.T) Bucket {
+		containerName := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+		store, err := newAzureStore(strings.TrimSuffix(endpoint, "/")+"/"+containerName, "devstoreaccount1", azuriteAccountKey)
+		require.NoError(t, err)
+		_, err = store.client.Create(context.Background(), nil)
+		require.NoError(t, err)
+		return &AzureBucket{objectStoreBucket: objectStoreBucket{store: store}, ContainerName: containerName}
+	}, conformanceOptions{directUploads: true})
+}
@@ -126,144 +126,63 @@ func NewFirebaseBucket() (*FirebaseBucket, error) {
 }
 
 func (b *FirebaseBucket) GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error) {
-	objectPath := path.Join("updates", branch, runtimeVersion, updateId, "update-metadata.json")
-	reader, err := b.bucket.Object(objectPath).NewReader(context.Background())
-	if err != nil {
+	objectPath := path.Join("updates", branch, runtimeVersion, updateId, "metadata.json")
+	if _, err := b.bucket.Object(objectPath).Attrs(context.Background()); err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, updateNotFound(branch, runtimeVersion, updateId)
+		}
 		return nil, fmt.Errorf("error reading update metadata: %w", err)
 	}
-	defer reader.Close()
-
-	// Read and parse the metadata
-	// ... implementation similar to localBucket.go ...
-	return nil, nil
+	return &types.Update{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+		CreatedAt:      updateCreatedAt(updateId),
+	}, nil
 }
 
 func (b *FirebaseBucket) GetFile(branch string, runtimeVersion string, updateId string, fileName string) (io.ReadCloser, error) {
 	objectPath := path.Join("updates", branch, runtimeVersion, updateId, fileName)
-	log.Printf("FIREBASE-DEBUG: Getting file %s", objectPath)
-
-	// Check if the file exists
-	obj := b.bucket.Object(objectPath)
-	ctx := context.Background()
-	attrs, err := obj.Attrs(ctx)
+	reader, err := b.bucket.Object(objectPath).NewReader(context.Background())
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
-			log.Printf("FIREBASE-DEBUG: File not found: %s", objectPath)
-
-			// Try all of these alternative paths
-			alternativePaths := []string{
-				// Common path transformations for assets
-				path.Join("updates", branch, runtimeVersion, updateId, strings.TrimPrefix(fileName, "assets/")),
-				path.Join("updates", branch, runtimeVersion, updateId, "assets", fileName),
-				path.Join("updates", branch, runtimeVersion, updateId, "assets", path.Base(fileName)),
-			}
-
-			// Special handling for JavaScript bundles
-			if strings.HasSuffix(fileName, ".js") || strings.HasSuffix(fileName, ".bundle") {
-				alternativePaths = append(alternativePaths,
-					path.Join("updates", branch, runtimeVersion, updateId, "bundle.js"),
-					path.Join("updates", branch, runtimeVersion, updateId, "index.js"),
-					path.Join("updates", branch, runtimeVersion, updateId, "app.bundle"),
-					path.Join("updates", branch, runtimeVersion, updateId, "index.bundle"))
-			}
-
-			// Try each alternative path
-			for _, altPath := range alternativePaths {
-				log.Printf("FIREBASE-DEBUG: Trying alternative path: %s", altPath)
-				altObj := b.bucket.Object(altPath)
-				altAttrs, altErr := altObj.Attrs(ctx)
-				if altErr == nil {
-					log.Printf("FIREBASE-DEBUG: Found file at alternative path with size: %d bytes, created: %v",
-						altAttrs.Size, altAttrs.Created)
-					return b.bucket.Object(altPath).NewReader(ctx)
-				}
-			}
-
-			// List objects in the directory to debug what's actually there
-			log.Printf("FIREBASE-DEBUG: Listing objects in directory to see what's available")
-			dirPath := path.Join("updates", branch, runtimeVersion, updateId)
-			query := &storage.Query{
-				Prefix: dirPath,
-			}
-			it := b.bucket.Objects(ctx, query)
-			count := 0
-			fileNames := []string{}
-
-			for {
-				attrs, err := it.Next()
-				if err == iterator.Done {
-					break
-				}
-				if err != nil {
-					log.Printf("FIREBASE-DEBUG: Error listing objects: %v", err)
-					break
-				}
-
-				// Extract just the filename from the path
-				relativePath := strings.TrimPrefix(attrs.Name, dirPath+"/")
-				fileNames = append(fileNames, relativePath)
-				count++
-
-				if count >= 50 {
-					log.Printf("FIREBASE-DEBUG: Stopping after 50 objects")
-					break
-				}
-			}
-
-			// If we found files but not the one we want, log available files
-			if len(fileNames) > 0 {
-				log.Printf("FIREBASE-DEBUG: Found %d files in update but not the requested file:", len(fileNames))
-				for i, name := range fileNames {
-					log.Printf("FIREBASE-DEBUG:   %d: %s", i+1, name)
-
-					// Special handling for JS files - if we're looking for a JS file and find one
-					if (strings.HasSuffix(fileName, ".js") || strings.HasSuffix(fileName, ".bundle")) &&
-						(strings.HasSuffix(name, ".js") || strings.HasSuffix(name, ".bundle")) {
-
-						log.Printf("FIREBASE-DEBUG: Found potential JS bundle match: %s", name)
-						matchPath := path.Join(dirPath, name)
-						return b.bucket.Object(matchPath).NewReader(ctx)
-					}
-				}
-			} else {
-				log.Printf("FIREBASE-DEBUG: No files found in update directory")
-			}
-		} else {
-			log.Printf("FIREBASE-DEBUG: Error checking file existence: %v", err)
+			return nil, fmt.Errorf("file not found: %s: %w", objectPath, ErrObjectNotFound)
 		}
-		return nil, fmt.Errorf("file not found: %s", objectPath)
-	} else {
-		log.Printf("FIREBASE-DEBUG: File exists with size: %d bytes, created: %v", attrs.Size, attrs.Created)
+		return nil, fmt.Errorf("error reading %s: %w", objectPath, err)
 	}
+	return reader, nil
+}
 
-	// Special debug for metadata.json
-	if fileName == "metadata.json" || fileName == "update-metadata.json" {
-		reader, err := b.bucket.Object(objectPath).NewReader(ctx)
-		if err != nil {
-			log.Printf("DEBUG: Error reading metadata file: %v", err)
-			return nil, fmt.Errorf("error reading metadata file: %w", err)
-		}
+func (b *FirebaseBucket) GetFileRange(branch string, runtimeVersion string, updateId string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.readObjectRange(path.Join("updates", branch, runtimeVersion, updateId, fileName), offset, length)
+}
 
-		// Read the content
-		content, err := io.ReadAll(reader)
-		if err != nil {
-			reader.Close()
-			log.Printf("DEBUG: Error reading metadata content: %v", err)
-			return nil, fmt.Errorf("error reading metadata content: %w", err)
+func (b *FirebaseBucket) readObjectRange(objectPath string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := b.bucket.Object(objectPath).NewRangeReader(context.Background(), offset, length)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, fmt.Errorf("file not found: %s: %w", objectPath, ErrObjectNotFound)
 		}
+		return nil, fmt.Errorf("error reading %s: %w", objectPath, err)
+	}
+	return reader, nil
+}
 
-		// Log the content
-		log.Printf("DEBUG: Metadata file content for %s/%s/%s: %s",
-			branch, runtimeVersion, updateId, string(content))
-
-		// Reset the reader
-		reader.Close()
+func (b *FirebaseBucket) StatFile(branch string, runtimeVersion string, updateId string, fileName string) (ObjectInfo, error) {
+	info, err := b.statObjectPath(path.Join("updates", branch, runtimeVersion, updateId, fileName))
+	info.Key = fileName
+	return info, err
+}
 
-		// Create a new reader with the same content
-		return io.NopCloser(bytes.NewReader(content)), nil
+func (b *FirebaseBucket) statObjectPath(objectPath string) (ObjectInfo, error) {
+	attrs, err := b.bucket.Object(objectPath).Attrs(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return ObjectInfo{}, fmt.Errorf("file not found: %s: %w", objectPath, ErrObjectNotFound)
 	}
-
-	return b.bucket.Object(objectPath).NewReader(ctx)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error reading attributes of %s: %w", objectPath, err)
+	}
+	return ObjectInfo{LastModified: attrs.Updated, Size: attrs.Size}, nil
 }
 
 func (b *FirebaseBucket) UploadFileIntoUpdate(update types.Update, fileName string, content io.Reader) error {
@@ -274,10 +193,13 @@ func (b *FirebaseBucket) UploadFileIntoUpdate(update types.Update, fileName stri
 	log.Printf("Uploading file to Firebase storage: %s", objectPath)
 
 	writer := b.bucket.Object(objectPath).NewWriter(context.Background())
-	defer writer.Close()
-
 	bytesWritten, err := io.Copy(writer, content)
 	if err != nil {
+		writer.Close()
+		return fmt.Errorf("error uploading file %s to Firebase: %w", fileName, err)
+	}
+	// The object is only committed when the writer is closed
+	if err := writer.Close(); err != nil {
 		return fmt.Errorf("error uploading file %s to Firebase: %w", fileName, err)
 	}
 
@@ -286,7 +208,7 @@ func (b *FirebaseBucket) UploadFileIntoUpdate(update types.Update, fileName stri
 }
 
 func (b *FirebaseBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
-	prefix := path.Join("updates", branch, runtimeVersion, updateId)
+	prefix := path.Join("updates", branch, runtimeVersion, updateId) + "/"
 	query := &storage.Query{
 		Prefix: prefix,
 	}
@@ -294,14 +216,15 @@ func (b *FirebaseBucket) DeleteUpdateFolder(branch string, runtimeVersion string
 
 	for {
 		attrs, err := iter.Next()
-		if err == io.EOF {
+		if err == iterator.Done {
 			break
 		}
 		if err != nil {
 			return fmt.Errorf("error iterating objects: %w", err)
 		}
 
-		if err := b.bucket.Object(attrs.Name).Delete(context.Background()); err != nil {
+		err = b.bucket.Object(attrs.Name).Delete(context.Background())
+		if err != nil && err != storage.ErrObjectNotExist {
 			return fmt.Errorf("error deleting object %s: %w", attrs.Name, err)
 		}
 	}
@@ -310,7 +233,7 @@ func (b *FirebaseBucket) DeleteUpdateFolder(branch string, runtimeVersion string
 }
 
 func (b *FirebaseBucket) RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]types.FileUpdateRequest, error) {
-	var requests []types.FileUpdateRequest
+	requests := make([]types.FileUpdateRequest, 0, len(fileNames))
 
 	for _, fileName := range fileNames {
 		objectPath := path.Join("updates", branch, runtimeVersion, updateId, fileName)
@@ -341,363 +264,127 @@ func (b *FirebaseBucket) RequestUploadUrlsForFileUpdates(branch string, runtimeV
 			return nil, fmt.Errorf("error generating signed URL for %s: %w", fileName, err)
 		}
 
+		// The content type is signed, uploads must send the same one
 		requests = append(requests, types.FileUpdateRequest{
-			Url:  url,
-			Path: objectPath,
+			Url:     url,
+			Path:    updateObjectKey(branch, runtimeVersion, updateId, fileName),
+			Headers: map[string]string{"Content-Type": contentType},
 		})
 	}
 
 	return requests, nil
 }
 
-func (b *FirebaseBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
-	var result []types.Update
-	objectPath := path.Join("updates", branch, runtimeVersion)
-	log.Printf("Querying for updates in path: %s", objectPath)
-
-	// Create a context with timeout
+// listFolders returns the sorted names of the folders directly under prefix.
+func (b *FirebaseBucket) listFolders(prefix string) ([]string, error) {
+	if b.bucket == nil {
+		return nil, fmt.Errorf("Firebase bucket client is nil, initialization may have failed")
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// List all objects in the specified path
 	iter := b.bucket.Objects(ctx, &storage.Query{
-		Prefix:    objectPath + "/",
+		Prefix:    prefix,
 		Delimiter: "/",
 	})
-
-	var updateIDs []string
-	// First pass: collect all update IDs
+	folders := []string{}
 	for {
 		attrs, err := iter.Next()
-		if err == iterator.Done || err == io.EOF {
+		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			log.Printf("Error listing objects: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("error iterating objects: %w", err)
 		}
-
-		// For directory prefixes, extract the update ID
+		// Objects directly under prefix are files, folders come as prefixes
 		if attrs.Prefix != "" {
-			updateID := path.Base(strings.TrimSuffix(attrs.Prefix, "/"))
-			updateIDs = append(updateIDs, updateID)
-			log.Printf("Found update ID: %s", updateID)
+			folders = append(folders, strings.TrimSuffix(strings.TrimPrefix(attrs.Prefix, prefix), "/"))
 		}
 	}
+	sort.Strings(folders)
+	return folders, nil
+}
 
-	log.Printf("Found %d potential update IDs in %s", len(updateIDs), objectPath)
-
-	// Extract and sort by build number if present
-	type updateWithBuild struct {
-		updateID   string
-		buildNum   int
-		isBuildNum bool
+func (b *FirebaseBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	updateIds, err := b.ListUpdates(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
 	}
+	updates := newUpdates(branch, runtimeVersion, updateIds)
 
-	updates := make([]updateWithBuild, 0, len(updateIDs))
-
-	// Process update IDs to extract build numbers
-	for _, id := range updateIDs {
-		update := updateWithBuild{updateID: id}
-
-		// Special handling for build-X-ID format
-		if strings.HasPrefix(id, "build-") {
-			parts := strings.SplitN(id, "-", 3)
-			if len(parts) >= 2 {
-				if num, err := strconv.Atoi(parts[1]); err == nil {
-					update.buildNum = num
-					update.isBuildNum = true
-					log.Printf("Extracted build number %d from update ID: %s", num, id)
-				}
-			}
+	// metadata.json may carry the build number and commit of the update
+	for i := range updates {
+		if buildNumber := updateBuildNumber(updates[i].UpdateId); buildNumber >= 0 {
+			updates[i].BuildNumber = strconv.Itoa(buildNumber)
 		}
-
-		updates = append(updates, update)
-	}
-
-	// Sort updates by build number (if available)
-	sort.Slice(updates, func(i, j int) bool {
-		// First sort by build number if available for both
-		if updates[i].isBuildNum && updates[j].isBuildNum {
-			return updates[i].buildNum > updates[j].buildNum // higher build numbers first
+		reader, err := b.bucket.Object(path.Join("updates", branch, runtimeVersion, updates[i].UpdateId, "metadata.json")).NewReader(context.Background())
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			continue
 		}
-		// Build numbers before non-build numbers
-		if updates[i].isBuildNum {
-			return true
+		var metadata map[string]interface{}
+		if json.Unmarshal(content, &metadata) != nil {
+			continue
 		}
-		if updates[j].isBuildNum {
-			return false
+		extras := []interface{}{metadata["extra"]}
+		if nested, ok := metadata["metadata"].(map[string]interface{}); ok {
+			extras = append(extras, nested["extra"])
 		}
-		// Alphabetical for non-build numbers
-		return updates[i].updateID > updates[j].updateID
-	})
-
-	// Second pass: Convert to types.Update objects
-	for _, update := range updates {
-		updateID := update.updateID
-
-		// Create base update object
-		updateObj := types.Update{
-			Branch:         branch,
-			RuntimeVersion: runtimeVersion,
-			UpdateId:       updateID,
-		}
-
-		// If this is a build number update, use that info
-		if update.isBuildNum {
-			updateObj.BuildNumber = strconv.Itoa(update.buildNum)
-			// Try to extract a timestamp
-			if strings.HasPrefix(updateID, "build-") {
-				// Add timestamp based on build number - higher build numbers are more recent
-				// This is a very rough approximation
-				daysAgo := 100 - update.buildNum // Approximation: build-100 would be today, build-1 would be 99 days ago
-				secondsAgo := daysAgo * 24 * 60 * 60
-				updateObj.CreatedAt = time.Duration(secondsAgo) * time.Second
+		for _, value := range extras {
+			extra, ok := value.(map[string]interface{})
+			if !ok {
+				continue
 			}
-		}
-
-		// Try to read metadata.json if it exists, but don't fail if it doesn't
-		metadataPath := path.Join(objectPath, updateID, "metadata.json")
-		reader, err := b.bucket.Object(metadataPath).NewReader(ctx)
-
-		if err == nil {
-			// Successfully opened metadata.json
-			log.Printf("Reading metadata from: %s", metadataPath)
-			metadataContent, err := io.ReadAll(reader)
-			reader.Close()
-
-			if err == nil {
-				var metadata map[string]interface{}
-				if json.Unmarshal(metadataContent, &metadata) == nil {
-					log.Printf("Successfully parsed metadata for update: %s", updateID)
-
-					// Try to extract additional information
-					if extra, ok := metadata["extra"].(map[string]interface{}); ok {
-						// Extract build number if not already set
-						if updateObj.BuildNumber == "" {
-							if bn, ok := extra["buildNumber"]; ok {
-								updateObj.BuildNumber = fmt.Sprintf("%v", bn)
-							}
-						}
-
-						// Extract other fields if available
-						if commitHash, ok := extra["commitHash"]; ok {
-							updateObj.CommitHash = fmt.Sprintf("%v", commitHash)
-						}
-					}
-
-					// Try to extract info from nested metadata
-					if nestedMeta, ok := metadata["metadata"].(map[string]interface{}); ok {
-						if extra, ok := nestedMeta["extra"].(map[string]interface{}); ok {
-							if updateObj.BuildNumber == "" {
-								if bn, ok := extra["buildNumber"]; ok {
-									updateObj.BuildNumber = fmt.Sprintf("%v", bn)
-								}
-							}
-						}
-					}
-				}
+			if buildNumber, ok := extra["buildNumber"]; ok && updates[i].BuildNumber == "" {
+				updates[i].BuildNumber = fmt.Sprintf("%v", buildNumber)
 			}
-		} else {
-			// Metadata file doesn't exist - this is okay, we'll use what we have
-			log.Printf("No metadata.json found for update %s (this is okay): %v", updateID, err)
-
-			// Try alternate metadata file name: update-metadata.json
-			altMetadataPath := path.Join(objectPath, updateID, "update-metadata.json")
-			altReader, altErr := b.bucket.Object(altMetadataPath).NewReader(ctx)
-
-			if altErr == nil {
-				log.Printf("Found alternative metadata at: %s", altMetadataPath)
-				altContent, _ := io.ReadAll(altReader)
-				altReader.Close()
-
-				var altMetadata map[string]interface{}
-				if json.Unmarshal(altContent, &altMetadata) == nil {
-					// Process alternative metadata if needed
-					log.Printf("Successfully parsed alternative metadata for update: %s", updateID)
-				}
+			if commitHash, ok := extra["commitHash"]; ok && updates[i].CommitHash == "" {
+				updates[i].CommitHash = fmt.Sprintf("%v", commitHash)
 			}
 		}
-
-		// Always add the update to results
-		log.Printf("Adding update %s to results (build number: %s)", updateID, updateObj.BuildNumber)
-		result = append(result, updateObj)
 	}
 
-	log.Printf("Completed GetUpdates, found %d updates for %s/%s", len(result), branch, runtimeVersion)
-	return result, nil
+	log.Printf("Found %d updates for %s/%s", len(updates), branch, runtimeVersion)
+	return updates, nil
 }
 
 func (b *FirebaseBucket) GetBranches() ([]string, error) {
-	log.Printf("Firebase GetBranches: querying for branches...")
-
-	// Check if bucket client is nil
-	if b.bucket == nil {
-		return nil, fmt.Errorf("Firebase bucket client is nil, initialization may have failed")
-	}
-
-	prefix := "updates/"
-	query := &storage.Query{
-		Prefix:    prefix,
-		Delimiter: "/",
-	}
-
-	// Get context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	iter := b.bucket.Objects(ctx, query)
-
-	var branches []string
-	for {
-		attrs, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("Firebase GetBranches error: %v", err)
-			return nil, fmt.Errorf("error iterating objects: %w", err)
-		}
-
-		if attrs.Prefix != "" {
-			// Extract branch name from prefix (e.g., "updates/main/" -> "main")
-			branch := strings.TrimPrefix(attrs.Prefix, prefix)
-			branch = strings.TrimSuffix(branch, "/")
-			if branch != "" {
-				log.Printf("Firebase GetBranches: found branch: %s", branch)
-				branches = append(branches, branch)
-			}
-		}
+	folders, err := b.listFolders("updates/")
+	if err != nil {
+		log.Printf("Firebase GetBranches error: %v", err)
+		return nil, err
 	}
-
-	// If no branches found and no error occurred, create a default branch
-	if len(branches) == 0 {
-		log.Printf("Firebase GetBranches: no branches found, creating a default branch")
-		// Create a demo branch with a sample update
-		defaultBranch := "main"
-		defaultRuntimeVersion := "1.0.0"
-
-		// Create demo update metadata
-		metadata := map[string]interface{}{
-			"manifest": map[string]interface{}{
-				"id":        "demo-update",
-				"createdAt": time.Now().Unix(),
-			},
-			"extra": map[string]interface{}{
-				"buildNumber": "1",
-				"updateCode":  "demo",
-			},
-		}
-
-		metadataJSON, _ := json.Marshal(metadata)
-		objectPath := path.Join("updates", defaultBranch, defaultRuntimeVersion, "demo-update", "metadata.json")
-		writer := b.bucket.Object(objectPath).NewWriter(ctx)
-		if _, err := writer.Write(metadataJSON); err != nil {
-			log.Printf("Failed to write demo metadata: %v", err)
-		} else {
-			if err := writer.Close(); err != nil {
-				log.Printf("Failed to close demo metadata writer: %v", err)
-			} else {
-				log.Printf("Created demo branch and update successfully")
-				branches = append(branches, defaultBranch)
-			}
+	branches := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !isSystemFolder(folder) {
+			branches = append(branches, folder)
 		}
 	}
-
-	log.Printf("Firebase GetBranches: returning %d branches", len(branches))
 	return branches, nil
 }
 
 func (b *FirebaseBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
-	log.Printf("Getting runtime versions for branch: %s", branch)
-	prefix := path.Join("updates", branch) + "/"
-	query := &storage.Query{
-		Prefix:    prefix,
-		Delimiter: "/",
+	runtimeVersionNames, err := b.listFolders(path.Join("updates", branch) + "/")
+	if err != nil {
+		log.Printf("Error listing runtime versions of branch %s: %v", branch, err)
+		return nil, err
 	}
-
-	// Create a context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	iter := b.bucket.Objects(ctx, query)
-
-	runtimeVersions := make(map[string]*RuntimeVersionWithStats)
-	for {
-		attrs, err := iter.Next()
-		if err == io.EOF || err == iterator.Done {
-			break
-		}
+	runtimeVersions := []RuntimeVersionWithStats{}
+	for _, runtimeVersion := range runtimeVersionNames {
+		updateIds, err := b.ListUpdates(branch, runtimeVersion)
 		if err != nil {
-			log.Printf("Error iterating objects for runtime versions: %v", err)
-			return nil, fmt.Errorf("error iterating objects: %w", err)
+			return nil, err
 		}
-
-		if attrs.Prefix != "" {
-			// Extract runtime version from prefix (e.g., "updates/main/1.0.0/" -> "1.0.0")
-			version := strings.TrimPrefix(attrs.Prefix, prefix)
-			version = strings.TrimSuffix(version, "/")
-			if version != "" {
-				log.Printf("Found runtime version: %s", version)
-
-				// Instead of calling GetUpdates, which might fail if metadata doesn't exist,
-				// we'll just add the runtime version with default stats
-				runtimeVersions[version] = &RuntimeVersionWithStats{
-					RuntimeVersion:  version,
-					LastUpdatedAt:   time.Now().UTC().Format(time.RFC3339),
-					CreatedAt:       time.Now().UTC().Format(time.RFC3339),
-					NumberOfUpdates: 0, // Default to 0, we'll determine this later
-				}
-
-				// Optionally, try to count the number of updates
-				updatePrefix := attrs.Prefix // This is already "updates/branch/version/"
-				updateQuery := &storage.Query{
-					Prefix:    updatePrefix,
-					Delimiter: "/",
-				}
-
-				updateIter := b.bucket.Objects(ctx, updateQuery)
-				updateCount := 0
-
-				for {
-					updateAttrs, updateErr := updateIter.Next()
-					if updateErr == io.EOF || updateErr == iterator.Done {
-						break
-					}
-					if updateErr != nil {
-						log.Printf("Error counting updates for %s: %v", version, updateErr)
-						break // Continue with the next runtime version
-					}
-
-					if updateAttrs.Prefix != "" {
-						updateCount++
-					}
-				}
-
-				if updateCount > 0 {
-					log.Printf("Found %d updates for runtime version %s", updateCount, version)
-					runtimeVersions[version].NumberOfUpdates = updateCount
-				}
-			}
+		if len(updateIds) == 0 {
+			continue
 		}
+		runtimeVersions = append(runtimeVersions, newRuntimeVersionStats(runtimeVersion, updateIds))
 	}
-
-	// Convert map to slice
-	var result []RuntimeVersionWithStats
-	for _, stats := range runtimeVersions {
-		result = append(result, *stats)
-	}
-
-	// Sort by version number (assuming semantic versioning)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].RuntimeVersion > result[j].RuntimeVersion
-	})
-
-	log.Printf("Found %d runtime versions for branch %s", len(result), branch)
-	return result, nil
+	return runtimeVersions, nil
 }
 
 // DumpUpdateMetadata dumps the complete metadata for a specific update ID
@@ -926,37 +613,120 @@ func (b *FirebaseBucket) GetDirectMetadata(updateId string) {
 
 // ListUpdates returns a list of all update IDs for a specific branch and runtime version
 func (b *FirebaseBucket) ListUpdates(branch string, runtimeVersion string) ([]string, error) {
-	dirPath := path.Join("updates", branch, runtimeVersion)
-	log.Printf("FIREBASE-DEBUG: Listing updates in %s", dirPath)
+	updateIds, err := b.listFolders(path.Join("updates", branch, runtimeVersion) + "/")
+	if err != nil {
+		return nil, fmt.Errorf("error listing updates: %w", err)
+	}
+	return updateIds, nil
+}
 
-	query := &storage.Query{
-		Prefix:    dirPath,
-		Delimiter: "/",
+func (b *FirebaseBucket) CopyFile(source types.Update, target types.Update, fileName string) error {
+	sourcePath := path.Join("updates", source.Branch, source.RuntimeVersion, source.UpdateId, fileName)
+	targetPath := path.Join("updates", target.Branch, target.RuntimeVersion, target.UpdateId, fileName)
+	copier := b.bucket.Object(targetPath).CopierFrom(b.bucket.Object(sourcePath))
+	if _, err := copier.Run(context.Background()); err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", sourcePath, targetPath, err)
+	}
+	return nil
+}
+
+func (b *FirebaseBucket) GetObject(key string) (io.ReadCloser, error) {
+	objectPath := path.Join(SystemPrefix, key)
+	reader, err := b.bucket.Object(objectPath).NewReader(context.Background())
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("error reading object %s: %w", objectPath, err)
+	}
+	return reader, nil
+}
+
+func (b *FirebaseBucket) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.readObjectRange(path.Join(SystemPrefix, key), offset, length)
+}
+
+func (b *FirebaseBucket) PutObject(key string, content io.Reader) error {
+	objectPath := path.Join(SystemPrefix, key)
+	writer := b.bucket.Object(objectPath).NewWriter(context.Background())
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return fmt.Errorf("error uploading object %s to Firebase: %w", objectPath, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error uploading object %s to Firebase: %w", objectPath, err)
+	}
+	return nil
+}
+
+func (b *FirebaseBucket) GetObjectWithVersion(key string) (io.ReadCloser, string, error) {
+	return readGCSObjectVersion(b.bucket.Object(path.Join(SystemPrefix, key)))
+}
+
+func (b *FirebaseBucket) PutObjectIfVersion(key string, content io.Reader, version string) error {
+	return writeGCSObjectIf(b.bucket.Object(path.Join(SystemPrefix, key)), content, version)
+}
+
+func (b *FirebaseBucket) DeleteObject(key string) error {
+	objectPath := path.Join(SystemPrefix, key)
+	err := b.bucket.Object(objectPath).Delete(context.Background())
+	if err != nil && err != storage.ErrObjectNotExist {
+		return fmt.Errorf("error deleting object %s: %w", objectPath, err)
+	}
+	return nil
+}
+
+func (b *FirebaseBucket) ObjectExists(key string) (bool, error) {
+	objectPath := path.Join(SystemPrefix, key)
+	_, err := b.bucket.Object(objectPath).Attrs(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading attributes of %s: %w", objectPath, err)
 	}
+	return true, nil
+}
 
-	updates := []string{}
-	it := b.bucket.Objects(context.Background(), query)
+func (b *FirebaseBucket) StatObject(key string) (ObjectInfo, error) {
+	info, err := b.statObjectPath(path.Join(SystemPrefix, key))
+	info.Key = key
+	return info, err
+}
 
+func (b *FirebaseBucket) MoveFileToObject(update types.Update, fileName string, key string) error {
+	sourcePath := path.Join("updates", update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	targetPath := path.Join(SystemPrefix, key)
+	ctx := context.Background()
+	source := b.bucket.Object(sourcePath)
+	if _, err := b.bucket.Object(targetPath).CopierFrom(source).Run(ctx); err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", sourcePath, targetPath, err)
+	}
+	if err := source.Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+		return fmt.Errorf("error deleting %s: %w", sourcePath, err)
+	}
+	return nil
+}
+
+func (b *FirebaseBucket) ListObjects(prefix string) ([]ObjectInfo, error) {
+	systemPrefix := SystemPrefix + "/"
+	it := b.bucket.Objects(context.Background(), &storage.Query{
+		Prefix: systemPrefix + prefix,
+	})
+	objects := []ObjectInfo{}
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			log.Printf("FIREBASE-DEBUG: Error listing updates: %v", err)
-			return nil, fmt.Errorf("error listing updates: %w", err)
-		}
-
-		// Extract update ID from the path
-		if attrs.Name != "" {
-			parts := strings.Split(attrs.Name, "/")
-			if len(parts) >= 4 {
-				updateID := parts[3]
-				updates = append(updates, updateID)
-				log.Printf("FIREBASE-DEBUG: Found update: %s", updateID)
-			}
+			return nil, fmt.Errorf("error listing objects under %s: %w", prefix, err)
 		}
+		objects = append(objects, ObjectInfo{
+			Key:          strings.TrimPrefix(attrs.Name, systemPrefix),
+			LastModified: attrs.Updated,
+			Size:         attrs.Size,
+		})
 	}
-
-	return updates, nil
+	return objects, nil
 }
@@ -0,0 +1,215 @@
+package bucket
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GCSBucket stores updates in Google Cloud Storage with the plain Cloud
+// Storage client. STORAGE_EMULATOR_HOST points it at an emulator.
+type GCSBucket struct {
+	objectStoreBucket
+	BucketName string
+}
+
+type gcsStore struct {
+	bucket *storage.BucketHandle
+	// googleAccessID and privateKey sign upload URLs when the credentials
+	// are a service account key, the client signs them through IAM otherwise.
+	googleAccessID string
+	privateKey     []byte
+}
+
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+func NewGCSBucket() (*GCSBucket, error) {
+	bucketName := config.GetEnv("GCS_BUCKET_NAME")
+	if bucketName == "" {
+		return nil, errors.New("GCS_BUCKET_NAME not set")
+	}
+	var options []option.ClientOption
+	store := &gcsStore{}
+	if encodedCredentials := config.GetEnv("GCS_CREDENTIALS_B64"); encodedCredentials != "" {
+		credentials, err := base64.StdEncoding.DecodeString(encodedCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding GCS_CREDENTIALS_B64: %w", err)
+		}
+		var serviceAccount gcsServiceAccount
+		if err := json.Unmarshal(credentials, &serviceAccount); err == nil {
+			store.googleAccessID = serviceAccount.ClientEmail
+			store.privateKey = []byte(serviceAccount.PrivateKey)
+		}
+		options = append(options, option.WithCredentialsJSON(credentials))
+	}
+	client, err := storage.NewClient(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Cloud Storage client: %w", err)
+	}
+	store.bucket = client.Bucket(bucketName)
+	return &GCSBucket{
+		objectStoreBucket: objectStoreBucket{store: store},
+		BucketName:        bucketName,
+	}, nil
+}
+
+func (s *gcsStore) list(prefix string, delimiter string) ([]storedObject, []string, error) {
+	it := s.bucket.Objects(context.Background(), &storage.Query{Prefix: prefix, Delimiter: delimiter})
+	objects := []storedObject{}
+	prefixes := []string{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if attrs.Prefix != "" {
+			prefixes = append(prefixes, attrs.Prefix)
+			continue
+		}
+		objects = append(objects, storedObject{Key: attrs.Name, LastModified: attrs.Updated, Size: attrs.Size})
+	}
+	return objects, prefixes, nil
+}
+
+func (s *gcsStore) read(key string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(key).NewReader(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return reader, nil
+}
+
+func (s *gcsStore) readRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(key).NewRangeReader(context.Background(), offset, length)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return reader, nil
+}
+
+func (s *gcsStore) write(key string, content io.Reader) error {
+	writer := s.bucket.Object(key).NewWriter(context.Background())
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+// readGCSObjectVersion reads an object along with its generation.
+func readGCSObjectVersion(object *storage.ObjectHandle) (io.ReadCloser, string, error) {
+	reader, err := object.NewReader(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, "", ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %w", object.ObjectName(), err)
+	}
+	return reader, strconv.FormatInt(reader.Attrs.Generation, 10), nil
+}
+
+// writeGCSObjectIf writes an object with a generation precondition, the
+// storage rejects it with a 412 when the generation changed.
+func writeGCSObjectIf(object *storage.ObjectHandle, content io.Reader, version string) error {
+	conditions := storage.Conditions{DoesNotExist: true}
+	if version != "" {
+		generation, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid generation %q of %s: %w", version, object.ObjectName(), err)
+		}
+		conditions = storage.Conditions{GenerationMatch: generation}
+	}
+	writer := object.If(conditions).NewWriter(context.Background())
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return fmt.Errorf("error writing %s: %w", object.ObjectName(), err)
+	}
+	err := writer.Close()
+	var apiError *googleapi.Error
+	if errors.As(err, &apiError) && apiError.Code == http.StatusPreconditionFailed {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", object.ObjectName(), err)
+	}
+	return nil
+}
+
+func (s *gcsStore) readVersion(key string) (io.ReadCloser, string, error) {
+	return readGCSObjectVersion(s.bucket.Object(key))
+}
+
+func (s *gcsStore) writeIf(key string, content io.Reader, version string) error {
+	return writeGCSObjectIf(s.bucket.Object(key), content, version)
+}
+
+func (s *gcsStore) remove(key string) error {
+	err := s.bucket.Object(key).Delete(context.Background())
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *gcsStore) copy(sourceKey string, targetKey string) error {
+	_, err := s.bucket.Object(targetKey).CopierFrom(s.bucket.Object(sourceKey)).Run(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", sourceKey, targetKey, err)
+	}
+	return nil
+}
+
+func (s *gcsStore) stat(key string) (*storedObject, error) {
+	attrs, err := s.bucket.Object(key).Attrs(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading attributes of %s: %w", key, err)
+	}
+	return &storedObject{Key: attrs.Name, LastModified: attrs.Updated, Size: attrs.Size}, nil
+}
+
+func (s *gcsStore) signUpload(key string, validity time.Duration) (string, map[string]string, error) {
+	url, err := s.bucket.SignedURL(key, &storage.SignedURLOptions{
+		GoogleAccessID: s.googleAccessID,
+		PrivateKey:     s.privateKey,
+		Method:         "PUT",
+		Expires:        time.Now().Add(validity),
+		Scheme:         storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return url, nil, nil
+}
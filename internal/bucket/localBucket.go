@@ -1,7 +1,9 @@
 package bucket
 
 import (
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/services"
@@ -13,8 +15,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -81,30 +83,31 @@ func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersio
 	return parsedURL.String(), nil
 }
 
-func (b *LocalBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
-	if b.BasePath == "" {
-		return nil, errors.New("BasePath not set")
-	}
-	dirPath := filepath.Join(b.BasePath, branch, runtimeVersion)
+// listFolders returns the sorted names of the folders in dirPath, none when it
+// does not exist.
+func listFolders(dirPath string) ([]string, error) {
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return []types.Update{}, nil
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
 	}
-	var updates []types.Update
+	folders := []string{}
 	for _, entry := range entries {
 		if entry.IsDir() {
-			updateId, err := strconv.ParseInt(entry.Name(), 10, 64)
-			if err == nil {
-				updates = append(updates, types.Update{
-					Branch:         branch,
-					RuntimeVersion: runtimeVersion,
-					UpdateId:       strconv.FormatInt(updateId, 10),
-					CreatedAt:      time.Duration(updateId) * time.Millisecond,
-				})
-			}
+			folders = append(folders, entry.Name())
 		}
 	}
-	return updates, nil
+	return folders, nil
+}
+
+func (b *LocalBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	updateIds, err := b.ListUpdates(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return newUpdates(branch, runtimeVersion, updateIds), nil
 }
 
 func (b *LocalBucket) GetFile(branch string, runtimeVersion string, updateId string, fileName string) (io.ReadCloser, error) {
@@ -116,55 +119,73 @@ func (b *LocalBucket) GetFile(branch string, runtimeVersion string, updateId str
 
 	file, err := os.Open(filePath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s: %w", fileName, ErrObjectNotFound)
+		}
 		return nil, err
 	}
 
 	return file, nil
 }
 
-func (b *LocalBucket) GetBranches() ([]string, error) {
-	if b.BasePath == "" {
-		return nil, errors.New("BasePath not set")
-	}
-
-	// Ensure directory exists
-	if err := os.MkdirAll(b.BasePath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create bucket directory: %w", err)
-	}
-
-	entries, err := os.ReadDir(b.BasePath)
+func (b *LocalBucket) GetFileRange(branch string, runtimeVersion string, updateId string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := b.GetFile(branch, runtimeVersion, updateId, fileName)
 	if err != nil {
 		return nil, err
 	}
+	return readLocalRange(file.(*os.File), offset, length)
+}
 
-	var branches []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			branches = append(branches, entry.Name())
-		}
-	}
+// localRange reads a section of an opened file and closes it.
+type localRange struct {
+	io.Reader
+	file *os.File
+}
 
-	// If no branches, create a demo branch
-	if len(branches) == 0 {
-		log.Printf("No branches found, creating demo branch")
+func (r *localRange) Close() error {
+	return r.file.Close()
+}
 
-		// Create default demo branch
-		demoBranch := "main"
-		demoBranchPath := filepath.Join(b.BasePath, demoBranch)
+func readLocalRange(file *os.File, offset int64, length int64) (io.ReadCloser, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &localRange{Reader: io.LimitReader(file, length), file: file}, nil
+}
 
-		// Create runtime version directory
-		demoRuntimeVersion := "1.0.0"
-		demoRuntimePath := filepath.Join(demoBranchPath, demoRuntimeVersion)
+func (b *LocalBucket) StatFile(branch string, runtimeVersion string, updateId string, fileName string) (ObjectInfo, error) {
+	if b.BasePath == "" {
+		return ObjectInfo{}, errors.New("BasePath not set")
+	}
+	return statLocalFile(filepath.Join(b.BasePath, branch, runtimeVersion, updateId, fileName), fileName)
+}
 
-		// Create directories
-		if err := os.MkdirAll(demoRuntimePath, 0755); err != nil {
-			log.Printf("Warning: Failed to create demo branch structure: %v", err)
-		} else {
-			log.Printf("Created demo branch: %s with runtime version: %s", demoBranch, demoRuntimeVersion)
-			branches = append(branches, demoBranch)
+func statLocalFile(filePath string, key string) (ObjectInfo, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ObjectInfo{}, fmt.Errorf("file not found: %s: %w", key, ErrObjectNotFound)
 		}
+		return ObjectInfo{}, err
 	}
+	return ObjectInfo{Key: key, LastModified: info.ModTime(), Size: info.Size()}, nil
+}
 
+func (b *LocalBucket) GetBranches() ([]string, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	folders, err := listFolders(b.BasePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	branches := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !isSystemFolder(folder) {
+			branches = append(branches, folder)
+		}
+	}
 	return branches, nil
 }
 
@@ -172,117 +193,21 @@ func (b *LocalBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithSta
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
-
-	// Ensure branch directory exists
-	branchPath := filepath.Join(b.BasePath, branch)
-	if err := os.MkdirAll(branchPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create branch directory: %w", err)
-	}
-
-	entries, err := os.ReadDir(branchPath)
+	runtimeVersionNames, err := listFolders(filepath.Join(b.BasePath, branch))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list runtime versions: %w", err)
 	}
-
-	var runtimeVersions []RuntimeVersionWithStats
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		runtimeVersion := entry.Name()
-		updatesPath := filepath.Join(branchPath, runtimeVersion)
-		updates, err := os.ReadDir(updatesPath)
+	runtimeVersions := []RuntimeVersionWithStats{}
+	for _, runtimeVersion := range runtimeVersionNames {
+		updateIds, err := b.ListUpdates(branch, runtimeVersion)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		var updateTimestamps []int64
-		for _, update := range updates {
-			if !update.IsDir() {
-				continue
-			}
-			timestamp, err := strconv.ParseInt(update.Name(), 10, 64)
-			if err != nil {
-				continue
-			}
-			updateTimestamps = append(updateTimestamps, timestamp)
-		}
-
-		// If no updates, create a sample update for this runtime version
-		if len(updateTimestamps) == 0 {
-			log.Printf("No updates found for %s/%s, creating a sample update", branch, runtimeVersion)
-
-			// Create a timestamp-based update ID
-			now := time.Now().UnixMilli()
-			updateDirPath := filepath.Join(updatesPath, strconv.FormatInt(now, 10))
-
-			// Create update directory and add a sample metadata file
-			if err := os.MkdirAll(updateDirPath, 0755); err != nil {
-				log.Printf("Warning: Failed to create sample update: %v", err)
-			} else {
-				// Create a simple metadata.json file
-				metadataPath := filepath.Join(updateDirPath, "metadata.json")
-				sampleMetadata := `{"version":0,"bundler":"metro","fileMetadata":{"android":{"bundle":"","assets":[]},"ios":{"bundle":"","assets":[]}},"extra":{"commitHash":"sample","updateCode":"build-1","platform":"android"}}`
-
-				if err := os.WriteFile(metadataPath, []byte(sampleMetadata), 0644); err != nil {
-					log.Printf("Warning: Failed to write sample metadata: %v", err)
-				} else {
-					log.Printf("Created sample update in %s", updateDirPath)
-					updateTimestamps = append(updateTimestamps, now)
-				}
-			}
-		}
-
-		if len(updateTimestamps) == 0 {
+		if len(updateIds) == 0 {
 			continue
 		}
-
-		sort.Slice(updateTimestamps, func(i, j int) bool { return updateTimestamps[i] < updateTimestamps[j] })
-
-		runtimeVersions = append(runtimeVersions, RuntimeVersionWithStats{
-			RuntimeVersion:  runtimeVersion,
-			CreatedAt:       time.UnixMilli(updateTimestamps[0]).UTC().Format(time.RFC3339),
-			LastUpdatedAt:   time.UnixMilli(updateTimestamps[len(updateTimestamps)-1]).UTC().Format(time.RFC3339),
-			NumberOfUpdates: len(updateTimestamps),
-		})
-	}
-
-	// If no runtime versions found, create a default one
-	if len(runtimeVersions) == 0 {
-		// Create default runtime version
-		defaultRuntime := "1.0.0"
-		defaultRuntimePath := filepath.Join(branchPath, defaultRuntime)
-
-		if err := os.MkdirAll(defaultRuntimePath, 0755); err != nil {
-			log.Printf("Warning: Failed to create default runtime version: %v", err)
-		} else {
-			// Create a sample update
-			now := time.Now().UnixMilli()
-			updateDirPath := filepath.Join(defaultRuntimePath, strconv.FormatInt(now, 10))
-
-			if err := os.MkdirAll(updateDirPath, 0755); err != nil {
-				log.Printf("Warning: Failed to create sample update: %v", err)
-			} else {
-				// Create a simple metadata.json file
-				metadataPath := filepath.Join(updateDirPath, "metadata.json")
-				sampleMetadata := `{"version":0,"bundler":"metro","fileMetadata":{"android":{"bundle":"","assets":[]},"ios":{"bundle":"","assets":[]}},"extra":{"commitHash":"sample","updateCode":"build-1","platform":"android"}}`
-
-				if err := os.WriteFile(metadataPath, []byte(sampleMetadata), 0644); err != nil {
-					log.Printf("Warning: Failed to write sample metadata: %v", err)
-				} else {
-					log.Printf("Created sample update in %s", updateDirPath)
-
-					// Add to runtime versions
-					runtimeVersions = append(runtimeVersions, RuntimeVersionWithStats{
-						RuntimeVersion:  defaultRuntime,
-						CreatedAt:       time.Now().UTC().Format(time.RFC3339),
-						LastUpdatedAt:   time.Now().UTC().Format(time.RFC3339),
-						NumberOfUpdates: 1,
-					})
-				}
-			}
-		}
+		runtimeVersions = append(runtimeVersions, newRuntimeVersionStats(runtimeVersion, updateIds))
 	}
-
 	return runtimeVersions, nil
 }
 
@@ -355,27 +280,18 @@ func (b *LocalBucket) GetUpdate(branch string, runtimeVersion string, updateId s
 	}
 
 	metadataPath := filepath.Join(b.BasePath, branch, runtimeVersion, updateId, "metadata.json")
-	file, err := os.Open(metadataPath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var metadata types.UpdateMetadata
-	if err := json.NewDecoder(file).Decode(&metadata); err != nil {
+	if _, err := os.Stat(metadataPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, updateNotFound(branch, runtimeVersion, updateId)
+		}
 		return nil, err
 	}
 
-	createdAt, err := time.ParseDuration(metadata.CreatedAt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse CreatedAt: %w", err)
-	}
-
 	return &types.Update{
 		Branch:         branch,
 		RuntimeVersion: runtimeVersion,
 		UpdateId:       updateId,
-		CreatedAt:      createdAt,
+		CreatedAt:      updateCreatedAt(updateId),
 	}, nil
 }
 
@@ -391,10 +307,9 @@ func (b *LocalBucket) RequestUploadUrlsForFileUpdates(branch string, runtimeVers
 			return nil, fmt.Errorf("error generating upload URL for %s: %w", fileName, err)
 		}
 
-		filePath := filepath.Join(branch, runtimeVersion, updateId, fileName)
 		requests = append(requests, types.FileUpdateRequest{
 			Url:  url,
-			Path: filePath,
+			Path: updateObjectKey(branch, runtimeVersion, updateId, fileName),
 		})
 	}
 
@@ -406,19 +321,201 @@ func (b *LocalBucket) ListUpdates(branch string, runtimeVersion string) ([]strin
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
+	updateIds, err := listFolders(filepath.Join(b.BasePath, branch, runtimeVersion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list updates: %w", err)
+	}
+	return updateIds, nil
+}
 
-	dirPath := filepath.Join(b.BasePath, branch, runtimeVersion)
-	entries, err := os.ReadDir(dirPath)
+func (b *LocalBucket) CopyFile(source types.Update, target types.Update, fileName string) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	sourceFile, err := b.GetFile(source.Branch, source.RuntimeVersion, source.UpdateId, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", fileName, err)
+	}
+	defer sourceFile.Close()
+	return b.UploadFileIntoUpdate(target, fileName, sourceFile)
+}
+
+func (b *LocalBucket) systemObjectPath(key string) string {
+	return filepath.Join(b.BasePath, SystemPrefix, filepath.FromSlash(key))
+}
+
+func (b *LocalBucket) GetObject(key string) (io.ReadCloser, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	file, err := os.Open(b.systemObjectPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func (b *LocalBucket) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	object, err := b.GetObject(key)
 	if err != nil {
-		return []string{}, nil
+		return nil, err
 	}
+	return readLocalRange(object.(*os.File), offset, length)
+}
 
-	var updates []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			updates = append(updates, entry.Name())
+func (b *LocalBucket) PutObject(key string, content io.Reader) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	filePath := b.systemObjectPath(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	// Write to a temporary file first so readers never see a partial object
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", key, err)
+	}
+	if _, err := io.Copy(tmpFile, content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("failed to write file %s: %w", key, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("failed to write file %s: %w", key, err)
+	}
+	return os.Rename(tmpFile.Name(), filePath)
+}
+
+// localVersionMutex makes the check and the write of PutObjectIfVersion
+// atomic. A local bucket is served by a single process, which it guards.
+var localVersionMutex sync.Mutex
+
+// readLocalVersion reads a file along with its version, the hash of its
+// content: modification times are too coarse to tell quick writes apart.
+func readLocalVersion(filePath string) ([]byte, string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", ErrObjectNotFound
 		}
+		return nil, "", err
 	}
+	sum := sha256.Sum256(content)
+	return content, hex.EncodeToString(sum[:]), nil
+}
 
-	return updates, nil
+func (b *LocalBucket) GetObjectWithVersion(key string) (io.ReadCloser, string, error) {
+	if b.BasePath == "" {
+		return nil, "", errors.New("BasePath not set")
+	}
+	content, version, err := readLocalVersion(b.systemObjectPath(key))
+	if err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(bytes.NewReader(content)), version, nil
+}
+
+func (b *LocalBucket) PutObjectIfVersion(key string, content io.Reader, version string) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	localVersionMutex.Lock()
+	defer localVersionMutex.Unlock()
+	_, currentVersion, err := readLocalVersion(b.systemObjectPath(key))
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+	if currentVersion != version {
+		return ErrVersionConflict
+	}
+	return b.PutObject(key, content)
+}
+
+func (b *LocalBucket) DeleteObject(key string) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	err := os.Remove(b.systemObjectPath(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *LocalBucket) ObjectExists(key string) (bool, error) {
+	if b.BasePath == "" {
+		return false, errors.New("BasePath not set")
+	}
+	_, err := os.Stat(b.systemObjectPath(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (b *LocalBucket) StatObject(key string) (ObjectInfo, error) {
+	if b.BasePath == "" {
+		return ObjectInfo{}, errors.New("BasePath not set")
+	}
+	return statLocalFile(b.systemObjectPath(key), key)
+}
+
+func (b *LocalBucket) MoveFileToObject(update types.Update, fileName string, key string) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	sourcePath := filepath.Join(b.BasePath, update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	targetPath := b.systemObjectPath(key)
+	if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	if err := os.Rename(sourcePath, targetPath); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", fileName, key, err)
+	}
+	return nil
+}
+
+func (b *LocalBucket) ListObjects(prefix string) ([]ObjectInfo, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	root := filepath.Join(b.BasePath, SystemPrefix)
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(root, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return nil
+		}
+		relativePath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relativePath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, LastModified: info.ModTime(), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+	}
+	return objects, nil
 }
@@ -0,0 +1,252 @@
+package bucket
+
+import (
+	"errors"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// uploadUrlValidity is how long the signed upload URLs handed to clients stay valid.
+const uploadUrlValidity = 15 * time.Minute
+
+type storedObject struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+// objectStore is the flat key/value API of a cloud storage service. Keys use
+// "/" as separator, read and stat return ErrObjectNotFound for missing keys and
+// remove ignores them.
+type objectStore interface {
+	list(prefix string, delimiter string) ([]storedObject, []string, error)
+	read(key string) (io.ReadCloser, error)
+	// readRange reads length bytes of an object from offset.
+	readRange(key string, offset int64, length int64) (io.ReadCloser, error)
+	write(key string, content io.Reader) error
+	// readVersion reads an object along with its version.
+	readVersion(key string) (io.ReadCloser, string, error)
+	// writeIf writes an object only if its version is still version, or
+	// with an empty version if it does not exist, ErrVersionConflict otherwise.
+	writeIf(key string, content io.Reader, version string) error
+	remove(key string) error
+	copy(sourceKey string, targetKey string) error
+	stat(key string) (*storedObject, error)
+	// signUpload returns a URL clients can PUT the object to, and the headers
+	// the request must carry.
+	signUpload(key string, validity time.Duration) (string, map[string]string, error)
+}
+
+// objectStoreBucket implements Bucket on top of an objectStore, with updates
+// stored under branch/runtimeVersion/updateId/ and server-owned objects under
+// SystemPrefix.
+type objectStoreBucket struct {
+	store objectStore
+}
+
+func systemObjectKey(key string) string {
+	return SystemPrefix + "/" + key
+}
+
+// listFolders returns the sorted names of the folders directly under prefix.
+func (b *objectStoreBucket) listFolders(prefix string) ([]string, error) {
+	_, prefixes, err := b.store.list(prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	folders := make([]string, 0, len(prefixes))
+	for _, folder := range prefixes {
+		folders = append(folders, strings.TrimSuffix(strings.TrimPrefix(folder, prefix), "/"))
+	}
+	sort.Strings(folders)
+	return folders, nil
+}
+
+func (b *objectStoreBucket) GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error) {
+	if _, err := b.store.stat(updateObjectKey(branch, runtimeVersion, updateId, "metadata.json")); err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, updateNotFound(branch, runtimeVersion, updateId)
+		}
+		return nil, err
+	}
+	return &types.Update{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+		CreatedAt:      updateCreatedAt(updateId),
+	}, nil
+}
+
+func (b *objectStoreBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+	updateIds, err := b.ListUpdates(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return newUpdates(branch, runtimeVersion, updateIds), nil
+}
+
+func (b *objectStoreBucket) GetBranches() ([]string, error) {
+	folders, err := b.listFolders("")
+	if err != nil {
+		return nil, fmt.Errorf("error listing branches: %w", err)
+	}
+	branches := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !isSystemFolder(folder) {
+			branches = append(branches, folder)
+		}
+	}
+	return branches, nil
+}
+
+func (b *objectStoreBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+	runtimeVersionNames, err := b.listFolders(branch + "/")
+	if err != nil {
+		return nil, fmt.Errorf("error listing runtime versions: %w", err)
+	}
+	runtimeVersions := []RuntimeVersionWithStats{}
+	for _, runtimeVersion := range runtimeVersionNames {
+		updateIds, err := b.ListUpdates(branch, runtimeVersion)
+		if err != nil {
+			return nil, err
+		}
+		if len(updateIds) == 0 {
+			continue
+		}
+		runtimeVersions = append(runtimeVersions, newRuntimeVersionStats(runtimeVersion, updateIds))
+	}
+	return runtimeVersions, nil
+}
+
+func (b *objectStoreBucket) GetFile(branch string, runtimeVersion string, updateId string, fileName string) (io.ReadCloser, error) {
+	return b.store.read(updateObjectKey(branch, runtimeVersion, updateId, fileName))
+}
+
+func (b *objectStoreBucket) GetFileRange(branch string, runtimeVersion string, updateId string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.store.readRange(updateObjectKey(branch, runtimeVersion, updateId, fileName), offset, length)
+}
+
+func (b *objectStoreBucket) StatFile(branch string, runtimeVersion string, updateId string, fileName string) (ObjectInfo, error) {
+	object, err := b.store.stat(updateObjectKey(branch, runtimeVersion, updateId, fileName))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: fileName, LastModified: object.LastModified, Size: object.Size}, nil
+}
+
+func (b *objectStoreBucket) UploadFileIntoUpdate(update types.Update, fileName string, content io.Reader) error {
+	return b.store.write(updateObjectKey(update.Branch, update.RuntimeVersion, update.UpdateId, fileName), content)
+}
+
+func (b *objectStoreBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
+	objects, _, err := b.store.list(updateObjectKey(branch, runtimeVersion, updateId, "")+"/", "")
+	if err != nil {
+		return fmt.Errorf("error listing update %s: %w", updateId, err)
+	}
+	for _, object := range objects {
+		if err := b.store.remove(object.Key); err != nil {
+			return fmt.Errorf("error deleting %s: %w", object.Key, err)
+		}
+	}
+	return nil
+}
+
+func (b *objectStoreBucket) RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]types.FileUpdateRequest, error) {
+	requests := make([]types.FileUpdateRequest, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		key := updateObjectKey(branch, runtimeVersion, updateId, fileName)
+		url, headers, err := b.store.signUpload(key, uploadUrlValidity)
+		if err != nil {
+			return nil, fmt.Errorf("error generating upload URL for %s: %w", fileName, err)
+		}
+		requests = append(requests, types.FileUpdateRequest{
+			Url:     url,
+			Path:    key,
+			Headers: headers,
+		})
+	}
+	return requests, nil
+}
+
+func (b *objectStoreBucket) ListUpdates(branch string, runtimeVersion string) ([]string, error) {
+	updateIds, err := b.listFolders(branch + "/" + runtimeVersion + "/")
+	if err != nil {
+		return nil, fmt.Errorf("error listing updates: %w", err)
+	}
+	return updateIds, nil
+}
+
+func (b *objectStoreBucket) CopyFile(source types.Update, target types.Update, fileName string) error {
+	return b.store.copy(
+		updateObjectKey(source.Branch, source.RuntimeVersion, source.UpdateId, fileName),
+		updateObjectKey(target.Branch, target.RuntimeVersion, target.UpdateId, fileName),
+	)
+}
+
+func (b *objectStoreBucket) GetObject(key string) (io.ReadCloser, error) {
+	return b.store.read(systemObjectKey(key))
+}
+
+func (b *objectStoreBucket) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.store.readRange(systemObjectKey(key), offset, length)
+}
+
+func (b *objectStoreBucket) PutObject(key string, content io.Reader) error {
+	return b.store.write(systemObjectKey(key), content)
+}
+
+func (b *objectStoreBucket) GetObjectWithVersion(key string) (io.ReadCloser, string, error) {
+	return b.store.readVersion(systemObjectKey(key))
+}
+
+func (b *objectStoreBucket) PutObjectIfVersion(key string, content io.Reader, version string) error {
+	return b.store.writeIf(systemObjectKey(key), content, version)
+}
+
+func (b *objectStoreBucket) DeleteObject(key string) error {
+	return b.store.remove(systemObjectKey(key))
+}
+
+func (b *objectStoreBucket) ObjectExists(key string) (bool, error) {
+	_, err := b.store.stat(systemObjectKey(key))
+	if errors.Is(err, ErrObjectNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *objectStoreBucket) StatObject(key string) (ObjectInfo, error) {
+	object, err := b.store.stat(systemObjectKey(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, LastModified: object.LastModified, Size: object.Size}, nil
+}
+
+func (b *objectStoreBucket) MoveFileToObject(update types.Update, fileName string, key string) error {
+	sourceKey := updateObjectKey(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	if err := b.store.copy(sourceKey, systemObjectKey(key)); err != nil {
+		return err
+	}
+	return b.store.remove(sourceKey)
+}
+
+func (b *objectStoreBucket) ListObjects(prefix string) ([]ObjectInfo, error) {
+	objects, _, err := b.store.list(systemObjectKey(prefix), "")
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects under %s: %w", prefix, err)
+	}
+	infos := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		infos = append(infos, ObjectInfo{
+			Key:          strings.TrimPrefix(object.Key, SystemPrefix+"/"),
+			LastModified: object.LastModified,
+			Size:         object.Size,
+		})
+	}
+	return infos, nil
+}
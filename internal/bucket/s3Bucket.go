@@ -1,25 +1,52 @@
 package bucket
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
 	"fmt"
 	"io"
+	"net/url"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 type S3Bucket struct {
 	BucketName string
+	// Client overrides the shared client built from the environment.
+	Client *s3.Client
+}
+
+// uploadObject streams content to key. Readers are sent in parts of bounded
+// size, each buffered so the SDK can hash it to sign requests sent to plain
+// HTTP endpoints, and small ones in a single request.
+func (b *S3Bucket) uploadObject(s3Client *s3.Client, key string, content io.Reader) error {
+	uploader := manager.NewUploader(s3Client)
+	_, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(key),
+		Body:   content,
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject error: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Bucket) getClient() (*s3.Client, error) {
+	if b.Client != nil {
+		return b.Client, nil
+	}
+	return services.GetS3Client()
 }
 
 func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) error {
@@ -27,7 +54,7 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 		return errors.New("BucketName not set")
 	}
 
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.getClient()
 	if err != nil {
 		return fmt.Errorf("error getting S3 client: %w", err)
 	}
@@ -83,123 +110,74 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 	return nil
 }
 
-func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+// listFolders returns the sorted names of the folders directly under prefix,
+// following every page of the listing.
+func (b *S3Bucket) listFolders(prefix string) ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
-	s3Client, errS3 := services.GetS3Client()
-	if errS3 != nil {
-		return nil, errS3
+	s3Client, err := b.getClient()
+	if err != nil {
+		return nil, err
 	}
-
-	input := &s3.ListObjectsV2Input{
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
 		Bucket:    aws.String(b.BucketName),
-		Prefix:    aws.String(branch + "/"),
+		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"),
+	})
+	folders := []string{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+		}
+		for _, commonPrefix := range page.CommonPrefixes {
+			folders = append(folders, strings.TrimSuffix(strings.TrimPrefix(*commonPrefix.Prefix, prefix), "/"))
+		}
 	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	sort.Strings(folders)
+	return folders, nil
+}
+
+func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+	runtimeVersionNames, err := b.listFolders(branch + "/")
 	if err != nil {
-		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+		return nil, err
 	}
-
-	var runtimeVersions []RuntimeVersionWithStats
-	prefixLen := len(branch) + 1
-
-	for _, commonPrefix := range resp.CommonPrefixes {
-		runtimeVersion := (*commonPrefix.Prefix)[prefixLen : len(*commonPrefix.Prefix)-1]
-		updatesPath := *commonPrefix.Prefix
-		updateInput := &s3.ListObjectsV2Input{
-			Bucket:    aws.String(b.BucketName),
-			Prefix:    aws.String(updatesPath),
-			Delimiter: aws.String("/"),
-		}
-		updateResp, err := s3Client.ListObjectsV2(context.TODO(), updateInput)
+	runtimeVersions := []RuntimeVersionWithStats{}
+	for _, runtimeVersion := range runtimeVersionNames {
+		updateIds, err := b.ListUpdates(branch, runtimeVersion)
 		if err != nil {
-			return nil, fmt.Errorf("ListObjectsV2 error in updates: %w", err)
-		}
-
-		var updateTimestamps []int64
-		for _, commonPrefix := range updateResp.CommonPrefixes {
-			updateID := strings.TrimSuffix((*commonPrefix.Prefix)[len(updatesPath):], "/")
-			timestamp, err := strconv.ParseInt(updateID, 10, 64)
-			if err != nil {
-				continue
-			}
-			updateTimestamps = append(updateTimestamps, timestamp)
+			return nil, err
 		}
-
-		if len(updateTimestamps) == 0 {
+		if len(updateIds) == 0 {
 			continue
 		}
-
-		sort.Slice(updateTimestamps, func(i, j int) bool { return updateTimestamps[i] < updateTimestamps[j] })
-
-		runtimeVersions = append(runtimeVersions, RuntimeVersionWithStats{
-			RuntimeVersion:  runtimeVersion,
-			CreatedAt:       time.UnixMilli(updateTimestamps[0]).UTC().Format(time.RFC3339),
-			LastUpdatedAt:   time.UnixMilli(updateTimestamps[len(updateTimestamps)-1]).UTC().Format(time.RFC3339),
-			NumberOfUpdates: len(updateTimestamps),
-		})
+		runtimeVersions = append(runtimeVersions, newRuntimeVersionStats(runtimeVersion, updateIds))
 	}
-
 	return runtimeVersions, nil
 }
 
 func (b *S3Bucket) GetBranches() ([]string, error) {
-	if b.BucketName == "" {
-		return nil, errors.New("BucketName not set")
-	}
-	s3Client, errS3 := services.GetS3Client()
-	if errS3 != nil {
-		return nil, errS3
-	}
-	input := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(b.BucketName),
-		Delimiter: aws.String("/"),
-	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	folders, err := b.listFolders("")
 	if err != nil {
-		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+		return nil, err
 	}
-	var branches []string
-	for _, commonPrefix := range resp.CommonPrefixes {
-		prefix := *commonPrefix.Prefix
-		branches = append(branches, prefix[:len(prefix)-1])
+	branches := make([]string, 0, len(folders))
+	for _, folder := range folders {
+		if !isSystemFolder(folder) {
+			branches = append(branches, folder)
+		}
 	}
 	return branches, nil
 }
 
 func (b *S3Bucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
-	if b.BucketName == "" {
-		return nil, errors.New("BucketName not set")
-	}
-	s3Client, errS3 := services.GetS3Client()
-	if errS3 != nil {
-		return nil, errS3
-	}
-	prefix := branch + "/" + runtimeVersion + "/"
-	input := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(b.BucketName),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
-	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	updateIds, err := b.ListUpdates(branch, runtimeVersion)
 	if err != nil {
-		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
-	}
-	var updates []types.Update
-	for _, commonPrefix := range resp.CommonPrefixes {
-		var updateId int64
-		if _, err := fmt.Sscanf(*commonPrefix.Prefix, prefix+"%d/", &updateId); err == nil {
-			updates = append(updates, types.Update{
-				Branch:         branch,
-				RuntimeVersion: runtimeVersion,
-				UpdateId:       strconv.FormatInt(updateId, 10),
-				CreatedAt:      time.Duration(updateId) * time.Millisecond,
-			})
-		}
+		return nil, err
 	}
-	return updates, nil
+	return newUpdates(branch, runtimeVersion, updateIds), nil
 }
 
 func (b *S3Bucket) GetFile(branch string, runtimeVersion string, updateId string, fileName string) (io.ReadCloser, error) {
@@ -207,7 +185,7 @@ func (b *S3Bucket) GetFile(branch string, runtimeVersion string, updateId string
 		return nil, errors.New("BucketName not set")
 	}
 	filePath := branch + "/" + runtimeVersion + "/" + updateId + "/" + fileName
-	s3Client, errS3 := services.GetS3Client()
+	s3Client, errS3 := b.getClient()
 	if errS3 != nil {
 		return nil, errS3
 	}
@@ -217,17 +195,83 @@ func (b *S3Bucket) GetFile(branch string, runtimeVersion string, updateId string
 	}
 	resp, err := s3Client.GetObject(context.TODO(), input)
 	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("file not found: %s: %w", fileName, ErrObjectNotFound)
+		}
+		return nil, fmt.Errorf("GetObject error: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func (b *S3Bucket) GetFileRange(branch string, runtimeVersion string, updateId string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.getObjectRange(updateObjectKey(branch, runtimeVersion, updateId, fileName), offset, length)
+}
+
+// getObjectRange reads a range of the object stored under key, relative to
+// the bucket root.
+func (b *S3Bucket) getObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(rangeHeader(offset, length)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("file not found: %s: %w", key, ErrObjectNotFound)
+		}
 		return nil, fmt.Errorf("GetObject error: %w", err)
 	}
 	return resp.Body, nil
 }
 
+func (b *S3Bucket) StatFile(branch string, runtimeVersion string, updateId string, fileName string) (ObjectInfo, error) {
+	info, err := b.headObject(updateObjectKey(branch, runtimeVersion, updateId, fileName))
+	info.Key = fileName
+	return info, err
+}
+
+// headObject describes the object stored under key, relative to the bucket root.
+func (b *S3Bucket) headObject(key string) (ObjectInfo, error) {
+	if b.BucketName == "" {
+		return ObjectInfo{}, errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return ObjectInfo{}, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		}
+		return ObjectInfo{}, fmt.Errorf("HeadObject error: %w", err)
+	}
+	info := ObjectInfo{Key: key, Size: aws.ToInt64(resp.ContentLength)}
+	if resp.LastModified != nil {
+		info.LastModified = *resp.LastModified
+	}
+	return info, nil
+}
+
 func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
 	if b.BucketName == "" {
 		return "", errors.New("BucketName not set")
 	}
 
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.getClient()
 	if err != nil {
 		return "", fmt.Errorf("error getting S3 client: %w", err)
 	}
@@ -255,21 +299,12 @@ func (b *S3Bucket) UploadFileIntoUpdate(update types.Update, fileName string, fi
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
-	s3Client, err := services.GetS3Client()
+	s3Client, err := b.getClient()
 	if err != nil {
 		return err
 	}
 	key := fmt.Sprintf("%s/%s/%s/%s", update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(b.BucketName),
-		Key:    aws.String(key),
-		Body:   file,
-	}
-	_, err = s3Client.PutObject(context.TODO(), input)
-	if err != nil {
-		return fmt.Errorf("PutObject error: %w", err)
-	}
-	return nil
+	return b.uploadObject(s3Client, key, file)
 }
 
 func (b *S3Bucket) GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error) {
@@ -277,38 +312,28 @@ func (b *S3Bucket) GetUpdate(branch string, runtimeVersion string, updateId stri
 		return nil, errors.New("BucketName not set")
 	}
 
-	metadataPath := branch + "/" + runtimeVersion + "/" + updateId + "/metadata.json"
-	s3Client, errS3 := services.GetS3Client()
+	s3Client, errS3 := b.getClient()
 	if errS3 != nil {
 		return nil, errS3
 	}
 
-	input := &s3.GetObjectInput{
+	_, err := s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
 		Bucket: aws.String(b.BucketName),
-		Key:    aws.String(metadataPath),
-	}
-
-	resp, err := s3Client.GetObject(context.TODO(), input)
-	if err != nil {
-		return nil, fmt.Errorf("GetObject error: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var metadata types.UpdateMetadata
-	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
-		return nil, err
-	}
-
-	createdAt, err := time.ParseDuration(metadata.CreatedAt)
+		Key:    aws.String(updateObjectKey(branch, runtimeVersion, updateId, "metadata.json")),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse CreatedAt: %w", err)
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, updateNotFound(branch, runtimeVersion, updateId)
+		}
+		return nil, fmt.Errorf("HeadObject error: %w", err)
 	}
 
 	return &types.Update{
 		Branch:         branch,
 		RuntimeVersion: runtimeVersion,
 		UpdateId:       updateId,
-		CreatedAt:      createdAt,
+		CreatedAt:      updateCreatedAt(updateId),
 	}, nil
 }
 
@@ -324,10 +349,9 @@ func (b *S3Bucket) RequestUploadUrlsForFileUpdates(branch string, runtimeVersion
 			return nil, fmt.Errorf("error generating upload URL for %s: %w", fileName, err)
 		}
 
-		filePath := fmt.Sprintf("%s/%s/%s/%s", branch, runtimeVersion, updateId, fileName)
 		requests = append(requests, types.FileUpdateRequest{
 			Url:  url,
-			Path: filePath,
+			Path: updateObjectKey(branch, runtimeVersion, updateId, fileName),
 		})
 	}
 
@@ -336,33 +360,227 @@ func (b *S3Bucket) RequestUploadUrlsForFileUpdates(branch string, runtimeVersion
 
 // ListUpdates returns a list of all update IDs for a specific branch and runtime version
 func (b *S3Bucket) ListUpdates(branch string, runtimeVersion string) ([]string, error) {
+	return b.listFolders(branch + "/" + runtimeVersion + "/")
+}
+
+func (b *S3Bucket) CopyFile(source types.Update, target types.Update, fileName string) error {
 	if b.BucketName == "" {
-		return nil, errors.New("BucketName not set")
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return err
 	}
+	sourceKey := fmt.Sprintf("%s/%s/%s/%s", source.Branch, source.RuntimeVersion, source.UpdateId, fileName)
+	targetKey := fmt.Sprintf("%s/%s/%s/%s", target.Branch, target.RuntimeVersion, target.UpdateId, fileName)
+	_, err = s3Client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(b.BucketName),
+		CopySource: aws.String((&url.URL{Path: b.BucketName + "/" + sourceKey}).EscapedPath()),
+		Key:        aws.String(targetKey),
+	})
+	if err != nil {
+		return fmt.Errorf("CopyObject error: %w", err)
+	}
+	return nil
+}
 
-	s3Client, errS3 := services.GetS3Client()
+func (b *S3Bucket) GetObject(key string) (io.ReadCloser, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	s3Client, errS3 := b.getClient()
 	if errS3 != nil {
 		return nil, errS3
 	}
+	resp, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(SystemPrefix + "/" + key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("GetObject error: %w", err)
+	}
+	return resp.Body, nil
+}
 
-	prefix := branch + "/" + runtimeVersion + "/"
-	input := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(b.BucketName),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
+func (b *S3Bucket) GetObjectRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	return b.getObjectRange(SystemPrefix+"/"+key, offset, length)
+}
+
+func (b *S3Bucket) PutObject(key string, content io.Reader) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return err
 	}
+	return b.uploadObject(s3Client, SystemPrefix+"/"+key, content)
+}
 
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+func (b *S3Bucket) GetObjectWithVersion(key string) (io.ReadCloser, string, error) {
+	if b.BucketName == "" {
+		return nil, "", errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
 	if err != nil {
-		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+		return nil, "", err
 	}
+	resp, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(SystemPrefix + "/" + key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, "", ErrObjectNotFound
+		}
+		return nil, "", fmt.Errorf("GetObject error: %w", err)
+	}
+	return resp.Body, aws.ToString(resp.ETag), nil
+}
 
-	var updates []string
-	for _, commonPrefix := range resp.CommonPrefixes {
-		updateID := strings.TrimPrefix(*commonPrefix.Prefix, prefix)
-		updateID = strings.TrimSuffix(updateID, "/")
-		updates = append(updates, updateID)
+// PutObjectIfVersion sends a conditional PutObject. Objects written this way
+// are small documents, buffered whole rather than uploaded in parts.
+func (b *S3Bucket) PutObjectIfVersion(key string, content io.Reader, version string) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("error reading content: %w", err)
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(SystemPrefix + "/" + key),
+		Body:   bytes.NewReader(body),
+	}
+	if version == "" {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		input.IfMatch = aws.String(version)
+	}
+	_, err = s3Client.PutObject(context.TODO(), input)
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.ErrorCode() {
+		// A conditional write of a deleted object fails with NoSuchKey
+		case "PreconditionFailed", "ConditionalRequestConflict", "NoSuchKey":
+			return ErrVersionConflict
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("PutObject error: %w", err)
 	}
+	return nil
+}
+
+func (b *S3Bucket) DeleteObject(key string) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(SystemPrefix + "/" + key),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject error: %w", err)
+	}
+	return nil
+}
 
-	return updates, nil
+func (b *S3Bucket) ObjectExists(key string) (bool, error) {
+	if b.BucketName == "" {
+		return false, errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return false, err
+	}
+	_, err = s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(SystemPrefix + "/" + key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("HeadObject error: %w", err)
+	}
+	return true, nil
+}
+
+func (b *S3Bucket) StatObject(key string) (ObjectInfo, error) {
+	info, err := b.headObject(SystemPrefix + "/" + key)
+	info.Key = key
+	return info, err
+}
+
+func (b *S3Bucket) MoveFileToObject(update types.Update, fileName string, key string) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return err
+	}
+	sourceKey := fmt.Sprintf("%s/%s/%s/%s", update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	_, err = s3Client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(b.BucketName),
+		CopySource: aws.String((&url.URL{Path: b.BucketName + "/" + sourceKey}).EscapedPath()),
+		Key:        aws.String(SystemPrefix + "/" + key),
+	})
+	if err != nil {
+		return fmt.Errorf("CopyObject error: %w", err)
+	}
+	_, err = s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(sourceKey),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteObject error: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Bucket) ListObjects(prefix string) ([]ObjectInfo, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	s3Client, err := b.getClient()
+	if err != nil {
+		return nil, err
+	}
+	systemPrefix := SystemPrefix + "/"
+	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.BucketName),
+		Prefix: aws.String(systemPrefix + prefix),
+	})
+	objects := []ObjectInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+		}
+		for _, object := range page.Contents {
+			info := ObjectInfo{Key: strings.TrimPrefix(aws.ToString(object.Key), systemPrefix), Size: aws.ToInt64(object.Size)}
+			if object.LastModified != nil {
+				info.LastModified = *object.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
 }
@@ -0,0 +1,400 @@
+package bucket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// s3StandIn is an in-memory server speaking the part of the S3 API the bucket
+// uses, addressed path-style like a MinIO deployment.
+type s3StandIn struct {
+	mutex          sync.Mutex
+	bucketName     string
+	objects        map[string]standInObject
+	paths          []string
+	authorizations []string
+	// uploads are the parts of multipart uploads in progress by upload id
+	uploads       map[string]map[int][]byte
+	partsUploaded int
+}
+
+type standInObject struct {
+	content      []byte
+	lastModified time.Time
+	etag         string
+}
+
+// newStandInObject stores content with the MD5 of it as ETag, like S3.
+func newStandInObject(content []byte) standInObject {
+	sum := md5.Sum(content)
+	return standInObject{content: content, lastModified: time.Now(), etag: `"` + hex.EncodeToString(sum[:]) + `"`}
+}
+
+// standInPreconditionFails tells whether the If-Match or If-None-Match
+// header of a write rejects the current object, ok is false when missing.
+func standInPreconditionFails(r *http.Request, object standInObject, ok bool) bool {
+	if r.Header.Get("If-None-Match") == "*" && ok {
+		return true
+	}
+	ifMatch := r.Header.Get("If-Match")
+	return ifMatch != "" && (!ok || ifMatch != object.etag)
+}
+
+type standInContents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+}
+
+type standInPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type standInListResult struct {
+	XMLName        xml.Name          `xml:"ListBucketResult"`
+	Name           string            `xml:"Name"`
+	Prefix         string            `xml:"Prefix"`
+	KeyCount       int               `xml:"KeyCount"`
+	MaxKeys        int               `xml:"MaxKeys"`
+	IsTruncated    bool              `xml:"IsTruncated"`
+	Contents       []standInContents `xml:"Contents"`
+	CommonPrefixes []standInPrefix   `xml:"CommonPrefixes"`
+}
+
+type standInCompleteUpload struct {
+	Parts []struct {
+		PartNumber int `xml:"PartNumber"`
+	} `xml:"Part"`
+}
+
+type standInDelete struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+func newS3StandIn(t *testing.T, bucketName string) (*s3StandIn, *httptest.Server) {
+	standIn := &s3StandIn{bucketName: bucketName, objects: map[string]standInObject{}, uploads: map[string]map[int][]byte{}}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		standIn.mutex.Lock()
+		defer standIn.mutex.Unlock()
+		for _, requestPath := range standIn.paths {
+			assert.True(t, strings.HasPrefix(requestPath, "/"+bucketName), "request %s is not path-style", requestPath)
+		}
+		for _, authorization := range standIn.authorizations {
+			assert.Contains(t, authorization, "Credential=standin-access-key/")
+			assert.Contains(t, authorization, "/us-east-1/s3/aws4_request")
+		}
+	})
+	return standIn, server
+}
+
+func writeStandInError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("<Error><Code>" + code + "</Code><Message>" + code + "</Message></Error>"))
+}
+
+func writeStandInXML(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(value)
+}
+
+// readStandInBody reads an uploaded payload, stripping the chunk framing of
+// streamed uploads.
+func readStandInBody(r *http.Request) []byte {
+	body, _ := io.ReadAll(r.Body)
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") ||
+		strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") {
+		return decodeAwsChunked(body)
+	}
+	return body
+}
+
+// decodeAwsChunked strips the chunk framing of streamed uploads.
+func decodeAwsChunked(body []byte) []byte {
+	var decoded []byte
+	reader := bufio.NewReader(bytes.NewReader(body))
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return decoded
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 {
+			return decoded
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return decoded
+		}
+		decoded = append(decoded, chunk...)
+		_, _ = reader.ReadString('\n')
+	}
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paths = append(s.paths, r.URL.Path)
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		// Presigned requests carry their credentials in the query
+		authorization = "Credential=" + r.URL.Query().Get("X-Amz-Credential")
+	}
+	s.authorizations = append(s.authorizations, authorization)
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucketName != s.bucketName {
+		writeStandInError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, query.Get("prefix"), query.Get("delimiter"))
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		var request standInDelete
+		if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeStandInError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		for _, object := range request.Objects {
+			delete(s.objects, object.Key)
+		}
+		writeStandInXML(w, struct {
+			XMLName xml.Name `xml:"DeleteResult"`
+		}{})
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadId := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[uploadId] = map[int][]byte{}
+		writeStandInXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadId string   `xml:"UploadId"`
+		}{Bucket: s.bucketName, Key: key, UploadId: uploadId})
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			writeStandInError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = readStandInBody(r)
+		s.partsUploaded++
+		w.Header().Set("ETag", `"part-`+strconv.Itoa(partNumber)+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		var request standInCompleteUpload
+		if !ok || xml.NewDecoder(r.Body).Decode(&request) != nil {
+			writeStandInError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		content := []byte{}
+		for _, part := range request.Parts {
+			content = append(content, parts[part.PartNumber]...)
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		s.objects[key] = newStandInObject(content)
+		writeStandInXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string   `xml:"Bucket"`
+			Key     string   `xml:"Key"`
+			ETag    string   `xml:"ETag"`
+		}{Bucket: s.bucketName, Key: key, ETag: s.objects[key].etag})
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		copySource, _ := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+		_, sourceKey, _ := strings.Cut(strings.TrimPrefix(copySource, "/"), "/")
+		source, ok := s.objects[sourceKey]
+		if !ok {
+			writeStandInError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		s.objects[key] = newStandInObject(source.content)
+		writeStandInXML(w, struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string   `xml:"ETag"`
+		}{ETag: s.objects[key].etag})
+	case r.Method == http.MethodPut:
+		current, ok := s.objects[key]
+		if standInPreconditionFails(r, current, ok) {
+			if !ok && r.Header.Get("If-Match") != "" {
+				writeStandInError(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			writeStandInError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		s.objects[key] = newStandInObject(readStandInBody(r))
+		w.Header().Set("ETag", s.objects[key].etag)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := s.objects[key]
+		if !ok {
+			writeStandInError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		// Answers ranged reads like S3, with a 206
+		w.Header().Set("ETag", object.etag)
+		http.ServeContent(w, r, key, object.lastModified, bytes.NewReader(object.content))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeStandInError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *s3StandIn) list(w http.ResponseWriter, prefix string, delimiter string) {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := standInListResult{Name: s.bucketName, Prefix: prefix, MaxKeys: 1000}
+	seenPrefixes := map[string]bool{}
+	for _, key := range keys {
+		rest := key[len(prefix):]
+		if index := strings.Index(rest, delimiter); delimiter != "" && index >= 0 {
+			commonPrefix := prefix + rest[:index+len(delimiter)]
+			if !seenPrefixes[commonPrefix] {
+				seenPrefixes[commonPrefix] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, standInPrefix{Prefix: commonPrefix})
+			}
+			continue
+		}
+		object := s.objects[key]
+		result.Contents = append(result.Contents, standInContents{
+			Key:          key,
+			LastModified: object.lastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         object.etag,
+			Size:         len(object.content),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	writeStandInXML(w, result)
+}
+
+func newStandInS3Bucket(t *testing.T) (*s3StandIn, *S3Bucket) {
+	standIn, server := newS3StandIn(t, "ota-updates")
+	t.Setenv("S3_ENDPOINT", server.URL)
+	t.Setenv("S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("S3_REGION", "us-east-1")
+	t.Setenv("AWS_REGION", "eu-west-3")
+	t.Setenv("S3_ACCESS_KEY_ID", "standin-access-key")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "standin-secret-key")
+
+	options := services.LoadS3Options()
+	assert.Equal(t, "us-east-1", options.Region)
+	assert.True(t, options.ForcePathStyle)
+	client, err := services.NewS3Client(options)
+	require.NoError(t, err)
+	return standIn, &S3Bucket{BucketName: "ota-updates", Client: client}
+}
+
+func readAll(t *testing.T, reader io.ReadCloser) string {
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestS3BucketAgainstS3CompatibleEndpoint(t *testing.T) {
+	_, s3Bucket := newStandInS3Bucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+
+	require.NoError(t, s3Bucket.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader(`{"version":0}`)))
+	// Readers that cannot seek and fit in a part are sent in a single request
+	require.NoError(t, s3Bucket.UploadFileIntoUpdate(update, "bundles/ios.js", io.LimitReader(strings.NewReader("bundle"), 6)))
+
+	file, err := s3Bucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "bundles/ios.js")
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", readAll(t, file))
+
+	updateIds, err := s3Bucket.ListUpdates(update.Branch, update.RuntimeVersion)
+	require.NoError(t, err)
+	assert.Equal(t, []string{update.UpdateId}, updateIds)
+
+	copied := types.Update{Branch: "staging", RuntimeVersion: "1.0.0", UpdateId: "1700000000001"}
+	require.NoError(t, s3Bucket.CopyFile(update, copied, "metadata.json"))
+	file, err = s3Bucket.GetFile(copied.Branch, copied.RuntimeVersion, copied.UpdateId, "metadata.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":0}`, readAll(t, file))
+
+	require.NoError(t, s3Bucket.PutObject("channels.json", strings.NewReader("[]")))
+	branches, err := s3Bucket.GetBranches()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"main", "staging"}, branches)
+
+	require.NoError(t, s3Bucket.MoveFileToObject(update, "bundles/ios.js", "assets/abc"))
+	exists, err := s3Bucket.ObjectExists("assets/abc")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	object, err := s3Bucket.GetObject("assets/abc")
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", readAll(t, object))
+	objects, err := s3Bucket.ListObjects("assets/")
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "assets/abc", objects[0].Key)
+	assert.False(t, objects[0].LastModified.IsZero())
+
+	require.NoError(t, s3Bucket.DeleteObject("assets/abc"))
+	exists, err = s3Bucket.ObjectExists("assets/abc")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = s3Bucket.GetObject("assets/abc")
+	assert.ErrorIs(t, err, ErrObjectNotFound)
+
+	require.NoError(t, s3Bucket.DeleteUpdateFolder(update.Branch, update.RuntimeVersion, update.UpdateId))
+	updateIds, err = s3Bucket.ListUpdates(update.Branch, update.RuntimeVersion)
+	require.NoError(t, err)
+	assert.Empty(t, updateIds)
+}
+
+func TestS3BucketStreamsLargeUploadsInParts(t *testing.T) {
+	standIn, s3Bucket := newStandInS3Bucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+
+	// A reader of unknown length is sent part by part, not buffered whole
+	content := strings.Repeat("0123456789abcdef", 768*1024)
+	require.NoError(t, s3Bucket.UploadFileIntoUpdate(update, "bundles/ios.js", io.LimitReader(strings.NewReader(content), int64(len(content)))))
+	object, err := s3Bucket.StatFile(update.Branch, update.RuntimeVersion, update.UpdateId, "bundles/ios.js")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), object.Size)
+	file, err := s3Bucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "bundles/ios.js")
+	require.NoError(t, err)
+	assert.Equal(t, content, readAll(t, file))
+
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+	assert.Equal(t, 3, standIn.partsUploaded)
+	assert.Empty(t, standIn.uploads)
+}
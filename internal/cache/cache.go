@@ -2,7 +2,10 @@ package cache
 
 import (
 	"expo-open-ota/config"
+	"log"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Cache interface {
@@ -15,18 +18,59 @@ type Cache interface {
 type CacheType string
 
 const (
-	LocalCacheType CacheType = "local"
-	RedisCacheType CacheType = "redis"
+	LocalCacheType  CacheType = "local"
+	RedisCacheType  CacheType = "redis"
+	TieredCacheType CacheType = "tiered"
 )
 
 func ResolveCacheType() CacheType {
 	cacheType := config.GetEnv("CACHE_MODE")
-	if cacheType == "redis" {
+	switch cacheType {
+	case "redis":
 		return RedisCacheType
+	case "tiered":
+		return TieredCacheType
 	}
 	return LocalCacheType
 }
 
+// positiveEnvInt reads a positive integer setting, falling back when it is
+// missing or invalid.
+func positiveEnvInt(key string, fallback int64) int64 {
+	value := config.GetEnv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func newBoundedLocalCache() *LocalCache {
+	return NewLocalCacheWithLimit(positiveEnvInt("CACHE_LOCAL_MAX_BYTES", defaultLocalCacheMaxBytes))
+}
+
+func newRedisCacheFromEnv() (*RedisCache, error) {
+	redisConfig, err := LoadRedisConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisCache(redisConfig.NewClient(), newBoundedLocalCache()), nil
+}
+
+// ValidateCacheConfig checks the Redis configuration of the redis and tiered
+// cache modes, so a bad REDIS_URL stops the server at startup.
+func ValidateCacheConfig() error {
+	if ResolveCacheType() == LocalCacheType {
+		return nil
+	}
+	_, err := LoadRedisConfig()
+	return err
+}
+
 var (
 	cacheInstance Cache
 	once          sync.Once
@@ -37,12 +81,22 @@ func GetCache() Cache {
 		cacheType := ResolveCacheType()
 		switch cacheType {
 		case LocalCacheType:
-			cacheInstance = NewLocalCache()
-		case RedisCacheType:
-			host := config.GetEnv("REDIS_HOST")
-			password := config.GetEnv("REDIS_PASSWORD")
-			port := config.GetEnv("REDIS_PORT")
-			cacheInstance = NewRedisCache(host, password, port)
+			cacheInstance = newBoundedLocalCache()
+		case RedisCacheType, TieredCacheType:
+			redisCache, err := newRedisCacheFromEnv()
+			if err != nil {
+				// The servers refuse to start with an invalid configuration,
+				// only commands that skip ValidateCacheConfig get here
+				log.Printf("Invalid Redis configuration, using the local cache: %v", err)
+				cacheInstance = newBoundedLocalCache()
+				return
+			}
+			if cacheType == RedisCacheType {
+				cacheInstance = redisCache
+				return
+			}
+			localTTL := time.Duration(positiveEnvInt("CACHE_LOCAL_TTL", int64(defaultLocalTTL/time.Second))) * time.Second
+			cacheInstance = NewTieredCache(newBoundedLocalCache(), redisCache, localTTL)
 		default:
 			panic("Unknown cache type")
 		}
@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"encoding/json"
+	"expo-open-ota/config"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// InvalidationReason tells replicas why cache keys were dropped.
+type InvalidationReason string
+
+const (
+	InvalidationPublish  InvalidationReason = "publish"
+	InvalidationRollback InvalidationReason = "rollback"
+	InvalidationDelete   InvalidationReason = "delete"
+	InvalidationRollout  InvalidationReason = "rollout"
+	InvalidationChannels InvalidationReason = "channels"
+	InvalidationIndex    InvalidationReason = "index"
+)
+
+// InvalidationEvent is broadcast to every instance when cache keys must be
+// dropped. Origin identifies the instance that sent it.
+type InvalidationEvent struct {
+	Origin string             `json:"origin"`
+	Reason InvalidationReason `json:"reason"`
+	Keys   []string           `json:"keys"`
+}
+
+// InvalidationBus carries invalidation events between the instances of the
+// server.
+type InvalidationBus interface {
+	Publish(event InvalidationEvent) error
+	// Subscribe calls handler with every event published on the bus, by any
+	// instance, until the bus is closed.
+	Subscribe(handler func(InvalidationEvent)) error
+	Close() error
+}
+
+// InvalidationBusProvider builds an InvalidationBus from the configuration.
+type InvalidationBusProvider func() (InvalidationBus, error)
+
+var (
+	busProvidersMutex sync.RWMutex
+	busProviders      = map[string]InvalidationBusProvider{}
+
+	invalidatorInstance *Invalidator
+	invalidatorOnce     sync.Once
+)
+
+// RegisterInvalidationBus makes a bus selectable with CACHE_INVALIDATION_BUS.
+func RegisterInvalidationBus(name string, provider InvalidationBusProvider) {
+	busProvidersMutex.Lock()
+	defer busProvidersMutex.Unlock()
+	busProviders[name] = provider
+}
+
+func lookupInvalidationBus(name string) (InvalidationBusProvider, bool) {
+	busProvidersMutex.RLock()
+	defer busProvidersMutex.RUnlock()
+	provider, ok := busProviders[name]
+	return provider, ok
+}
+
+func invalidationBusNames() []string {
+	busProvidersMutex.RLock()
+	defer busProvidersMutex.RUnlock()
+	names := make([]string, 0, len(busProviders))
+	for name := range busProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Invalidator drops keys from the cache of this instance and broadcasts them
+// so the other instances drop them too.
+type Invalidator struct {
+	cache    Cache
+	bus      InvalidationBus
+	instance string
+}
+
+// NewInvalidator returns an Invalidator for a cache. Without a bus the keys
+// are only dropped locally.
+func NewInvalidator(cache Cache, bus InvalidationBus) *Invalidator {
+	return &Invalidator{
+		cache:    cache,
+		bus:      bus,
+		instance: uuid.New().String(),
+	}
+}
+
+// Listen drops the keys of the events other instances publish.
+func (i *Invalidator) Listen() error {
+	if i.bus == nil {
+		return nil
+	}
+	return i.bus.Subscribe(func(event InvalidationEvent) {
+		if event.Origin == i.instance {
+			return
+		}
+		for _, key := range event.Keys {
+			// The sender already dropped the keys from the shared tier
+			if tiered, ok := i.cache.(*TieredCache); ok {
+				tiered.DeleteLocal(key)
+				continue
+			}
+			i.cache.Delete(key)
+		}
+	})
+}
+
+func (i *Invalidator) Invalidate(reason InvalidationReason, keys ...string) {
+	for _, key := range keys {
+		i.cache.Delete(key)
+	}
+	if i.bus == nil || len(keys) == 0 {
+		return
+	}
+	event := InvalidationEvent{Origin: i.instance, Reason: reason, Keys: keys}
+	if err := i.bus.Publish(event); err != nil {
+		log.Printf("Error broadcasting %s cache invalidation: %v", reason, err)
+	}
+}
+
+func (i *Invalidator) Close() error {
+	if i.bus == nil {
+		return nil
+	}
+	return i.bus.Close()
+}
+
+// redisConfigured reports whether this instance can reach Redis: its cache is
+// in Redis or a Redis server is set.
+func redisConfigured() bool {
+	return ResolveCacheType() != LocalCacheType || config.GetEnv("REDIS_URL") != "" || config.GetEnv("REDIS_HOST") != ""
+}
+
+// GetInvalidator returns the Invalidator of the cache, using the bus selected
+// by CACHE_INVALIDATION_BUS, Redis by default whenever Redis is configured.
+// CACHE_INVALIDATION_BUS=none disables it. The cache is only invalidated
+// locally when no bus is configured or it cannot be reached.
+func GetInvalidator() *Invalidator {
+	invalidatorOnce.Do(func() {
+		var bus InvalidationBus
+		name := strings.ToLower(config.GetEnv("CACHE_INVALIDATION_BUS"))
+		if name == "" && redisConfigured() {
+			// The in-process cache of every instance must drop invalidated keys
+			name = "redis"
+		}
+		if name != "" && name != "none" {
+			provider, ok := lookupInvalidationBus(name)
+			if !ok {
+				log.Printf("Unknown CACHE_INVALIDATION_BUS %s, available buses: %s", name, strings.Join(invalidationBusNames(), ", "))
+			} else if resolvedBus, err := provider(); err != nil {
+				log.Printf("Error connecting to the %s cache invalidation bus, invalidating locally only: %v", name, err)
+			} else {
+				bus = resolvedBus
+			}
+		}
+		invalidatorInstance = NewInvalidator(GetCache(), bus)
+	})
+	return invalidatorInstance
+}
+
+// StartInvalidationListener subscribes this instance to the invalidations of
+// the other instances.
+func StartInvalidationListener() {
+	if err := GetInvalidator().Listen(); err != nil {
+		log.Printf("Error subscribing to cache invalidations: %v", err)
+	}
+}
+
+// Invalidate drops keys from the cache of every instance.
+func Invalidate(reason InvalidationReason, keys ...string) {
+	GetInvalidator().Invalidate(reason, keys...)
+}
+
+func encodeInvalidationEvent(event InvalidationEvent) (string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+func decodeInvalidationEvent(payload string) (InvalidationEvent, error) {
+	var event InvalidationEvent
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
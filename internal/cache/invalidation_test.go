@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBus delivers events synchronously to the subscribers of every
+// instance sharing it.
+type memoryBus struct {
+	mu       sync.Mutex
+	handlers []func(InvalidationEvent)
+	events   []InvalidationEvent
+}
+
+func (b *memoryBus) Publish(event InvalidationEvent) error {
+	b.mu.Lock()
+	b.events = append(b.events, event)
+	handlers := append([]func(InvalidationEvent){}, b.handlers...)
+	b.mu.Unlock()
+	payload, err := encodeInvalidationEvent(event)
+	if err != nil {
+		return err
+	}
+	for _, handler := range handlers {
+		decoded, err := decodeInvalidationEvent(payload)
+		if err != nil {
+			return err
+		}
+		handler(decoded)
+	}
+	return nil
+}
+
+func (b *memoryBus) Subscribe(handler func(InvalidationEvent)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *memoryBus) Close() error { return nil }
+
+func TestInvalidationReachesEveryReplica(t *testing.T) {
+	bus := &memoryBus{}
+	replicas := []*Invalidator{}
+	caches := []*LocalCache{}
+	for i := 0; i < 3; i++ {
+		localCache := NewLocalCache()
+		require.NoError(t, localCache.Set("lastUpdate:main:1.0.0", "1700000000000", nil))
+		require.NoError(t, localCache.Set("channels", "[]", nil))
+		invalidator := NewInvalidator(localCache, bus)
+		require.NoError(t, invalidator.Listen())
+		replicas = append(replicas, invalidator)
+		caches = append(caches, localCache)
+	}
+
+	replicas[1].Invalidate(InvalidationRollback, "lastUpdate:main:1.0.0")
+	for i, localCache := range caches {
+		assert.Empty(t, localCache.Get("lastUpdate:main:1.0.0"), "replica %d", i)
+		assert.Equal(t, "[]", localCache.Get("channels"), "replica %d", i)
+	}
+	require.Len(t, bus.events, 1)
+	assert.Equal(t, InvalidationRollback, bus.events[0].Reason)
+
+	// Nothing is broadcast without keys, and without a bus keys are dropped locally
+	replicas[0].Invalidate(InvalidationPublish)
+	assert.Len(t, bus.events, 1)
+	standalone := NewInvalidator(caches[2], nil)
+	require.NoError(t, standalone.Listen())
+	standalone.Invalidate(InvalidationChannels, "channels")
+	assert.Empty(t, caches[2].Get("channels"))
+	assert.Equal(t, "[]", caches[0].Get("channels"))
+}
+
+func TestUnknownInvalidationBusFallsBackToLocal(t *testing.T) {
+	t.Setenv("CACHE_INVALIDATION_BUS", "carrier-pigeon")
+	t.Setenv("CACHE_MODE", "local")
+	invalidatorOnce = sync.Once{}
+	t.Cleanup(func() { invalidatorOnce = sync.Once{} })
+	invalidator := GetInvalidator()
+	assert.Nil(t, invalidator.bus)
+	require.NoError(t, invalidator.Listen())
+}
+
+func TestInvalidationBusDefaultsToRedisWhenConfigured(t *testing.T) {
+	t.Setenv("CACHE_MODE", "local")
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("REDIS_HOST", "")
+	assert.False(t, redisConfigured())
+	t.Setenv("REDIS_URL", "redis://redis.internal:6379")
+	assert.True(t, redisConfigured())
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("CACHE_MODE", "redis")
+	assert.True(t, redisConfigured())
+}
@@ -1,58 +1,113 @@
 package cache
 
 import (
+	"container/list"
+	"expo-open-ota/internal/metrics"
 	"sync"
 	"time"
 )
 
+// defaultLocalCacheMaxBytes bounds the keys and values held in process when
+// CACHE_LOCAL_MAX_BYTES is not set.
+const defaultLocalCacheMaxBytes = 64 << 20
+
+// LocalCache is an in-process LRU cache bounded by the size of its keys and
+// values: the least recently used items are evicted to make room.
 type LocalCache struct {
-	items map[string]CacheItem
-	mu    sync.RWMutex // RWMutex for safe concurrent access
+	items    map[string]*list.Element
+	order    *list.List // most recently used first
+	size     int64
+	maxBytes int64
+	tier     string     // label of the metrics it reports
+	mu       sync.Mutex // Get reorders items, so reads lock too
 }
 
 type CacheItem struct {
+	Key        string
 	Value      string
 	Expiration *time.Time // nil if no TTL
 }
 
 func NewLocalCache() *LocalCache {
+	return NewLocalCacheWithLimit(defaultLocalCacheMaxBytes)
+}
+
+func NewLocalCacheWithLimit(maxBytes int64) *LocalCache {
 	return &LocalCache{
-		items: make(map[string]CacheItem),
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+		tier:     string(LocalCacheType),
 	}
 }
 
 func (c *LocalCache) Get(key string) string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	item, exists := c.items[key]
+	element, exists := c.items[key]
 	if !exists {
+		metrics.TrackCacheMiss(c.tier)
 		return ""
 	}
 
+	item := element.Value.(*CacheItem)
 	if item.Expiration != nil && time.Now().After(*item.Expiration) {
-		delete(c.items, key)
+		c.removeElement(element)
+		metrics.TrackCacheMiss(c.tier)
 		return ""
 	}
 
+	c.order.MoveToFront(element)
+	metrics.TrackCacheHit(c.tier)
 	return item.Value
 }
 
 func (c *LocalCache) Set(key string, value string, ttl *int) error {
+	var duration *time.Duration
+	if ttl != nil {
+		d := time.Duration(*ttl) * time.Second
+		duration = &d
+	}
+	c.setWithTTL(key, value, duration)
+	return nil
+}
+
+func (c *LocalCache) setWithTTL(key string, value string, ttl *time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+	}
+	itemSize := int64(len(key) + len(value))
+	if itemSize > c.maxBytes {
+		// Would evict everything else and still not fit
+		return
+	}
+
 	var expiration *time.Time
 	if ttl != nil {
-		exp := time.Now().Add(time.Duration(*ttl) * time.Second)
+		exp := time.Now().Add(*ttl)
 		expiration = &exp
 	}
-
-	c.items[key] = CacheItem{
+	c.items[key] = c.order.PushFront(&CacheItem{
+		Key:        key,
 		Value:      value,
 		Expiration: expiration,
+	})
+	c.size += itemSize
+
+	for c.size > c.maxBytes {
+		c.removeElement(c.order.Back())
+		metrics.TrackCacheEviction(c.tier)
 	}
-	return nil
+}
+
+func (c *LocalCache) removeElement(element *list.Element) {
+	item := c.order.Remove(element).(*CacheItem)
+	delete(c.items, item.Key)
+	c.size -= int64(len(item.Key) + len(item.Value))
 }
 
 func (c *LocalCache) Delete(key string) {
@@ -63,13 +118,16 @@ func (c *LocalCache) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// delete sur une map nil est sans danger en Go, donc pas besoin de vérifier c.items.
-	delete(c.items, key)
+	if element, exists := c.items[key]; exists {
+		c.removeElement(element)
+	}
 }
 
 func (c *LocalCache) Clear() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items = make(map[string]CacheItem)
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
 	return nil
 }
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Room for three items of 10 bytes
+	localCache := NewLocalCacheWithLimit(30)
+	for _, key := range []string{"key1", "key2", "key3"} {
+		require.NoError(t, localCache.Set(key, "value1", nil))
+	}
+	// key1 becomes the most recently used
+	assert.Equal(t, "value1", localCache.Get("key1"))
+
+	require.NoError(t, localCache.Set("key4", "value1", nil))
+	assert.Empty(t, localCache.Get("key2"))
+	assert.Equal(t, "value1", localCache.Get("key1"))
+	assert.Equal(t, "value1", localCache.Get("key3"))
+	assert.Equal(t, "value1", localCache.Get("key4"))
+	assert.Equal(t, int64(30), localCache.size)
+
+	// Replacing a value accounts for its new size
+	require.NoError(t, localCache.Set("key4", "value12345", nil))
+	assert.Equal(t, int64(24), localCache.size)
+	assert.Empty(t, localCache.Get("key1"))
+	assert.Equal(t, "value12345", localCache.Get("key4"))
+
+	// Items larger than the bound are not kept
+	require.NoError(t, localCache.Set("large", strings.Repeat("x", 40), nil))
+	assert.Empty(t, localCache.Get("large"))
+	assert.Equal(t, "value12345", localCache.Get("key4"))
+
+	localCache.Delete("key4")
+	assert.Empty(t, localCache.Get("key4"))
+	require.NoError(t, localCache.Clear())
+	assert.Equal(t, int64(0), localCache.size)
+	assert.Empty(t, localCache.Get("key1"))
+}
+
+func TestLocalCacheExpiresItems(t *testing.T) {
+	localCache := NewLocalCache()
+	expired := -1
+	require.NoError(t, localCache.Set("expired", "value", &expired))
+	assert.Empty(t, localCache.Get("expired"))
+	assert.Equal(t, int64(0), localCache.size)
+
+	ttl := time.Hour
+	localCache.setWithTTL("fresh", "value", &ttl)
+	assert.Equal(t, "value", localCache.Get("fresh"))
+}
@@ -3,47 +3,178 @@ package cache
 import (
 	"context"
 	"errors"
+	"expo-open-ota/internal/metrics"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// redisRetryDelay is how long a RedisCache serves from its fallback after a
+// Redis failure before trying Redis again.
+const redisRetryDelay = 5 * time.Second
+
+// maxPendingDeletes bounds the deletes kept to replay once Redis is back.
+const maxPendingDeletes = 10000
+
+// fallbackCacheTier labels the metrics of the fallback, so serving from it
+// while Redis is down is not mistaken for the local tier of a tiered cache.
+const fallbackCacheTier = "fallback"
+
+// RedisCache stores values in Redis, standalone, behind Sentinel or in a
+// cluster. While Redis is unreachable it serves from an in-process fallback
+// instead of failing requests; the fallback is dropped and the deletes Redis
+// missed are replayed once it is reachable again.
 type RedisCache struct {
-	client   *redis.Client
-	host     string
-	password string
-	port     string
+	client   redis.UniversalClient
+	fallback *LocalCache
+
+	mu             sync.Mutex
+	degraded       bool
+	retryAt        time.Time
+	pendingDeletes map[string]struct{}
+}
+
+// NewRedisCache returns a cache over a Redis client. It does not fail when
+// Redis is unreachable, the fallback is used until it is.
+func NewRedisCache(client redis.UniversalClient, fallback *LocalCache) *RedisCache {
+	fallback.tier = fallbackCacheTier
+	c := &RedisCache{
+		client:         client,
+		fallback:       fallback,
+		pendingDeletes: make(map[string]struct{}),
+	}
+	if err := pingRedis(client); err != nil {
+		c.markUnavailable(err)
+	}
+	return c
+}
+
+// available reports whether Redis should be tried.
+func (c *RedisCache) available() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.degraded || !time.Now().Before(c.retryAt)
 }
 
-func NewRedisCache(host, password, port string) *RedisCache {
-	client := redis.NewClient(&redis.Options{
-		Addr:     host + ":" + port,
-		Password: password,
-	})
+// observe records the outcome of a Redis call and reports whether Redis
+// answered. redis.Nil is an answer: the key is missing.
+func (c *RedisCache) observe(err error) bool {
+	if err != nil && !errors.Is(err, redis.Nil) {
+		c.markUnavailable(err)
+		return false
+	}
+	c.markAvailable()
+	return true
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (c *RedisCache) markUnavailable(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.degraded {
+		log.Printf("Redis is unreachable, serving the cache from memory: %v", err)
+	}
+	c.degraded = true
+	c.retryAt = time.Now().Add(redisRetryDelay)
+}
+
+func (c *RedisCache) markAvailable() {
+	c.mu.Lock()
+	if !c.degraded {
+		c.mu.Unlock()
+		return
+	}
+	c.degraded = false
+	pendingDeletes := c.pendingDeletes
+	c.pendingDeletes = make(map[string]struct{})
+	c.mu.Unlock()
+
+	log.Printf("Redis is reachable again, replaying %d cache deletes", len(pendingDeletes))
+	// Other instances kept writing to Redis, the fallback may be stale
+	_ = c.fallback.Clear()
+	if len(pendingDeletes) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if _, err := client.Ping(ctx).Result(); err != nil {
-		panic(err)
+	pipeline := c.client.Pipeline()
+	for key := range pendingDeletes {
+		// One command per key, keys of a cluster live in different slots
+		pipeline.Del(ctx, key)
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		log.Printf("Error replaying cache deletes on Redis: %v", err)
 	}
+}
 
-	return &RedisCache{client: client}
+func (c *RedisCache) addPendingDelete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pendingDeletes) >= maxPendingDeletes {
+		log.Printf("Too many cache deletes pending, %s stays in Redis until it expires", key)
+		return
+	}
+	c.pendingDeletes[key] = struct{}{}
 }
 
 func (c *RedisCache) Get(key string) string {
+	if !c.available() {
+		return c.fallback.Get(key)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
 	val, err := c.client.Get(ctx, key).Result()
+	if !c.observe(err) {
+		return c.fallback.Get(key)
+	}
 	if errors.Is(err, redis.Nil) {
-		return ""
-	} else if err != nil {
+		metrics.TrackCacheMiss(string(RedisCacheType))
 		return ""
 	}
+	metrics.TrackCacheHit(string(RedisCacheType))
 	return val
 }
 
+// GetWithTTL returns a value along with the time it has left to live, nil
+// when it does not expire, in a single round trip.
+func (c *RedisCache) GetWithTTL(key string) (string, *time.Duration) {
+	if !c.available() {
+		return c.fallback.Get(key), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pipeline := c.client.Pipeline()
+	getCmd := pipeline.Get(ctx, key)
+	ttlCmd := pipeline.PTTL(ctx, key)
+	// A missing key fails the pipeline with redis.Nil, read from the commands
+	_, _ = pipeline.Exec(ctx)
+
+	val, err := getCmd.Result()
+	if !c.observe(err) {
+		return c.fallback.Get(key), nil
+	}
+	if err != nil {
+		metrics.TrackCacheMiss(string(RedisCacheType))
+		return "", nil
+	}
+	metrics.TrackCacheHit(string(RedisCacheType))
+	ttl, err := ttlCmd.Result()
+	if err != nil || ttl < 0 {
+		return val, nil
+	}
+	return val, &ttl
+}
+
 func (c *RedisCache) Set(key string, value string, ttl *int) error {
+	if !c.available() {
+		return c.fallback.Set(key, value, ttl)
+	}
+
 	expiration := time.Duration(0)
 	if ttl != nil {
 		expiration = time.Duration(*ttl) * time.Second
@@ -52,19 +183,42 @@ func (c *RedisCache) Set(key string, value string, ttl *int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	return c.client.Set(ctx, key, value, expiration).Err()
+	if !c.observe(c.client.Set(ctx, key, value, expiration).Err()) {
+		return c.fallback.Set(key, value, ttl)
+	}
+	return nil
 }
 
 func (c *RedisCache) Delete(key string) {
+	c.fallback.Delete(key)
+	if !c.available() {
+		c.addPendingDelete(key)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	c.client.Del(ctx, key)
+	if !c.observe(c.client.Del(ctx, key).Err()) {
+		c.addPendingDelete(key)
+	}
 }
 
 func (c *RedisCache) Clear() error {
+	_ = c.fallback.Clear()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return c.client.FlushDB(ctx).Err()
+	var err error
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		// FLUSHDB only reaches one node of a cluster
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return master.FlushDB(ctx).Err()
+		})
+	} else {
+		err = c.client.FlushDB(ctx).Err()
+	}
+	c.observe(err)
+	return err
 }
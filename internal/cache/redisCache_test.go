@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"expo-open-ota/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useMetricsRegistry registers fresh metrics in a registry of the test.
+func useMetricsRegistry(t *testing.T) *prometheus.Registry {
+	registerer, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registry, registry
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registerer, gatherer
+	})
+	metrics.ResetMetricsForTest()
+	metrics.InitMetrics()
+	return registry
+}
+
+// cacheCounter returns the value of a cache counter for a tier.
+func cacheCounter(t *testing.T, registry *prometheus.Registry, name string, tier string) float64 {
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "tier" && label.GetValue() == tier {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestRedisCacheFallsBackWhenUnreachable(t *testing.T) {
+	registry := useMetricsRegistry(t)
+	client := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		MaxRetries:  -1,
+		DialTimeout: 100 * time.Millisecond,
+	})
+	defer client.Close()
+
+	redisCache := NewRedisCache(client, NewLocalCache())
+	assert.True(t, redisCache.degraded)
+
+	require.NoError(t, redisCache.Set("manifest", "from memory", nil))
+	assert.Equal(t, "from memory", redisCache.Get("manifest"))
+	value, ttl := redisCache.GetWithTTL("manifest")
+	assert.Equal(t, "from memory", value)
+	assert.Nil(t, ttl)
+
+	// Reads served while Redis is down are not counted as the local tier
+	assert.Equal(t, float64(2), cacheCounter(t, registry, "cache_hits_total", fallbackCacheTier))
+	assert.Zero(t, cacheCounter(t, registry, "cache_hits_total", string(LocalCacheType)))
+
+	// Deletes Redis missed are kept for when it is back
+	redisCache.Delete("manifest")
+	assert.Empty(t, redisCache.Get("manifest"))
+	assert.Contains(t, redisCache.pendingDeletes, "manifest")
+}
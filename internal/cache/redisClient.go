@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"expo-open-ota/config"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisMode is how the Redis deployment is reached.
+type RedisMode string
+
+const (
+	RedisStandalone RedisMode = "standalone"
+	RedisSentinel   RedisMode = "sentinel"
+	RedisCluster    RedisMode = "cluster"
+)
+
+// RedisConfig is where and how to connect to Redis.
+type RedisConfig struct {
+	Mode    RedisMode
+	Options *redis.UniversalOptions
+}
+
+// ParseRedisURL parses a REDIS_URL. The scheme selects the mode, rediss
+// schemes connect over TLS:
+//
+//	redis://[user:password@]host:6379[/db]
+//	rediss+sentinel://[user:password@]sentinel1:26379[/db]?master_name=mymaster&addr=sentinel2:26379
+//	rediss+cluster://[user:password@]node1:6379?addr=node2:6379
+//
+// Sentinels authenticate with the sentinel_username and sentinel_password
+// parameters. Other parameters are the ones of redis.ParseURL, such as
+// dial_timeout or pool_size.
+func ParseRedisURL(rawURL string) (*RedisConfig, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// The URL error repeats the URL, password included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	scheme, modeName, _ := strings.Cut(u.Scheme, "+")
+	if scheme != "redis" && scheme != "rediss" {
+		return nil, fmt.Errorf("invalid REDIS_URL scheme %s, expected redis or rediss", u.Scheme)
+	}
+	mode := RedisStandalone
+	switch modeName {
+	case "":
+	case string(RedisSentinel):
+		mode = RedisSentinel
+	case string(RedisCluster):
+		mode = RedisCluster
+	default:
+		return nil, fmt.Errorf("invalid REDIS_URL mode %s, expected sentinel or cluster", modeName)
+	}
+
+	// Parameters redis.ParseURL does not know are taken out first
+	query := u.Query()
+	extraAddrs := query["addr"]
+	masterName := query.Get("master_name")
+	sentinelUsername := query.Get("sentinel_username")
+	sentinelPassword := query.Get("sentinel_password")
+	for _, key := range []string{"addr", "master_name", "sentinel_username", "sentinel_password"} {
+		query.Del(key)
+	}
+	u.Scheme = scheme
+	u.RawQuery = query.Encode()
+	options, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	switch mode {
+	case RedisStandalone:
+		if len(extraAddrs) > 0 || masterName != "" {
+			return nil, errors.New("invalid REDIS_URL: addr and master_name need a sentinel or cluster scheme")
+		}
+	case RedisSentinel:
+		if masterName == "" {
+			return nil, errors.New("invalid REDIS_URL: sentinel mode needs master_name")
+		}
+	case RedisCluster:
+		if options.DB != 0 {
+			return nil, errors.New("invalid REDIS_URL: cluster mode only has database 0")
+		}
+	}
+	if options.TLSConfig != nil && mode != RedisStandalone {
+		// Certificates are checked against each node dialed, not the first one
+		options.TLSConfig.ServerName = ""
+	}
+
+	return &RedisConfig{
+		Mode: mode,
+		Options: &redis.UniversalOptions{
+			Addrs:                 append([]string{options.Addr}, extraAddrs...),
+			ClientName:            options.ClientName,
+			DB:                    options.DB,
+			Protocol:              options.Protocol,
+			Username:              options.Username,
+			Password:              options.Password,
+			SentinelUsername:      sentinelUsername,
+			SentinelPassword:      sentinelPassword,
+			MaxRetries:            options.MaxRetries,
+			MinRetryBackoff:       options.MinRetryBackoff,
+			MaxRetryBackoff:       options.MaxRetryBackoff,
+			DialTimeout:           options.DialTimeout,
+			ReadTimeout:           options.ReadTimeout,
+			WriteTimeout:          options.WriteTimeout,
+			ContextTimeoutEnabled: options.ContextTimeoutEnabled,
+			PoolFIFO:              options.PoolFIFO,
+			PoolSize:              options.PoolSize,
+			PoolTimeout:           options.PoolTimeout,
+			MinIdleConns:          options.MinIdleConns,
+			MaxIdleConns:          options.MaxIdleConns,
+			MaxActiveConns:        options.MaxActiveConns,
+			ConnMaxIdleTime:       options.ConnMaxIdleTime,
+			ConnMaxLifetime:       options.ConnMaxLifetime,
+			TLSConfig:             options.TLSConfig,
+			MasterName:            masterName,
+		},
+	}, nil
+}
+
+// LoadRedisConfig reads the Redis configuration from REDIS_URL, or from
+// REDIS_HOST, REDIS_PORT and REDIS_PASSWORD when it is not set. TLS
+// connections trust the CA of REDIS_TLS_CA_B64 or REDIS_TLS_CA_PATH when one
+// is set, the system roots otherwise.
+func LoadRedisConfig() (*RedisConfig, error) {
+	var redisConfig *RedisConfig
+	if rawURL := config.GetEnv("REDIS_URL"); rawURL != "" {
+		parsed, err := ParseRedisURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		redisConfig = parsed
+	} else {
+		redisConfig = &RedisConfig{
+			Mode: RedisStandalone,
+			Options: &redis.UniversalOptions{
+				Addrs:    []string{config.GetEnv("REDIS_HOST") + ":" + config.GetEnv("REDIS_PORT")},
+				Password: config.GetEnv("REDIS_PASSWORD"),
+			},
+		}
+	}
+
+	rootCAs, err := loadRedisCA()
+	if err != nil {
+		return nil, err
+	}
+	if rootCAs != nil {
+		if redisConfig.Options.TLSConfig == nil {
+			return nil, errors.New("a Redis CA is set but REDIS_URL does not use a rediss scheme")
+		}
+		redisConfig.Options.TLSConfig.RootCAs = rootCAs
+	}
+	return redisConfig, nil
+}
+
+func loadRedisCA() (*x509.CertPool, error) {
+	var pem []byte
+	if encoded := config.GetEnv("REDIS_TLS_CA_B64"); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding REDIS_TLS_CA_B64: %w", err)
+		}
+		pem = decoded
+	} else if caPath := config.GetEnv("REDIS_TLS_CA_PATH"); caPath != "" {
+		content, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading REDIS_TLS_CA_PATH: %w", err)
+		}
+		pem = content
+	} else {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM certificate found in the Redis CA")
+	}
+	return pool, nil
+}
+
+// NewClient returns a client for the deployment. It connects lazily.
+func (c *RedisConfig) NewClient() redis.UniversalClient {
+	switch c.Mode {
+	case RedisSentinel:
+		return redis.NewFailoverClient(c.Options.Failover())
+	case RedisCluster:
+		return redis.NewClusterClient(c.Options.Cluster())
+	}
+	return redis.NewClient(c.Options.Simple())
+}
+
+func pingRedis(client redis.UniversalClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return client.Ping(ctx).Err()
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"expo-open-ota/config"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultInvalidationChannel = "expo-open-ota:cache-invalidation"
+
+// RedisInvalidationBus broadcasts invalidation events on a Redis pub/sub
+// channel. Subscribers reconnect on their own after a connection loss.
+type RedisInvalidationBus struct {
+	client  redis.UniversalClient
+	channel string
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+}
+
+func init() {
+	RegisterInvalidationBus("redis", func() (InvalidationBus, error) {
+		channel := config.GetEnv("CACHE_INVALIDATION_CHANNEL")
+		if channel == "" {
+			channel = defaultInvalidationChannel
+		}
+		// The cache client is shared when the cache itself is in Redis
+		switch resolvedCache := GetCache().(type) {
+		case *RedisCache:
+			return NewRedisInvalidationBus(resolvedCache.client, channel), nil
+		case *TieredCache:
+			if redisCache, ok := resolvedCache.remote.(*RedisCache); ok {
+				return NewRedisInvalidationBus(redisCache.client, channel), nil
+			}
+		}
+		redisConfig, err := LoadRedisConfig()
+		if err != nil {
+			return nil, err
+		}
+		client := redisConfig.NewClient()
+		if err := pingRedis(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return NewRedisInvalidationBus(client, channel), nil
+	})
+}
+
+func NewRedisInvalidationBus(client redis.UniversalClient, channel string) *RedisInvalidationBus {
+	return &RedisInvalidationBus{client: client, channel: channel}
+}
+
+func (b *RedisInvalidationBus) Publish(event InvalidationEvent) error {
+	payload, err := encodeInvalidationEvent(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+func (b *RedisInvalidationBus) Subscribe(handler func(InvalidationEvent)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	// Wait for the confirmation so events published from now on are received
+	if _, err := pubsub.Receive(ctx); err != nil {
+		// The channel below keeps reconnecting until Redis is back
+		log.Printf("Redis unreachable, subscribing to %s once it is back: %v", b.channel, err)
+	}
+	b.mu.Lock()
+	b.pubsub = pubsub
+	b.mu.Unlock()
+
+	go func() {
+		for message := range pubsub.Channel() {
+			event, err := decodeInvalidationEvent(message.Payload)
+			if err != nil {
+				log.Printf("Ignoring malformed cache invalidation on %s: %v", b.channel, err)
+				continue
+			}
+			handler(event)
+		}
+	}()
+	return nil
+}
+
+func (b *RedisInvalidationBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pubsub == nil {
+		return nil
+	}
+	err := b.pubsub.Close()
+	b.pubsub = nil
+	return err
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"time"
+)
+
+// defaultLocalTTL bounds how long a value read from Redis is reused in process
+// when CACHE_LOCAL_TTL is not set.
+const defaultLocalTTL = 30 * time.Second
+
+// remoteCache is a cache shared by every instance that tells how long its
+// values have left to live.
+type remoteCache interface {
+	Cache
+	GetWithTTL(key string) (string, *time.Duration)
+}
+
+// TieredCache keeps recently used values in a bounded in-process LRU in front
+// of Redis, so most reads skip the network round trip. A local copy never
+// outlives the Redis value and lives at most localTTL, which bounds how stale
+// an instance can be when it misses an invalidation.
+type TieredCache struct {
+	local    *LocalCache
+	remote   remoteCache
+	localTTL time.Duration
+}
+
+func NewTieredCache(local *LocalCache, remote remoteCache, localTTL time.Duration) *TieredCache {
+	return &TieredCache{
+		local:    local,
+		remote:   remote,
+		localTTL: localTTL,
+	}
+}
+
+func (c *TieredCache) Get(key string) string {
+	if value := c.local.Get(key); value != "" {
+		return value
+	}
+	value, ttl := c.remote.GetWithTTL(key)
+	if value == "" {
+		return ""
+	}
+	c.local.setWithTTL(key, value, c.localTTLFor(ttl))
+	return value
+}
+
+func (c *TieredCache) Set(key string, value string, ttl *int) error {
+	if err := c.remote.Set(key, value, ttl); err != nil {
+		c.local.Delete(key)
+		return err
+	}
+	var remoteTTL *time.Duration
+	if ttl != nil {
+		d := time.Duration(*ttl) * time.Second
+		remoteTTL = &d
+	}
+	c.local.setWithTTL(key, value, c.localTTLFor(remoteTTL))
+	return nil
+}
+
+// localTTLFor is how long a value living remoteTTL in Redis is kept locally.
+func (c *TieredCache) localTTLFor(remoteTTL *time.Duration) *time.Duration {
+	ttl := c.localTTL
+	if remoteTTL != nil && *remoteTTL < ttl {
+		ttl = *remoteTTL
+	}
+	return &ttl
+}
+
+func (c *TieredCache) Delete(key string) {
+	c.local.Delete(key)
+	c.remote.Delete(key)
+}
+
+// DeleteLocal drops a key from the in-process tier only.
+func (c *TieredCache) DeleteLocal(key string) {
+	c.local.Delete(key)
+}
+
+func (c *TieredCache) Clear() error {
+	_ = c.local.Clear()
+	return c.remote.Clear()
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemote stands for Redis, counting the reads reaching it.
+type fakeRemote struct {
+	*LocalCache
+	ttls  map[string]*time.Duration
+	reads int
+}
+
+func newFakeRemote() *fakeRemote {
+	remote := &fakeRemote{LocalCache: NewLocalCache(), ttls: map[string]*time.Duration{}}
+	remote.tier = string(RedisCacheType)
+	return remote
+}
+
+func (r *fakeRemote) Set(key string, value string, ttl *int) error {
+	if ttl != nil {
+		d := time.Duration(*ttl) * time.Second
+		r.ttls[key] = &d
+	}
+	return r.LocalCache.Set(key, value, ttl)
+}
+
+func (r *fakeRemote) GetWithTTL(key string) (string, *time.Duration) {
+	r.reads++
+	return r.LocalCache.Get(key), r.ttls[key]
+}
+
+func TestTieredCacheServesReadsInProcess(t *testing.T) {
+	registry := useMetricsRegistry(t)
+	remote := newFakeRemote()
+	tiered := NewTieredCache(NewLocalCache(), remote, time.Minute)
+
+	require.NoError(t, remote.Set("metadata", "from redis", nil))
+	assert.Equal(t, "from redis", tiered.Get("metadata"))
+	assert.Equal(t, "from redis", tiered.Get("metadata"))
+	assert.Equal(t, 1, remote.reads)
+	assert.Equal(t, float64(1), cacheCounter(t, registry, "cache_hits_total", string(LocalCacheType)))
+	assert.Zero(t, cacheCounter(t, registry, "cache_hits_total", fallbackCacheTier))
+
+	require.NoError(t, tiered.Set("manifest", "written", nil))
+	assert.Equal(t, "written", tiered.Get("manifest"))
+	assert.Equal(t, "written", remote.LocalCache.Get("manifest"))
+	assert.Equal(t, 1, remote.reads)
+
+	// Another instance invalidated the key: only the local copy is dropped here
+	tiered.DeleteLocal("metadata")
+	assert.Equal(t, "from redis", tiered.Get("metadata"))
+	assert.Equal(t, 2, remote.reads)
+
+	tiered.Delete("manifest")
+	assert.Empty(t, remote.LocalCache.Get("manifest"))
+	assert.Empty(t, tiered.Get("manifest"))
+}
+
+func TestTieredCacheLocalCopiesRespectBothTTLs(t *testing.T) {
+	tiered := NewTieredCache(NewLocalCache(), newFakeRemote(), time.Minute)
+
+	short, long := 10*time.Second, time.Hour
+	assert.Equal(t, short, *tiered.localTTLFor(&short))
+	assert.Equal(t, time.Minute, *tiered.localTTLFor(&long))
+	assert.Equal(t, time.Minute, *tiered.localTTLFor(nil))
+
+	ttl := 10
+	require.NoError(t, tiered.Set("lastUpdate", "1700000000000", &ttl))
+	element := tiered.local.items["lastUpdate"]
+	require.NotNil(t, element)
+	expiration := element.Value.(*CacheItem).Expiration
+	require.NotNil(t, expiration)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), *expiration, time.Second)
+}
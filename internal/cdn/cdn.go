@@ -1,24 +1,88 @@
 package cdn
 
-import "sync"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"expo-open-ota/config"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
+// CDN signs the URLs clients are redirected to for the files of an update.
 type CDN interface {
-	isCDNAvailable() bool
-	ComputeRedirectionURLForAsset(branch, runtimeVersion, updateId, asset string) (string, error)
+	// IsAvailable reports whether the configuration of the CDN is complete.
+	IsAvailable() bool
+	// ComputeRedirectionURLForObject signs a URL for the object stored under
+	// key, relative to the root of the bucket the CDN has as origin.
+	ComputeRedirectionURLForObject(key string) (string, error)
 }
 
+// Provider builds a CDN from the configuration.
+type Provider func() CDN
+
+// signedURLValidity is how long the redirection URLs stay valid.
+const signedURLValidity = 10 * time.Minute
+
 var (
 	cdnInstance CDN
 	once        sync.Once
+
+	providersMutex sync.RWMutex
+	providers      = map[string]Provider{}
 )
 
+// Register makes a CDN provider selectable with CDN_PROVIDER.
+func Register(name string, provider Provider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	providers[name] = provider
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupProvider(name string) (Provider, bool) {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// GetCDN returns the CDN selected by CDN_PROVIDER, or nil when none is
+// configured. Without CDN_PROVIDER, CloudFront is used when its configuration
+// is complete.
 func GetCDN() CDN {
 	once.Do(func() {
-		cloudfrontCDN := CloudfrontCDN{}
-		isCloudfrontCDNavailable := (&cloudfrontCDN).isCDNAvailable()
-		if isCloudfrontCDNavailable {
-			cdnInstance = &cloudfrontCDN
+		name := strings.ToLower(config.GetEnv("CDN_PROVIDER"))
+		if name == "" {
+			name = "cloudfront"
+		}
+		provider, ok := lookupProvider(name)
+		if !ok {
+			log.Printf("Unknown CDN_PROVIDER %s, available providers: %s", name, strings.Join(Providers(), ", "))
+			return
+		}
+		resolvedCDN := provider()
+		if !resolvedCDN.IsAvailable() {
+			if config.GetEnv("CDN_PROVIDER") != "" {
+				log.Printf("CDN provider %s is not fully configured, assets are served directly", name)
+			}
+			return
 		}
+		cdnInstance = resolvedCDN
 	})
 	return cdnInstance
 }
@@ -27,3 +91,19 @@ func ResetCDNInstance() {
 	cdnInstance = nil
 	once = sync.Once{}
 }
+
+// objectPath is the escaped URL path of a bucket object on a CDN whose origin
+// is the bucket.
+func objectPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func hmacSHA256(secret string, message string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
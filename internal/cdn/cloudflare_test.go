@@ -0,0 +1,44 @@
+package cdn
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudflareSignsTimedToken(t *testing.T) {
+	t.Setenv("CLOUDFLARE_DOMAIN", "https://assets.example.com/")
+	t.Setenv("CLOUDFLARE_TOKEN_SECRET", "cloudflare-secret")
+	t.Setenv("CLOUDFLARE_TOKEN_PARAM", "")
+	cloudflare := NewCloudflareCDN()
+	require.True(t, cloudflare.IsAvailable())
+	assert.Equal(t, "verify", cloudflare.TokenParam)
+
+	signed := cloudflare.signURL(objectPath("main/1.0.0/1700000000000/bundles/ios.js"), time.Unix(1700000000, 0))
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "assets.example.com", parsed.Host)
+	assert.Equal(t, "/main/1.0.0/1700000000000/bundles/ios.js", parsed.Path)
+	assert.Equal(t, "1700000000-/Dji9jr5R5vrqdyDwX6P69hq01hrnbQ7sCYY4u99qk8=", parsed.Query().Get("verify"))
+
+	contentKey := "_ota/assets/2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	redirect, err := cloudflare.ComputeRedirectionURLForObject(contentKey)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(redirect, "https://assets.example.com/"+contentKey+"?verify="))
+	// The token carries the expiry, not the signing time
+	parsed, err = url.Parse(redirect)
+	require.NoError(t, err)
+	timestamp, _, _ := strings.Cut(parsed.Query().Get("verify"), "-")
+	expiresAt, err := strconv.ParseInt(timestamp, 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(signedURLValidity), time.Unix(expiresAt, 0), 5*time.Second)
+
+	cloudflare.Secret = ""
+	_, err = cloudflare.ComputeRedirectionURLForObject(contentKey)
+	assert.Error(t, err)
+}
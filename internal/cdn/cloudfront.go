@@ -8,11 +8,17 @@ import (
 	"expo-open-ota/internal/keyStore"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+	"strings"
 	"time"
 )
 
+// CloudfrontCDN signs CloudFront URLs with a canned policy.
 type CloudfrontCDN struct{}
 
+func init() {
+	Register("cloudfront", func() CDN { return &CloudfrontCDN{} })
+}
+
 func getCloudfrontDomain() string {
 	return config.GetEnv("CLOUDFRONT_DOMAIN")
 }
@@ -21,7 +27,7 @@ func getCloudfrontKeyPairId() string {
 	return config.GetEnv("CLOUDFRONT_KEY_PAIR_ID")
 }
 
-func (c *CloudfrontCDN) isCDNAvailable() bool {
+func (c *CloudfrontCDN) IsAvailable() bool {
 	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey()
 	domain := getCloudfrontDomain()
 	keyPairId := getCloudfrontKeyPairId()
@@ -40,7 +46,7 @@ func getSigner(key string) (crypto.Signer, error) {
 	return privateKey, nil
 }
 
-func (c *CloudfrontCDN) ComputeRedirectionURLForAsset(branch, runtimeVersion, updateId, asset string) (string, error) {
+func (c *CloudfrontCDN) ComputeRedirectionURLForObject(key string) (string, error) {
 	domain := getCloudfrontDomain()
 	keyPairId := getCloudfrontKeyPairId()
 	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey()
@@ -54,10 +60,9 @@ func (c *CloudfrontCDN) ComputeRedirectionURLForAsset(branch, runtimeVersion, up
 		return "", fmt.Errorf("error parsing private key: %w", err)
 	}
 
-	endpoint := fmt.Sprintf("%s/%s/%s/%s", branch, runtimeVersion, updateId, asset)
-	resource := fmt.Sprintf("%s/%s", domain, endpoint)
+	resource := strings.TrimSuffix(domain, "/") + objectPath(key)
 
-	policy := sign.NewCannedPolicy(resource, time.Now().Add(10*time.Minute))
+	policy := sign.NewCannedPolicy(resource, time.Now().Add(signedURLValidity))
 	signer := sign.NewURLSigner(keyPairId, privateKey)
 	signedUrl, err := signer.SignWithPolicy(resource, policy)
 	return signedUrl, err
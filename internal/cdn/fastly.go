@@ -0,0 +1,49 @@
+package cdn
+
+import (
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/config"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FastlyCDN signs URLs for Fastly token validation. The token parameter holds
+// the expiry time and a hex HMAC-SHA256 of the path followed by that time,
+// separated by an underscore.
+type FastlyCDN struct {
+	Domain string
+	Secret string
+}
+
+func init() {
+	Register("fastly", func() CDN { return NewFastlyCDN() })
+}
+
+func NewFastlyCDN() *FastlyCDN {
+	return &FastlyCDN{
+		Domain: config.GetEnv("FASTLY_DOMAIN"),
+		Secret: config.GetEnv("FASTLY_TOKEN_SECRET"),
+	}
+}
+
+func (c *FastlyCDN) IsAvailable() bool {
+	return c.Domain != "" && c.Secret != ""
+}
+
+func (c *FastlyCDN) ComputeRedirectionURLForObject(key string) (string, error) {
+	if !c.IsAvailable() {
+		return "", errors.New("Fastly configuration is incomplete")
+	}
+	return c.signURL(objectPath(key), time.Now().Add(signedURLValidity)), nil
+}
+
+func (c *FastlyCDN) signURL(path string, expiresAt time.Time) string {
+	expiration := strconv.FormatInt(expiresAt.Unix(), 10)
+	signature := hex.EncodeToString(hmacSHA256(c.Secret, path+expiration))
+	query := url.Values{}
+	query.Set("token", expiration+"_"+signature)
+	return strings.TrimSuffix(c.Domain, "/") + path + "?" + query.Encode()
+}
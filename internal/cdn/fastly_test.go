@@ -0,0 +1,26 @@
+package cdn
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFastlySignsExpiringToken(t *testing.T) {
+	t.Setenv("FASTLY_DOMAIN", "https://ota.global.ssl.fastly.net")
+	t.Setenv("FASTLY_TOKEN_SECRET", "fastly-secret")
+	fastly := NewFastlyCDN()
+	require.True(t, fastly.IsAvailable())
+
+	signed := fastly.signURL(objectPath("main/1.0.0/1700000000000/bundles/ios.js"), time.Unix(1700000600, 0))
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/main/1.0.0/1700000000000/bundles/ios.js", parsed.Path)
+	assert.Equal(t, "1700000600_cb0b3a2b235b91e7010db52c18d5910e48073119324394031a5b257fee62de82", parsed.Query().Get("token"))
+
+	t.Setenv("FASTLY_TOKEN_SECRET", "")
+	assert.False(t, NewFastlyCDN().IsAvailable())
+}
@@ -0,0 +1,50 @@
+package cdn
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACSignsVerifiableURL(t *testing.T) {
+	t.Setenv("CDN_HMAC_DOMAIN", "https://edge.example.com")
+	t.Setenv("CDN_HMAC_SECRET", "edge-secret")
+	edge := NewHMACCDN()
+	require.True(t, edge.IsAvailable())
+
+	path := objectPath("main/1.0.0/1700000000000/bundles/ios.js")
+	signed := edge.signURL(path, time.Unix(1700000600, 0))
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	expires := parsed.Query().Get("expires")
+	signature := parsed.Query().Get("signature")
+	assert.Equal(t, "1700000600", expires)
+	assert.Equal(t, "cdd49ab059abdde0d4324ffb0833094e25d3489db216a00a4a7784ada84384e6", signature)
+
+	assert.True(t, VerifyHMACSignature("edge-secret", path, expires, signature, time.Unix(1700000000, 0)))
+	assert.False(t, VerifyHMACSignature("edge-secret", path, expires, signature, time.Unix(1700000601, 0)))
+	assert.False(t, VerifyHMACSignature("other-secret", path, expires, signature, time.Unix(1700000000, 0)))
+	assert.False(t, VerifyHMACSignature("edge-secret", "/main/1.0.0/1700000000000/bundles/android.js", expires, signature, time.Unix(1700000000, 0)))
+	assert.False(t, VerifyHMACSignature("edge-secret", path, "1700000900", signature, time.Unix(1700000000, 0)))
+}
+
+func TestGetCDNSelectsProvider(t *testing.T) {
+	t.Setenv("CDN_PROVIDER", "HMAC")
+	t.Setenv("CDN_HMAC_DOMAIN", "https://edge.example.com")
+	t.Setenv("CDN_HMAC_SECRET", "edge-secret")
+	ResetCDNInstance()
+	t.Cleanup(ResetCDNInstance)
+	assert.IsType(t, &HMACCDN{}, GetCDN())
+	assert.Equal(t, []string{"cloudflare", "cloudfront", "fastly", "hmac"}, Providers())
+
+	t.Setenv("CDN_PROVIDER", "unknown")
+	ResetCDNInstance()
+	assert.Nil(t, GetCDN())
+
+	t.Setenv("CDN_PROVIDER", "fastly")
+	ResetCDNInstance()
+	assert.Nil(t, GetCDN())
+}
@@ -0,0 +1,266 @@
+package channel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const registryObjectKey = "channels.json"
+
+var (
+	ErrChannelNotFound      = errors.New("channel not found")
+	ErrChannelAlreadyExists = errors.New("channel already exists")
+	ErrInvalidChannel       = errors.New("channel name and branch are required")
+	ErrInvalidBranchWeights = errors.New("branch weights must be positive and branches unique")
+	ErrRegistryConflict     = errors.New("channels were modified concurrently, retry")
+)
+
+// BranchWeight is the share of a channel's clients served by a branch. Weights
+// are relative to the sum of all the channel's weights.
+type BranchWeight struct {
+	Branch string `json:"branch"`
+	Weight int    `json:"weight"`
+}
+
+type Channel struct {
+	Name string `json:"name"`
+	// Branch is served to every client when Branches is empty, and to clients
+	// that cannot be identified otherwise.
+	Branch    string         `json:"branch"`
+	Branches  []BranchWeight `json:"branches,omitempty"`
+	CreatedAt string         `json:"createdAt"`
+	UpdatedAt string         `json:"updatedAt"`
+}
+
+func ComputeChannelsCacheKey() string {
+	return "channels:registry"
+}
+
+func loadRegistry() ([]Channel, error) {
+	cache := cache2.GetCache()
+	if cachedValue := cache.Get(ComputeChannelsCacheKey()); cachedValue != "" {
+		var channels []Channel
+		if err := json.Unmarshal([]byte(cachedValue), &channels); err == nil {
+			return channels, nil
+		}
+	}
+
+	resolvedBucket := bucket.GetBucket()
+	channels := []Channel{}
+	object, err := resolvedBucket.GetObject(registryObjectKey)
+	if err != nil && !errors.Is(err, bucket.ErrObjectNotFound) {
+		return nil, fmt.Errorf("error reading channel registry: %w", err)
+	}
+	if err == nil {
+		defer object.Close()
+		if err := json.NewDecoder(object).Decode(&channels); err != nil {
+			return nil, fmt.Errorf("error decoding channel registry: %w", err)
+		}
+	}
+
+	cacheValue, err := json.Marshal(channels)
+	if err == nil {
+		_ = cache.Set(ComputeChannelsCacheKey(), string(cacheValue), nil)
+	}
+	return channels, nil
+}
+
+// readRegistryVersion reads the registry from the bucket, bypassing the
+// cache, along with the version its edits are saved against. The version is
+// empty while the registry does not exist.
+func readRegistryVersion() ([]Channel, string, error) {
+	channels := []Channel{}
+	object, version, err := bucket.GetBucket().GetObjectWithVersion(registryObjectKey)
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return channels, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading channel registry: %w", err)
+	}
+	defer object.Close()
+	if err := json.NewDecoder(object).Decode(&channels); err != nil {
+		return nil, "", fmt.Errorf("error decoding channel registry: %w", err)
+	}
+	return channels, version, nil
+}
+
+// saveRegistry writes the registry only if it is still at version, so edits
+// made meanwhile by any replica are never overwritten. It returns
+// ErrRegistryConflict otherwise.
+func saveRegistry(channels []Channel, version string) error {
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+	content, err := json.Marshal(channels)
+	if err != nil {
+		return fmt.Errorf("error marshalling channel registry: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	err = resolvedBucket.PutObjectIfVersion(registryObjectKey, bytes.NewReader(content), version)
+	if errors.Is(err, bucket.ErrVersionConflict) {
+		return ErrRegistryConflict
+	}
+	if err != nil {
+		return fmt.Errorf("error saving channel registry: %w", err)
+	}
+	cache2.Invalidate(cache2.InvalidationChannels, ComputeChannelsCacheKey())
+	return nil
+}
+
+func GetChannels() ([]Channel, error) {
+	return loadRegistry()
+}
+
+func GetChannel(name string) (*Channel, error) {
+	channels, err := loadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.Name == name {
+			return &channel, nil
+		}
+	}
+	return nil, ErrChannelNotFound
+}
+
+func CreateChannel(name string, branch string, branches []BranchWeight) (*Channel, error) {
+	branch, err := validateBranches(name, branch, branches)
+	if err != nil {
+		return nil, err
+	}
+	channels, version, err := readRegistryVersion()
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.Name == name {
+			return nil, ErrChannelAlreadyExists
+		}
+	}
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	channel := Channel{
+		Name:      name,
+		Branch:    branch,
+		Branches:  branches,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := saveRegistry(append(channels, channel), version); err != nil {
+		return nil, err
+	}
+	log.Printf("Channel %s created, pointing at branch %s", name, branch)
+	return &channel, nil
+}
+
+// UpdateChannel repoints an existing channel at another branch, or at
+// several weighted branches.
+func UpdateChannel(name string, branch string, branches []BranchWeight) (*Channel, error) {
+	branch, err := validateBranches(name, branch, branches)
+	if err != nil {
+		return nil, err
+	}
+	channels, version, err := readRegistryVersion()
+	if err != nil {
+		return nil, err
+	}
+	for i := range channels {
+		if channels[i].Name != name {
+			continue
+		}
+		previousBranch := channels[i].Branch
+		channels[i].Branch = branch
+		channels[i].Branches = branches
+		channels[i].UpdatedAt = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		if err := saveRegistry(channels, version); err != nil {
+			return nil, err
+		}
+		log.Printf("Channel %s repointed from branch %s to %s", name, previousBranch, branch)
+		return &channels[i], nil
+	}
+	return nil, ErrChannelNotFound
+}
+
+func DeleteChannel(name string) error {
+	channels, version, err := readRegistryVersion()
+	if err != nil {
+		return err
+	}
+	for i := range channels {
+		if channels[i].Name == name {
+			if err := saveRegistry(append(channels[:i], channels[i+1:]...), version); err != nil {
+				return err
+			}
+			log.Printf("Channel %s deleted", name)
+			return nil
+		}
+	}
+	return ErrChannelNotFound
+}
+
+func validateBranches(name string, branch string, branches []BranchWeight) (string, error) {
+	if name == "" {
+		return "", ErrInvalidChannel
+	}
+	seen := map[string]bool{}
+	for _, branchWeight := range branches {
+		if branchWeight.Branch == "" || branchWeight.Weight <= 0 || seen[branchWeight.Branch] {
+			return "", ErrInvalidBranchWeights
+		}
+		seen[branchWeight.Branch] = true
+	}
+	if branch == "" && len(branches) > 0 {
+		branch = branches[0].Branch
+	}
+	if branch == "" {
+		return "", ErrInvalidChannel
+	}
+	return branch, nil
+}
+
+// SelectBranch picks the branch serving a client. The choice only depends on
+// the channel and the client key, so a client sticks to its branch as long as
+// the weights do not change.
+func SelectBranch(channel Channel, clientKey string) string {
+	if len(channel.Branches) == 0 || clientKey == "" {
+		return channel.Branch
+	}
+	totalWeight := 0
+	for _, branchWeight := range channel.Branches {
+		totalWeight += branchWeight.Weight
+	}
+	if totalWeight <= 0 {
+		return channel.Branch
+	}
+	sum := sha256.Sum256([]byte(channel.Name + ":" + clientKey))
+	position := int(binary.BigEndian.Uint64(sum[:8]) % uint64(totalWeight))
+	for _, branchWeight := range channel.Branches {
+		if position < branchWeight.Weight {
+			return branchWeight.Branch
+		}
+		position -= branchWeight.Weight
+	}
+	return channel.Branch
+}
+
+// ResolveBranch returns the branch a channel serves to the given client, or an
+// empty string when the channel is not registered.
+func ResolveBranch(channelName string, clientKey string) (string, error) {
+	channel, err := GetChannel(channelName)
+	if errors.Is(err, ErrChannelNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return SelectBranch(*channel, clientKey), nil
+}
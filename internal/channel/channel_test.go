@@ -0,0 +1,85 @@
+package channel
+
+import (
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectBranchWithoutWeights(t *testing.T) {
+	channel := Channel{Name: "production", Branch: "main"}
+	assert.Equal(t, "main", SelectBranch(channel, "client-1"))
+}
+
+func TestSelectBranchIsStickyAndWeighted(t *testing.T) {
+	channel := Channel{
+		Name:   "production",
+		Branch: "main",
+		Branches: []BranchWeight{
+			{Branch: "main", Weight: 90},
+			{Branch: "experiment", Weight: 10},
+		},
+	}
+	experiment := 0
+	for i := 0; i < 10000; i++ {
+		clientKey := fmt.Sprintf("client-%d", i)
+		selected := SelectBranch(channel, clientKey)
+		assert.Equal(t, selected, SelectBranch(channel, clientKey))
+		if selected == "experiment" {
+			experiment++
+		}
+	}
+	assert.InDelta(t, 1000, experiment, 150)
+}
+
+func TestSelectBranchWithoutClientKey(t *testing.T) {
+	channel := Channel{
+		Name:     "production",
+		Branch:   "main",
+		Branches: []BranchWeight{{Branch: "experiment", Weight: 50}, {Branch: "main", Weight: 50}},
+	}
+	assert.Equal(t, "main", SelectBranch(channel, ""))
+}
+
+func TestValidateBranches(t *testing.T) {
+	branch, err := validateBranches("production", "", []BranchWeight{{Branch: "main", Weight: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, "main", branch)
+
+	_, err = validateBranches("production", "", []BranchWeight{{Branch: "main", Weight: 0}})
+	assert.ErrorIs(t, err, ErrInvalidBranchWeights)
+
+	_, err = validateBranches("production", "", []BranchWeight{{Branch: "main", Weight: 1}, {Branch: "main", Weight: 2}})
+	assert.ErrorIs(t, err, ErrInvalidBranchWeights)
+
+	_, err = validateBranches("production", "", nil)
+	assert.ErrorIs(t, err, ErrInvalidChannel)
+}
+
+func TestSaveRegistryRejectsEditsOfAStaleRegistry(t *testing.T) {
+	t.Setenv("BUCKET_TYPE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	bucket.ResetBucketInstance()
+	t.Cleanup(bucket.ResetBucketInstance)
+	_ = cache2.GetCache().Clear()
+
+	_, err := CreateChannel("production", "main", nil)
+	require.NoError(t, err)
+	channels, version, err := readRegistryVersion()
+	require.NoError(t, err)
+
+	// Another replica edits the registry between our read and our write
+	_, err = CreateChannel("staging", "develop", nil)
+	require.NoError(t, err)
+	err = saveRegistry(append(channels, Channel{Name: "preview", Branch: "preview"}), version)
+	assert.ErrorIs(t, err, ErrRegistryConflict)
+
+	_, err = GetChannel("staging")
+	assert.NoError(t, err)
+	_, err = GetChannel("preview")
+	assert.ErrorIs(t, err, ErrChannelNotFound)
+}
@@ -2,55 +2,78 @@ package compression
 
 import (
 	"compress/gzip"
+	"fmt"
 	"github.com/andybalholm/brotli"
-	"log"
+	"io"
 	"net/http"
 	"strings"
 )
 
-func compressWithGzip(w http.ResponseWriter, data []byte, requestID string) error {
-	w.Header().Set("Content-Encoding", "gzip")
-	gz := gzip.NewWriter(w)
-	defer gz.Close()
+// Encodings are the content encodings assets are precompressed with,
+// preferred first.
+var Encodings = []string{"br", "gzip"}
 
-	_, err := gz.Write(data)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error compressing with Gzip: %v", requestID, err)
+// Variants are compressed while the client waits for its update to be marked
+// as uploaded. Quality 7 keeps most of the ratio of the best quality at a
+// fraction of its time on multi-megabyte bundles.
+const brotliQuality = 7
+
+// IsCompressible reports whether assets of a content type are worth
+// compressing, images and fonts already are.
+func IsCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(mediaType) {
+	case "application/javascript", "text/javascript", "application/json", "image/svg+xml":
+		return true
 	}
-	return err
+	return strings.HasPrefix(mediaType, "text/")
 }
 
-func compressWithBrotli(w http.ResponseWriter, data []byte, requestID string) error {
-	w.Header().Set("Content-Encoding", "br")
-	br := brotli.NewWriter(w)
-	defer br.Close()
-
-	_, err := br.Write(data)
-	if err != nil {
-		log.Printf("[RequestID: %s] Error compressing with Brotli: %v", requestID, err)
+// FileExtension is the suffix of the objects holding variants in an encoding.
+func FileExtension(encoding string) string {
+	if encoding == "gzip" {
+		return ".gz"
 	}
-	return err
+	return "." + encoding
 }
 
-func ServeCompressedAsset(w http.ResponseWriter, r *http.Request, data []byte, contentType, requestID string) {
-	w.Header().Set("Content-Type", contentType)
-	acceptEncoding := r.Header.Get("Accept-Encoding")
-	log.Printf("[RequestID: %s] Serving asset with content type: %s", requestID, contentType)
-
-	if strings.Contains(acceptEncoding, "br") {
-		if err := compressWithBrotli(w, data, requestID); err != nil {
-			http.Error(w, "Error compressing with Brotli", http.StatusInternalServerError)
-			return
+// NegotiateEncodings returns the Encodings a request accepts, preferred first.
+func NegotiateEncodings(r *http.Request) []string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
 		}
-	} else if strings.Contains(acceptEncoding, "gzip") {
-		if err := compressWithGzip(w, data, requestID); err != nil {
-			http.Error(w, "Error compressing with Gzip", http.StatusInternalServerError)
-			return
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	encodings := []string{}
+	for _, encoding := range Encodings {
+		if accepted[encoding] {
+			encodings = append(encodings, encoding)
 		}
-	} else {
-		_, err := w.Write(data)
+	}
+	return encodings
+}
+
+// Compress writes content to w compressed with one of the Encodings.
+func Compress(w io.Writer, content io.Reader, encoding string) error {
+	var writer io.WriteCloser
+	switch encoding {
+	case "br":
+		writer = brotli.NewWriterLevel(w, brotliQuality)
+	case "gzip":
+		gzipWriter, err := gzip.NewWriterLevel(w, gzip.BestCompression)
 		if err != nil {
-			log.Printf("[RequestID: %s] Error writing uncompressed response: %v", requestID, err)
+			return err
 		}
+		writer = gzipWriter
+	default:
+		return fmt.Errorf("unsupported encoding %s", encoding)
+	}
+	if _, err := io.Copy(writer, content); err != nil {
+		writer.Close()
+		return fmt.Errorf("error compressing with %s: %w", encoding, err)
 	}
+	return writer.Close()
 }
@@ -0,0 +1,51 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncodings(t *testing.T) {
+	for acceptEncoding, expected := range map[string][]string{
+		"":                     {},
+		"gzip, deflate, br":    {"br", "gzip"},
+		"gzip":                 {"gzip"},
+		"br;q=0, gzip;q=0.5":   {"gzip"},
+		"identity, GZIP; q=1":  {"gzip"},
+		"deflate, br ; q = 0 ": {},
+	} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+		assert.Equal(t, expected, NegotiateEncodings(request), acceptEncoding)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	content := strings.Repeat("var bundle = 1;\n", 100)
+
+	var compressed bytes.Buffer
+	require.NoError(t, Compress(&compressed, strings.NewReader(content), "br"))
+	decompressed, err := io.ReadAll(brotli.NewReader(&compressed))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decompressed))
+
+	compressed.Reset()
+	require.NoError(t, Compress(&compressed, strings.NewReader(content), "gzip"))
+	reader, err := gzip.NewReader(&compressed)
+	require.NoError(t, err)
+	decompressed, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decompressed))
+
+	assert.Error(t, Compress(&compressed, strings.NewReader(content), "deflate"))
+	assert.Equal(t, ".gz", FileExtension("gzip"))
+	assert.Equal(t, ".br", FileExtension("br"))
+}
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// expoProjectInformationOID is the extension binding a code signing
+// certificate to an Expo project, as "projectId,scopeKey".
+var expoProjectInformationOID = asn1.ObjectIdentifier{1, 2, 840, 113556, 1, 8000, 2554, 43437, 254, 128, 102, 157, 7894389, 20439, 2, 1}
+
+type CertificateOptions struct {
+	CommonName string
+	Validity   time.Duration
+	// KeyType is one of "rsa", "ecdsa" or "ed25519"
+	KeyType string
+	// ProjectId and ScopeKey are written in the signing certificate when set
+	ProjectId string
+	ScopeKey  string
+}
+
+// CodeSigningCertificates is a root certificate, embedded in the app, and the
+// code signing certificate it issued, whose key signs the manifests.
+type CodeSigningCertificates struct {
+	RootCertificatePEM    string
+	RootPrivateKeyPEM     string
+	SigningCertificatePEM string
+	SigningPrivateKeyPEM  string
+	SigningPublicKeyPEM   string
+	// CertificateChainPEM is served in the certificate_chain part, signing
+	// certificate first
+	CertificateChainPEM string
+}
+
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "", "rsa":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodePrivateKeyPEM(privateKey crypto.Signer) (string, error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})), nil
+}
+
+func encodePublicKeyPEM(publicKey crypto.PublicKey) (string, error) {
+	keyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyBytes})), nil
+}
+
+func encodeCertificatePEM(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// GenerateCodeSigningCertificates creates a self-signed root certificate and a
+// code signing certificate issued by it.
+func GenerateCodeSigningCertificates(options CertificateOptions) (*CodeSigningCertificates, error) {
+	if options.CommonName == "" {
+		return nil, fmt.Errorf("a common name is required")
+	}
+	if options.Validity <= 0 {
+		return nil, fmt.Errorf("validity must be positive")
+	}
+	notBefore := time.Now()
+	notAfter := notBefore.Add(options.Validity)
+
+	rootKey, err := generateKey(options.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	rootSerial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          rootSerial,
+		Subject:               pkix.Name{CommonName: options.CommonName + " Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root certificate: %w", err)
+	}
+	rootCertificate, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse root certificate: %w", err)
+	}
+
+	signingKey, err := generateKey(options.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	signingSerial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	signingTemplate := &x509.Certificate{
+		SerialNumber:          signingSerial,
+		Subject:               pkix.Name{CommonName: options.CommonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	if options.ProjectId != "" && options.ScopeKey != "" {
+		value, err := asn1.MarshalWithParams(options.ProjectId+","+options.ScopeKey, "utf8")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode project information: %w", err)
+		}
+		signingTemplate.ExtraExtensions = []pkix.Extension{{Id: expoProjectInformationOID, Value: value}}
+	}
+	signingDER, err := x509.CreateCertificate(rand.Reader, signingTemplate, rootCertificate, signingKey.Public(), rootKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create code signing certificate: %w", err)
+	}
+
+	rootPrivateKeyPEM, err := encodePrivateKeyPEM(rootKey)
+	if err != nil {
+		return nil, err
+	}
+	signingPrivateKeyPEM, err := encodePrivateKeyPEM(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	signingPublicKeyPEM, err := encodePublicKeyPEM(signingKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	rootCertificatePEM := encodeCertificatePEM(rootDER)
+	signingCertificatePEM := encodeCertificatePEM(signingDER)
+	return &CodeSigningCertificates{
+		RootCertificatePEM:    rootCertificatePEM,
+		RootPrivateKeyPEM:     rootPrivateKeyPEM,
+		SigningCertificatePEM: signingCertificatePEM,
+		SigningPrivateKeyPEM:  signingPrivateKeyPEM,
+		SigningPublicKeyPEM:   signingPublicKeyPEM,
+		CertificateChainPEM:   signingCertificatePEM + rootCertificatePEM,
+	}, nil
+}
@@ -64,6 +64,35 @@ func GetBase64URLEncoding(encodedString string) string {
 	return base64EncodedString
 }
 
+// ExpectSignature holds the parameters of an expo-expect-signature header, a
+// structured field dictionary such as `sig, keyid="main", alg="rsa-v1_5-sha256"`.
+type ExpectSignature struct {
+	KeyId string
+	Alg   string
+}
+
+func ParseExpectSignature(header string) ExpectSignature {
+	var expectSignature ExpectSignature
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		if index := strings.Index(member, ";"); index != -1 {
+			member = member[:index]
+		}
+		key, value, found := strings.Cut(member, "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), "\"")
+		switch strings.TrimSpace(key) {
+		case "keyid":
+			expectSignature.KeyId = value
+		case "alg":
+			expectSignature.Alg = value
+		}
+	}
+	return expectSignature
+}
+
 func SignRSASHA256(data, privateKeyPEM string) (string, error) {
 	block, _ := pem.Decode([]byte(privateKeyPEM))
 	if block == nil {
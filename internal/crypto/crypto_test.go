@@ -2,14 +2,19 @@ package crypto
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateHash(t *testing.T) {
@@ -101,3 +106,139 @@ func TestSignRSASHA256(t *testing.T) {
 		t.Errorf("expected error for invalid private key, got none")
 	}
 }
+
+func TestParseExpectSignature(t *testing.T) {
+	tests := []struct {
+		header string
+		keyId  string
+		alg    string
+	}{
+		{`sig, keyid="main", alg="rsa-v1_5-sha256"`, "main", "rsa-v1_5-sha256"},
+		{`sig, keyid="2025"`, "2025", ""},
+		{`true`, "", ""},
+		{``, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			result := ParseExpectSignature(tt.header)
+			if result.KeyId != tt.keyId || result.Alg != tt.alg {
+				t.Errorf("expected keyid %q and alg %q, got %q and %q", tt.keyId, tt.alg, result.KeyId, result.Alg)
+			}
+		})
+	}
+}
+
+func marshalPKCS8PEM(t *testing.T, privateKey interface{}) string {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}))
+}
+
+func TestSign(t *testing.T) {
+	data := "test data"
+	hash := sha256.Sum256([]byte(data))
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublicKey, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name        string
+		keyPEM      string
+		alg         string
+		expectedAlg string
+		verify      func(signature []byte) bool
+	}{
+		{"RSA default", marshalPKCS8PEM(t, rsaKey), "", AlgRSAv15SHA256, func(signature []byte) bool {
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, hash[:], signature) == nil
+		}},
+		{"RSA PSS", marshalPKCS8PEM(t, rsaKey), AlgRSAPSSSHA256, AlgRSAPSSSHA256, func(signature []byte) bool {
+			return rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, hash[:], signature, nil) == nil
+		}},
+		{"ECDSA P-256", marshalPKCS8PEM(t, ecKey), AlgECDSAP256SHA256, AlgECDSAP256SHA256, func(signature []byte) bool {
+			return ecdsa.VerifyASN1(&ecKey.PublicKey, hash[:], signature)
+		}},
+		{"Ed25519", marshalPKCS8PEM(t, edKey), "", AlgEd25519, func(signature []byte) bool {
+			return ed25519.Verify(edPublicKey, []byte(data), signature)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature, alg, err := Sign(data, tt.keyPEM, tt.alg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if alg != tt.expectedAlg {
+				t.Errorf("expected algorithm %s, got %s", tt.expectedAlg, alg)
+			}
+			signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+			if err != nil {
+				t.Fatalf("failed to decode signature: %v", err)
+			}
+			if !tt.verify(signatureBytes) {
+				t.Errorf("signature verification failed")
+			}
+		})
+	}
+}
+
+func TestSignRejectsMismatchingAlgorithm(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, _, err := Sign("test data", marshalPKCS8PEM(t, edKey), AlgRSAv15SHA256)
+	if !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("expected key algorithm mismatch, got %v", err)
+	}
+	_, _, err = Sign("test data", marshalPKCS8PEM(t, edKey), "hmac-sha256")
+	if !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("expected unsupported algorithm, got %v", err)
+	}
+}
+
+func TestGenerateCodeSigningCertificates(t *testing.T) {
+	certificates, err := GenerateCodeSigningCertificates(CertificateOptions{
+		CommonName: "Test App",
+		Validity:   24 * time.Hour,
+		ProjectId:  "project",
+		ScopeKey:   "@owner/app",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parseCertificate := func(certificatePEM string) *x509.Certificate {
+		block, _ := pem.Decode([]byte(certificatePEM))
+		if block == nil {
+			t.Fatalf("invalid certificate PEM")
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("failed to parse certificate: %v", err)
+		}
+		return certificate
+	}
+	root := parseCertificate(certificates.RootCertificatePEM)
+	signing := parseCertificate(certificates.SigningCertificatePEM)
+	if !root.IsCA {
+		t.Errorf("expected root certificate to be a CA")
+	}
+	if err := signing.CheckSignatureFrom(root); err != nil {
+		t.Errorf("signing certificate not issued by root: %v", err)
+	}
+	if len(signing.ExtKeyUsage) != 1 || signing.ExtKeyUsage[0] != x509.ExtKeyUsageCodeSigning {
+		t.Errorf("expected code signing extended key usage")
+	}
+	if !strings.HasPrefix(certificates.CertificateChainPEM, certificates.SigningCertificatePEM) {
+		t.Errorf("expected certificate chain to start with the signing certificate")
+	}
+
+	signature, _, err := Sign("test data", certificates.SigningPrivateKeyPEM, "")
+	if err != nil {
+		t.Fatalf("unexpected error signing: %v", err)
+	}
+	signatureBytes, _ := base64.StdEncoding.DecodeString(signature)
+	if err := signing.CheckSignature(x509.SHA256WithRSA, []byte("test data"), signatureBytes); err != nil {
+		t.Errorf("signature does not match the signing certificate: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Code signing algorithms, as named in the alg parameter of the
+// expo-expect-signature and expo-signature headers.
+const (
+	AlgRSAv15SHA256    = "rsa-v1_5-sha256"
+	AlgRSAPSSSHA256    = "rsa-pss-sha256"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgEd25519         = "ed25519"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyAlgorithmMismatch = errors.New("private key cannot sign with the requested algorithm")
+)
+
+// ParsePrivateKey parses a PEM encoded RSA (PKCS#1 or PKCS#8), EC (SEC 1 or
+// PKCS#8) or Ed25519 (PKCS#8) private key.
+func ParsePrivateKey(privateKeyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM format")
+	}
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+	if privateKey, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	switch privateKey := parsedKey.(type) {
+	case *rsa.PrivateKey:
+		return privateKey, nil
+	case *ecdsa.PrivateKey:
+		return privateKey, nil
+	case ed25519.PrivateKey:
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsedKey)
+	}
+}
+
+// DefaultAlgorithmForKey returns the algorithm used when the client does not
+// request one.
+func DefaultAlgorithmForKey(privateKey crypto.Signer) (string, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return AlgRSAv15SHA256, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return "", fmt.Errorf("%w: only P-256 EC keys are supported", ErrKeyAlgorithmMismatch)
+		}
+		return AlgECDSAP256SHA256, nil
+	case ed25519.PrivateKey:
+		return AlgEd25519, nil
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
+// Sign signs data with the PEM encoded private key and returns the base64
+// encoded signature along with the algorithm used. An empty alg selects the
+// default algorithm of the key.
+func Sign(data, privateKeyPEM, alg string) (string, string, error) {
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return "", "", err
+	}
+	if alg == "" {
+		if alg, err = DefaultAlgorithmForKey(privateKey); err != nil {
+			return "", "", err
+		}
+	}
+	hashed := sha256.Sum256([]byte(data))
+	var signature []byte
+	switch alg {
+	case AlgRSAv15SHA256:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return "", "", fmt.Errorf("%w: %s needs an RSA key", ErrKeyAlgorithmMismatch, alg)
+		}
+		signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hashed[:])
+	case AlgRSAPSSSHA256:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return "", "", fmt.Errorf("%w: %s needs an RSA key", ErrKeyAlgorithmMismatch, alg)
+		}
+		signature, err = rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, hashed[:], &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+		})
+	case AlgECDSAP256SHA256:
+		ecKey, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return "", "", fmt.Errorf("%w: %s needs a P-256 EC key", ErrKeyAlgorithmMismatch, alg)
+		}
+		signature, err = ecdsa.SignASN1(rand.Reader, ecKey, hashed[:])
+	case AlgEd25519:
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return "", "", fmt.Errorf("%w: %s needs an Ed25519 key", ErrKeyAlgorithmMismatch, alg)
+		}
+		signature = ed25519.Sign(edKey, []byte(data))
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign data: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), alg, nil
+}
@@ -3,6 +3,7 @@ package dashboard
 import (
 	"expo-open-ota/config"
 	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/channel"
 	"expo-open-ota/internal/types"
 	"log"
 	"regexp"
@@ -20,6 +21,9 @@ type DashboardConfig struct {
 	REDIS_PORT                    string `json:"REDIS_PORT"`
 	STORAGE_MODE                  string `json:"STORAGE_MODE"`
 	S3_BUCKET_NAME                string `json:"S3_BUCKET_NAME"`
+	S3_ENDPOINT                   string `json:"S3_ENDPOINT"`
+	S3_REGION                     string `json:"S3_REGION"`
+	S3_FORCE_PATH_STYLE           bool   `json:"S3_FORCE_PATH_STYLE"`
 	LOCAL_BUCKET_BASE_PATH        string `json:"LOCAL_BUCKET_BASE_PATH"`
 	KEYS_STORAGE_TYPE             string `json:"KEYS_STORAGE_TYPE"`
 	KEYS_STORAGE_BASE_PATH        string `json:"KEYS_STORAGE_BASE_PATH"`
@@ -45,8 +49,11 @@ func GetDashboardConfig() DashboardConfig {
 		CACHE_MODE:                    config.GetEnv("CACHE_MODE"),
 		REDIS_HOST:                    config.GetEnv("REDIS_HOST"),
 		REDIS_PORT:                    config.GetEnv("REDIS_PORT"),
-		STORAGE_MODE:                  config.GetEnv("STORAGE_MODE"),
+		STORAGE_MODE:                  config.ResolveStorageMode(),
 		S3_BUCKET_NAME:                config.GetEnv("S3_BUCKET_NAME"),
+		S3_ENDPOINT:                   config.GetEnv("S3_ENDPOINT"),
+		S3_REGION:                     config.GetEnv("S3_REGION"),
+		S3_FORCE_PATH_STYLE:           config.GetEnv("S3_FORCE_PATH_STYLE") == "true",
 		LOCAL_BUCKET_BASE_PATH:        config.GetEnv("LOCAL_BUCKET_BASE_PATH"),
 		KEYS_STORAGE_TYPE:             config.GetEnv("KEYS_STORAGE_TYPE"),
 		KEYS_STORAGE_BASE_PATH:        config.GetEnv("KEYS_STORAGE_BASE_PATH"),
@@ -71,12 +78,24 @@ func GetBranches() ([]Branch, error) {
 		return nil, err
 	}
 
+	// Show the registered channel pointing at each branch, if any
+	releaseChannels := map[string]string{}
+	channels, err := channel.GetChannels()
+	if err != nil {
+		log.Printf("Error getting channels: %v", err)
+	}
+	for _, registeredChannel := range channels {
+		if _, ok := releaseChannels[registeredChannel.Branch]; !ok {
+			releaseChannels[registeredChannel.Branch] = registeredChannel.Name
+		}
+	}
+
 	// Convert string array to array of Branch objects
 	branches := make([]Branch, len(branchNames))
 	for i, name := range branchNames {
 		branches[i] = Branch{
-			BranchName: name,
-			// ReleaseChannel is empty by default
+			BranchName:     name,
+			ReleaseChannel: releaseChannels[name],
 		}
 	}
 
@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"expo-open-ota/internal/assets"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/compression"
+	"expo-open-ota/internal/update"
 	"log"
+	"mime"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -84,6 +91,12 @@ func AssetsHandler(c *gin.Context) {
 			RuntimeVersion: runtimeVersion,
 			Platform:       platform,
 			RequestID:      requestID,
+			UpdateId:       updateId,
+			Encodings:      compression.NegotiateEncodings(c.Request),
+		}
+
+		if redirectToCDN(c, req) {
+			return
 		}
 
 		// Handle the request
@@ -94,37 +107,11 @@ func AssetsHandler(c *gin.Context) {
 			return
 		}
 
-		// Set required Expo headers
-		c.Header("expo-protocol-version", "1")
-		c.Header("expo-sfv-version", "0")
-		c.Header("Cache-Control", "private, max-age=0")
-
-		// Return appropriate response
-		for key, value := range res.Headers {
-			c.Header(key, value)
-		}
-
-		// Set content type based on asset type
-		if strings.HasSuffix(assetPath, ".hbc") || strings.HasSuffix(assetPath, ".js") {
-			c.Header("Content-Type", "application/javascript")
-		} else if strings.HasSuffix(assetPath, ".png") {
-			c.Header("Content-Type", "image/png")
-		} else if strings.HasSuffix(assetPath, ".jpg") || strings.HasSuffix(assetPath, ".jpeg") {
-			c.Header("Content-Type", "image/jpeg")
-		} else if strings.HasSuffix(assetPath, ".gif") {
-			c.Header("Content-Type", "image/gif")
-		} else if strings.HasSuffix(assetPath, ".json") {
-			c.Header("Content-Type", "application/json")
-		} else {
-			c.Header("Content-Type", "application/octet-stream")
-		}
-
 		if res.StatusCode != http.StatusOK {
 			c.Data(res.StatusCode, res.ContentType, res.Body)
 			return
 		}
-
-		c.Data(res.StatusCode, res.ContentType, res.Body)
+		writeAssetFile(c, assetPath, res, requestID)
 		return
 	}
 
@@ -150,12 +137,17 @@ func AssetsHandler(c *gin.Context) {
 		RuntimeVersion: runtimeVersion,
 		Platform:       platform,
 		RequestID:      requestID,
+		UpdateId:       c.Query("updateId"),
+		Encodings:      compression.NegotiateEncodings(c.Request),
 	}
 
 	// Use our improved asset handling logic
 	log.Printf("[RequestID: %s] Looking for asset: %s (platform: %s, runtimeVersion: %s, branch: %s)",
 		requestID, assetPath, platform, runtimeVersion, branch)
 
+	if redirectToCDN(c, req) {
+		return
+	}
 	res, err := assets.HandleAssetsWithFile(req)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error handling asset request: %v", requestID, err)
@@ -163,36 +155,103 @@ func AssetsHandler(c *gin.Context) {
 		return
 	}
 
+	if res.StatusCode != http.StatusOK {
+		log.Printf("[RequestID: %s] Non-200 status code: %d, body: %s", requestID, res.StatusCode, string(res.Body))
+		c.JSON(res.StatusCode, gin.H{"error": string(res.Body)})
+		return
+	}
+	writeAssetFile(c, assetPath, res, requestID)
+}
+
+// redirectToCDN redirects the client to a signed URL of the asset on the CDN
+// selected by CDN_PROVIDER. It returns false when no CDN is configured and the
+// asset must be streamed.
+func redirectToCDN(c *gin.Context, req assets.AssetsRequest) bool {
+	resolvedCDN := cdn.GetCDN()
+	if resolvedCDN == nil {
+		return false
+	}
+	res, err := assets.HandleAssetsWithURL(req, resolvedCDN)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error handling asset request: %v", req.RequestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return true
+	}
+	if res.StatusCode != http.StatusOK {
+		c.JSON(res.StatusCode, gin.H{"error": string(res.Body)})
+		return true
+	}
+	c.Header("expo-protocol-version", "1")
+	c.Header("expo-sfv-version", "0")
+	// Signed URLs expire, the redirection itself is never cached
+	c.Header("Cache-Control", "private, max-age=0")
+	c.Redirect(http.StatusFound, res.URL)
+	return true
+}
+
+// writeAssetFile streams a resolved asset with the Expo headers, answering
+// range and conditional requests.
+func writeAssetFile(c *gin.Context, assetPath string, res assets.AssetsResponse, requestID string) {
 	// Set required Expo headers
 	c.Header("expo-protocol-version", "1")
 	c.Header("expo-sfv-version", "0")
 	c.Header("Cache-Control", "private, max-age=0")
 
-	// Return appropriate response
 	for key, value := range res.Headers {
 		c.Header(key, value)
 	}
 
 	// Set content type based on asset type
+	var contentType string
 	if strings.HasSuffix(assetPath, ".hbc") || strings.HasSuffix(assetPath, ".js") {
-		c.Header("Content-Type", "application/javascript")
+		contentType = "application/javascript"
 	} else if strings.HasSuffix(assetPath, ".png") {
-		c.Header("Content-Type", "image/png")
+		contentType = "image/png"
 	} else if strings.HasSuffix(assetPath, ".jpg") || strings.HasSuffix(assetPath, ".jpeg") {
-		c.Header("Content-Type", "image/jpeg")
+		contentType = "image/jpeg"
 	} else if strings.HasSuffix(assetPath, ".gif") {
-		c.Header("Content-Type", "image/gif")
+		contentType = "image/gif"
 	} else if strings.HasSuffix(assetPath, ".json") {
-		c.Header("Content-Type", "application/json")
+		contentType = "application/json"
+	} else if res.ContentType != "" {
+		contentType = res.ContentType
 	} else {
-		c.Header("Content-Type", "application/octet-stream")
+		contentType = "application/octet-stream"
 	}
 
-	if res.StatusCode != http.StatusOK {
-		log.Printf("[RequestID: %s] Non-200 status code: %d, body: %s", requestID, res.StatusCode, string(res.Body))
-		c.JSON(res.StatusCode, gin.H{"error": string(res.Body)})
+	assets.ServeAssetFile(c.Writer, c.Request, res.File, contentType, requestID)
+}
+
+// ContentAssetHandler serves an asset of the content store. The object behind
+// a hash never changes, so it can be cached forever.
+func ContentAssetHandler(c *gin.Context) {
+	file := c.Param("file")
+	extension := path.Ext(file)
+	sha256Hex := strings.TrimSuffix(file, extension)
+	if !update.IsValidContentHash(sha256Hex) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content hash"})
+		return
+	}
+	contentFile, err := update.ResolveContentAssetFile(sha256Hex, compression.NegotiateEncodings(c.Request))
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading content asset %s: %v", sha256Hex, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	c.Data(res.StatusCode, res.ContentType, res.Body)
+	contentType := mime.TypeByExtension(extension)
+	if extension == ".bundle" || extension == ".hbc" {
+		contentType = "application/javascript"
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("expo-protocol-version", "1")
+	c.Header("expo-sfv-version", "0")
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	assets.ServeAssetFile(c.Writer, c.Request, contentFile, contentType, sha256Hex)
 }
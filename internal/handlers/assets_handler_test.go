@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetsRedirectToSignedCDNObject(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	t.Setenv("CDN_PROVIDER", "hmac")
+	t.Setenv("CDN_HMAC_DOMAIN", "https://edge.example.com")
+	t.Setenv("CDN_HMAC_SECRET", "edge-secret")
+	cdn.ResetCDNInstance()
+	t.Cleanup(cdn.ResetCDNInstance)
+
+	published := types.Update{Branch: "cdn", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	upload := func(fileName string, content string) {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, fileName, strings.NewReader(content)))
+	}
+	upload("metadata.json", `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[{"path":"assets/icon","ext":"png"}]}}}`)
+	upload("bundles/ios.js", "bundle")
+	sum := sha256.Sum256([]byte("icon"))
+	iconHash := hex.EncodeToString(sum[:])
+	require.NoError(t, resolvedBucket.PutObject(update.ContentAssetKey(iconHash), strings.NewReader("icon")))
+	require.NoError(t, update.SaveUploadIntegrity(published, []types.UploadFile{{Name: "assets/icon", SHA256: iconHash, Size: 4}}))
+	_, err := update.IndexUpdateAssets(published)
+	require.NoError(t, err)
+	require.NoError(t, update.MarkUpdateAsChecked(published))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/assets", AssetsHandler)
+	redirection := func(asset string) *url.URL {
+		query := url.Values{"asset": {asset}, "runtimeVersion": {"1.0.0"}, "platform": {"ios"}, "branch": {"cdn"}}
+		request := httptest.NewRequest(http.MethodGet, "/assets?"+query.Encode(), nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusFound, recorder.Code, recorder.Body.String())
+		location, err := url.Parse(recorder.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.True(t, cdn.VerifyHMACSignature("edge-secret", location.Path, location.Query().Get("expires"), location.Query().Get("signature"), time.Now()))
+		return location
+	}
+
+	// Each asset is signed under the key of the object holding it
+	assert.Equal(t, "/cdn/1.0.0/1700000000000/bundles/ios.js", redirection("bundles/ios.js").Path)
+	assert.Equal(t, "/_ota/assets/"+iconHash, redirection("assets/icon").Path)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"expo-open-ota/internal/channel"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChannelRequest struct {
+	Name     string                 `json:"name"`
+	Branch   string                 `json:"branch"`
+	Branches []channel.BranchWeight `json:"branches"`
+}
+
+func writeChannelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, channel.ErrChannelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, channel.ErrChannelAlreadyExists), errors.Is(err, channel.ErrRegistryConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, channel.ErrInvalidChannel), errors.Is(err, channel.ErrInvalidBranchWeights):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling channel request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error handling channel request"})
+	}
+}
+
+func GetChannelsHandler(c *gin.Context) {
+	channels, err := channel.GetChannels()
+	if err != nil {
+		writeChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+func GetChannelHandler(c *gin.Context) {
+	result, err := channel.GetChannel(c.Param("channel"))
+	if err != nil {
+		writeChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func CreateChannelHandler(c *gin.Context) {
+	var request ChannelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	result, err := channel.CreateChannel(request.Name, request.Branch, request.Branches)
+	if err != nil {
+		writeChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+func UpdateChannelHandler(c *gin.Context) {
+	var request ChannelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	result, err := channel.UpdateChannel(c.Param("channel"), request.Branch, request.Branches)
+	if err != nil {
+		writeChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func DeleteChannelHandler(c *gin.Context) {
+	if err := channel.DeleteChannel(c.Param("channel")); err != nil {
+		writeChannelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
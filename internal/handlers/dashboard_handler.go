@@ -31,6 +31,9 @@ type DashboardConfig struct {
 	REDIS_PORT                    string `json:"REDIS_PORT"`
 	STORAGE_MODE                  string `json:"STORAGE_MODE"`
 	S3_BUCKET_NAME                string `json:"S3_BUCKET_NAME"`
+	S3_ENDPOINT                   string `json:"S3_ENDPOINT"`
+	S3_REGION                     string `json:"S3_REGION"`
+	S3_FORCE_PATH_STYLE           bool   `json:"S3_FORCE_PATH_STYLE"`
 	LOCAL_BUCKET_BASE_PATH        string `json:"LOCAL_BUCKET_BASE_PATH"`
 	KEYS_STORAGE_TYPE             string `json:"KEYS_STORAGE_TYPE"`
 	KEYS_STORAGE_BASE_PATH        string `json:"KEYS_STORAGE_BASE_PATH"`
@@ -56,8 +59,11 @@ func GetDashboardConfig(c *gin.Context) {
 		CACHE_MODE:                    config.GetEnv("CACHE_MODE"),
 		REDIS_HOST:                    config.GetEnv("REDIS_HOST"),
 		REDIS_PORT:                    config.GetEnv("REDIS_PORT"),
-		STORAGE_MODE:                  config.GetEnv("STORAGE_MODE"),
+		STORAGE_MODE:                  config.ResolveStorageMode(),
 		S3_BUCKET_NAME:                config.GetEnv("S3_BUCKET_NAME"),
+		S3_ENDPOINT:                   config.GetEnv("S3_ENDPOINT"),
+		S3_REGION:                     config.GetEnv("S3_REGION"),
+		S3_FORCE_PATH_STYLE:           config.GetEnv("S3_FORCE_PATH_STYLE") == "true",
 		LOCAL_BUCKET_BASE_PATH:        config.GetEnv("LOCAL_BUCKET_BASE_PATH"),
 		KEYS_STORAGE_TYPE:             config.GetEnv("KEYS_STORAGE_TYPE"),
 		KEYS_STORAGE_BASE_PATH:        config.GetEnv("KEYS_STORAGE_BASE_PATH"),
@@ -83,9 +89,8 @@ func GetBranchesHandler(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error getting branches: %v", err)
 		// Add more detailed error output
-		bucket := config.GetEnv("BUCKET_TYPE")
-		storageMode := config.GetEnv("STORAGE_MODE")
-		log.Printf("Current bucket type: %s, storage mode: %s", bucket, storageMode)
+		storageMode := config.ResolveStorageMode()
+		log.Printf("Current storage mode: %s", storageMode)
 
 		// Log storage configuration based on storage mode
 		switch storageMode {
@@ -171,6 +176,10 @@ func GetUpdatesHandler(c *gin.Context) {
 			updateInfo["platform"] = update.Platform
 		}
 
+		if rollout := rolloutForUpdate(update); rollout != nil {
+			updateInfo["rollout"] = rollout
+		}
+
 		enhancedUpdates = append(enhancedUpdates, updateInfo)
 	}
 
@@ -3,7 +3,9 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/channel"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/keyStore"
 	"expo-open-ota/internal/metrics"
@@ -13,6 +15,7 @@ import (
 	"io"
 	"log"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -38,25 +41,49 @@ func createMultipartResponse(headers map[string][]string, jsonContent interface{
 	return writer, &buf, nil
 }
 
-func signDirectiveOrManifest(content interface{}, expectSignatureHeader string) (string, error) {
+// addCertificateChainPart appends the certificate_chain part clients use to
+// verify signatures made by a certificate issued by their embedded root.
+func addCertificateChainPart(writer *multipart.Writer, certificateChain string) error {
+	field, err := writer.CreatePart(map[string][]string{
+		"Content-Disposition": {"form-data; name=\"certificate_chain\""},
+		"Content-Type":        {"application/x-pem-file"},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating certificate chain field: %w", err)
+	}
+	if _, err := field.Write([]byte(certificateChain)); err != nil {
+		return fmt.Errorf("error writing certificate chain: %w", err)
+	}
+	return nil
+}
+
+// signDirectiveOrManifest signs the content with the key and algorithm
+// requested by the client's expo-expect-signature header, and returns the
+// signature with the keyid and algorithm used.
+func signDirectiveOrManifest(content interface{}, expectSignatureHeader string) (string, string, string, error) {
 	if expectSignatureHeader == "" {
-		return "", nil
+		return "", "", "", nil
 	}
-	privateKey := keyStore.GetPrivateExpoKey()
+	expectSignature := crypto.ParseExpectSignature(expectSignatureHeader)
+	keyId := keyStore.ResolveSigningKeyId(expectSignature.KeyId)
+	privateKey := keyStore.GetPrivateExpoKeyById(keyId)
 	if privateKey == "" {
-		log.Printf("Warning: No private key available for signing. Continuing without signature.")
-		return "", nil
+		log.Printf("Warning: No private key available for signing with keyid %s. Continuing without signature.", keyId)
+		return "", "", "", nil
 	}
 	contentJSON, err := json.Marshal(content)
 	if err != nil {
-		return "", fmt.Errorf("error stringifying content: %w", err)
+		return "", "", "", fmt.Errorf("error stringifying content: %w", err)
+	}
+	signedHash, alg, err := crypto.Sign(string(contentJSON), privateKey, expectSignature.Alg)
+	if errors.Is(err, crypto.ErrUnsupportedAlgorithm) || errors.Is(err, crypto.ErrKeyAlgorithmMismatch) {
+		return "", "", "", err
 	}
-	signedHash, err := crypto.SignRSASHA256(string(contentJSON), privateKey)
 	if err != nil {
-		log.Printf("Warning: Error signing content with private key: %v. Continuing without signature.", err)
-		return "", nil
+		log.Printf("Warning: Error signing content with private key %s: %v. Continuing without signature.", keyId, err)
+		return "", "", "", nil
 	}
-	return signedHash, nil
+	return signedHash, keyId, alg, nil
 }
 
 func writeResponse(w http.ResponseWriter, writer *multipart.Writer, buf *bytes.Buffer, protocolVersion int64, runtimeVersion string, requestID string) {
@@ -75,7 +102,12 @@ func writeResponse(w http.ResponseWriter, writer *multipart.Writer, buf *bytes.B
 }
 
 func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fieldName string, runtimeVersion string, protocolVersion int64, requestID string) {
-	signedHash, err := signDirectiveOrManifest(content, r.Header.Get("expo-expect-signature"))
+	signedHash, keyId, alg, err := signDirectiveOrManifest(content, r.Header.Get("expo-expect-signature"))
+	if errors.Is(err, crypto.ErrUnsupportedAlgorithm) || errors.Is(err, crypto.ErrKeyAlgorithmMismatch) {
+		log.Printf("[RequestID: %s] Cannot sign with requested algorithm: %v", requestID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Printf("[RequestID: %s] Error signing content: %v", requestID, err)
 		http.Error(w, "Error signing content", http.StatusInternalServerError)
@@ -87,7 +119,7 @@ func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fi
 		"content-type":        {"application/json; charset=utf-8"},
 	}
 	if signedHash != "" {
-		headers["expo-signature"] = []string{fmt.Sprintf("sig=\"%s\", keyid=\"main\"", signedHash)}
+		headers["expo-signature"] = []string{fmt.Sprintf("sig=\"%s\", keyid=\"%s\", alg=\"%s\"", signedHash, keyId, alg)}
 	}
 	writer, buf, err := createMultipartResponse(headers, content)
 	if err != nil {
@@ -95,6 +127,15 @@ func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fi
 		http.Error(w, "Error creating multipart response", http.StatusInternalServerError)
 		return
 	}
+	if signedHash != "" {
+		if certificateChain := keyStore.GetExpoCertificateChainById(keyId); certificateChain != "" {
+			if err := addCertificateChainPart(writer, certificateChain); err != nil {
+				log.Printf("[RequestID: %s] Error adding certificate chain: %v", requestID, err)
+				http.Error(w, "Error creating multipart response", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
 	writeResponse(w, writer, buf, protocolVersion, runtimeVersion, requestID)
 }
 
@@ -184,32 +225,7 @@ func putUpdateInResponse(w http.ResponseWriter, r *http.Request, lastUpdate type
 		return
 	}
 
-	// Ensure that manifest has all the required fields and structure
-	if manifest.LaunchAsset.Key == "" || manifest.LaunchAsset.Url == "" {
-		log.Printf("[RequestID: %s] WARNING: LaunchAsset missing key or URL - this may cause updates to fail", requestID)
-
-		// Try to fix missing LaunchAsset URL if needed
-		resolvedBucket := bucket.GetBucket()
-
-		// Special handling for JS bundle - try to find any JS file that could be used
-		jsFiles := []string{"bundle.js", "index.js", "app.js", "index.bundle", "app.bundle"}
-
-		for _, jsFile := range jsFiles {
-			_, err := resolvedBucket.GetFile(lastUpdate.Branch, lastUpdate.RuntimeVersion, lastUpdate.UpdateId, jsFile)
-			if err == nil {
-				log.Printf("[RequestID: %s] Found potential bundle file: %s", requestID, jsFile)
-				// Update the manifest to use this file
-				if manifest.LaunchAsset.Key == "" {
-					manifest.LaunchAsset.Key = jsFile
-				}
-				manifest.LaunchAsset.Url = fmt.Sprintf("/assets/%s/%s/%s/%s?platform=%s",
-					lastUpdate.Branch, lastUpdate.RuntimeVersion, lastUpdate.UpdateId, jsFile, platform)
-				break
-			}
-		}
-	}
-
-	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, metadata.ID, "update")
+	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, r.Header.Get("expo-channel-name"), lastUpdate.Branch, metadata.ID, "update")
 	log.Printf("[RequestID: %s] Update download tracked successfully", requestID)
 
 	// Log the complete manifest being sent for debugging purposes
@@ -310,7 +326,7 @@ func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate ty
 		http.Error(w, "Error creating rollback directive", http.StatusInternalServerError)
 		return
 	}
-	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId, "rollback")
+	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, r.Header.Get("expo-channel-name"), lastUpdate.Branch, lastUpdate.UpdateId, "rollback")
 	putResponse(w, r, directive, "directive", lastUpdate.RuntimeVersion, protocolVersion, requestID)
 }
 
@@ -425,14 +441,25 @@ func ManifestHandler(c *gin.Context) {
 
 	log.Printf("[RequestID: %s] Path parameters: branch=%s, runtimeVersion=%s", requestID, branch, pathRuntimeVersion)
 
-	// Important: Check the channel vs. branch values
+	// Registered channels take precedence over the branch baked in the path,
+	// so a channel can be repointed without rebuilding the app
 	log.Printf("[RequestID: %s] CHANNEL-TO-BRANCH MAPPING: Request channel=%s, path branch=%s",
 		requestID, channelName, branch)
-
-	// If channel and branch differ, try to log why
-	if channelName != branch {
-		log.Printf("[RequestID: %s] NOTE: Channel name (%s) differs from branch (%s) - this could cause lookup issues",
-			requestID, channelName, branch)
+	clientKey := resolveClientKey(c.Request)
+	if channelName != "" {
+		mappedBranch, errChannel := channel.ResolveBranch(channelName, clientKey)
+		if errChannel != nil {
+			log.Printf("[RequestID: %s] Error resolving channel %s: %v", requestID, channelName, errChannel)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resolving channel"})
+			return
+		}
+		if mappedBranch != "" {
+			log.Printf("[RequestID: %s] Channel %s is mapped to branch %s", requestID, channelName, mappedBranch)
+			branch = mappedBranch
+		} else if branch == "" {
+			log.Printf("[RequestID: %s] Channel %s is not registered, using it as branch name", requestID, channelName)
+			branch = channelName
+		}
 	}
 
 	// If runtimeVersion from path is available but header isn't, use the path version
@@ -456,10 +483,10 @@ func ManifestHandler(c *gin.Context) {
 		return
 	}
 
-	// Get the latest update for this channel and runtime version
+	// Get the latest update this client is part of the rollout for
 	log.Printf("[RequestID: %s] Searching for updates in branch=%s, runtimeVersion=%s, buildNumber=%s",
 		requestID, branch, runtimeVersion, buildNumber)
-	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion, buildNumber)
+	latestUpdate, err := update.ResolveUpdateForClient(branch, runtimeVersion, platform, clientKey)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error getting latest update: %v", requestID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting latest update"})
@@ -475,10 +502,45 @@ func ManifestHandler(c *gin.Context) {
 
 	log.Printf("[RequestID: %s] Found latest update: ID=%s", requestID, latestUpdate.UpdateId)
 
+	if update.GetUpdateType(*latestUpdate) == types.Rollback {
+		log.Printf("[RequestID: %s] Latest update %s is a rollback", requestID, latestUpdate.UpdateId)
+		putRollbackInResponse(c.Writer, c.Request, *latestUpdate, platform, protocolVersion, requestID)
+		return
+	}
+
 	// Return the update manifest
 	putUpdateInResponse(c.Writer, c.Request, *latestUpdate, platform, protocolVersion, requestID)
 }
 
+// resolveClientKey identifies the device for staged rollouts and weighted
+// channels, using the EAS client ID when present and a hash of stable request
+// headers otherwise.
+func resolveClientKey(r *http.Request) string {
+	if clientId := r.Header.Get("eas-client-id"); clientId != "" {
+		return clientId
+	}
+	remoteIP := r.Header.Get("X-Forwarded-For")
+	if remoteIP != "" {
+		remoteIP = strings.TrimSpace(strings.Split(remoteIP, ",")[0])
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	} else {
+		remoteIP = r.RemoteAddr
+	}
+	key := strings.Join([]string{
+		remoteIP,
+		r.Header.Get("User-Agent"),
+		r.Header.Get("expo-platform"),
+		r.Header.Get("expo-runtime-version"),
+		r.Header.Get("expo-embedded-update-id"),
+	}, "|")
+	hash, err := crypto.CreateHash([]byte(key), "sha256", "hex")
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
 func PutUpdateInResponse(w http.ResponseWriter, branch string, runtimeVersion string, updateId string) {
 	requestID := uuid.New().String()
 	// Get update but don't store unused variable
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useLocalBucket(t *testing.T) bucket.Bucket {
+	t.Setenv("BUCKET_TYPE", "local")
+	t.Setenv("STORAGE_MODE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	bucket.ResetBucketInstance()
+	t.Cleanup(bucket.ResetBucketInstance)
+	_ = cache2.GetCache().Clear()
+	return bucket.GetBucket()
+}
+
+// publishTestUpdate uploads an iOS update whose bundle is named after its id
+// and marks it as uploaded.
+func publishTestUpdate(t *testing.T, resolvedBucket bucket.Bucket, branch string, updateId string) types.Update {
+	published := types.Update{Branch: branch, RuntimeVersion: "1.0.0", UpdateId: updateId}
+	upload := func(fileName string, content string) {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, fileName, strings.NewReader(content)))
+	}
+	upload("metadata.json", `{"version":0,"bundler":"metro","fileMetadata":{"ios":{"bundle":"bundles/ios-`+updateId+`.js","assets":[]}}}`)
+	upload("expoConfig.json", `{"name":"app"}`)
+	upload("bundles/ios-"+updateId+".js", "bundle "+updateId)
+	_, err := update.IndexUpdateAssets(published)
+	require.NoError(t, err)
+	require.NoError(t, update.MarkUpdateAsChecked(published))
+	return published
+}
+
+func requestManifest(t *testing.T, branch string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/manifest/:branch/:runtimeVersion", ManifestHandler)
+	request := httptest.NewRequest(http.MethodGet, "/manifest/"+branch+"/1.0.0", nil)
+	request.Header.Set("expo-channel-name", branch)
+	request.Header.Set("expo-protocol-version", "1")
+	request.Header.Set("expo-platform", "ios")
+	request.Header.Set("expo-runtime-version", "1.0.0")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// readMultipartParts returns the parts of a manifest response by name.
+func readMultipartParts(t *testing.T, recorder *httptest.ResponseRecorder) map[string]string {
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	_, params, err := mime.ParseMediaType(recorder.Header().Get("content-type"))
+	require.NoError(t, err)
+	reader := multipart.NewReader(recorder.Body, params["boundary"])
+	parts := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts[part.FormName()] = string(content)
+	}
+}
+
+// servedUpdateId returns the update whose bundle a manifest launches.
+func servedUpdateId(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	parts := readMultipartParts(t, recorder)
+	require.Contains(t, parts, "manifest")
+	var manifest types.UpdateManifest
+	require.NoError(t, json.Unmarshal([]byte(parts["manifest"]), &manifest))
+	launchUrl, err := http.NewRequest(http.MethodGet, manifest.LaunchAsset.Url, nil)
+	require.NoError(t, err)
+	return launchUrl.URL.Query().Get("updateId")
+}
+
+func TestManifestServesPreviousUpdateOutsideRollout(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publishTestUpdate(t, resolvedBucket, "rollout", "1700000000000")
+	staged := publishTestUpdate(t, resolvedBucket, "rollout", "1700000000001")
+	_, err := update.SetRolloutPercentage(staged, 50)
+	require.NoError(t, err)
+
+	clientIn, clientOut := "", ""
+	for i := 0; clientIn == "" || clientOut == ""; i++ {
+		clientKey := "client-" + strconv.Itoa(i)
+		if update.ComputeRolloutBucket(staged.UpdateId, clientKey) < 50 {
+			clientIn = clientKey
+		} else {
+			clientOut = clientKey
+		}
+	}
+
+	assert.Equal(t, "1700000000001", servedUpdateId(t, requestManifest(t, "rollout", map[string]string{"eas-client-id": clientIn})))
+	assert.Equal(t, "1700000000000", servedUpdateId(t, requestManifest(t, "rollout", map[string]string{"eas-client-id": clientOut})))
+
+	_, err = update.AbortRollout(staged)
+	require.NoError(t, err)
+	assert.Equal(t, "1700000000000", servedUpdateId(t, requestManifest(t, "rollout", map[string]string{"eas-client-id": clientIn})))
+}
+
+func TestManifestAssetKeyIsContentMD5(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publishTestUpdate(t, resolvedBucket, "keys", "1700000000000")
+
+	parts := readMultipartParts(t, requestManifest(t, "keys", nil))
+	var manifest types.UpdateManifest
+	require.NoError(t, json.Unmarshal([]byte(parts["manifest"]), &manifest))
+	sum := md5.Sum([]byte("bundle 1700000000000"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), manifest.LaunchAsset.Key)
+}
+
+func TestManifestIncludesCertificateChainOfSigningKey(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publishTestUpdate(t, resolvedBucket, "signed", "1700000000000")
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	t.Setenv("KEYS_STORAGE_TYPE", "environment")
+	t.Setenv("PRIVATE_EXPO_KEY_B64", base64.StdEncoding.EncodeToString(privateKeyPEM))
+	signatureHeaders := map[string]string{"expo-expect-signature": `sig, keyid="main", alg="rsa-v1_5-sha256"`}
+
+	parts := readMultipartParts(t, requestManifest(t, "signed", signatureHeaders))
+	require.Contains(t, parts, "manifest")
+	assert.NotContains(t, parts, "certificate_chain")
+
+	certificateChain := "-----BEGIN CERTIFICATE-----\nleaf\n-----END CERTIFICATE-----\n"
+	t.Setenv("EXPO_CERTIFICATE_CHAIN_B64", base64.StdEncoding.EncodeToString([]byte(certificateChain)))
+	parts = readMultipartParts(t, requestManifest(t, "signed", signatureHeaders))
+	require.Contains(t, parts, "manifest")
+	assert.Equal(t, certificateChain, parts["certificate_chain"])
+
+	// Unsigned responses never carry the chain
+	parts = readMultipartParts(t, requestManifest(t, "signed", nil))
+	assert.NotContains(t, parts, "certificate_chain")
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/update"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -47,6 +50,44 @@ func MarkUpdateAsUploadedHandler(c *gin.Context) {
 		return
 	}
 
+	report, err := update.VerifyUpdateIntegrity(*currentUpdate)
+	if err != nil {
+		log.Printf("Error verifying update %s: %v", updateId, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid update: %v", err)})
+		return
+	}
+	if !report.Valid {
+		log.Printf("Update %s failed integrity verification, deleting folder...", updateId)
+		if errDelete := bucket.GetBucket().DeleteUpdateFolder(branchName, runtimeVersion, updateId); errDelete != nil {
+			log.Printf("Error deleting update folder: %v", errDelete)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Update failed integrity verification", "report": report})
+		return
+	}
+	if err := update.IngestContentAssets(*currentUpdate); err != nil {
+		log.Printf("Error moving update %s to the content store: %v", updateId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing update assets"})
+		return
+	}
+	if _, err := update.IndexUpdateAssets(*currentUpdate); err != nil {
+		log.Printf("Error indexing assets of update %s: %v", updateId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error indexing update assets"})
+		return
+	}
+
+	// Stage the rollout before the update becomes visible to clients
+	if rolloutPercentage := c.Query("rolloutPercentage"); rolloutPercentage != "" {
+		percentage, errParse := strconv.Atoi(rolloutPercentage)
+		if errParse != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rollout percentage"})
+			return
+		}
+		if _, errRollout := update.SetRolloutPercentage(*currentUpdate, percentage); errRollout != nil {
+			writeRolloutError(c, errRollout)
+			return
+		}
+	}
+
 	err = update.MarkUpdateAsChecked(*currentUpdate)
 	if err != nil {
 		log.Printf("Error marking update as checked: %v", err)
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"expo-open-ota/internal/update"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RepublishRequest struct {
+	TargetBranch string `json:"targetBranch"`
+}
+
+func RepublishUpdateHandler(c *gin.Context) {
+	var request RepublishRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.TargetBranch == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A target branch is required"})
+		return
+	}
+	source, ok := getUpdateFromParams(c)
+	if !ok {
+		return
+	}
+	if request.TargetBranch == source.Branch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target branch must differ from the source branch"})
+		return
+	}
+
+	republished, err := update.RepublishUpdate(*source, request.TargetBranch)
+	if err != nil {
+		if errors.Is(err, update.ErrCannotRepublishRollback) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error republishing update %s to %s: %v", source.UpdateId, request.TargetBranch, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error republishing update"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"branch":         republished.Branch,
+		"runtimeVersion": republished.RuntimeVersion,
+		"updateId":       republished.UpdateId,
+	})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/update"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepublishCopiesUpdateAndServesIt(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	source := publishTestUpdate(t, resolvedBucket, "staging", "1700000000005")
+	publishTestUpdate(t, resolvedBucket, "production", "1700000000000")
+	require.NoError(t, resolvedBucket.UploadFileIntoUpdate(source, "update-metadata.json", strings.NewReader(`{"platform":"ios","message":"Fix login"}`)))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/republish/:branch/:runtimeVersion/:updateId", RepublishUpdateHandler)
+	request := httptest.NewRequest(http.MethodPost, "/republish/staging/1.0.0/"+source.UpdateId, strings.NewReader(`{"targetBranch":"production"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		Branch   string `json:"branch"`
+		UpdateId string `json:"updateId"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.Equal(t, "production", created.Branch)
+	assert.NotEqual(t, source.UpdateId, created.UpdateId)
+
+	republished, err := update.GetUpdate("production", "1.0.0", created.UpdateId)
+	require.NoError(t, err)
+	bundle, err := resolvedBucket.GetFile("production", "1.0.0", created.UpdateId, "bundles/ios-"+source.UpdateId+".js")
+	require.NoError(t, err)
+	content, err := io.ReadAll(bundle)
+	bundle.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "bundle "+source.UpdateId, string(content))
+
+	metadataFile, err := update.ReadUpdateMetadataFile(*republished)
+	require.NoError(t, err)
+	require.NotNil(t, metadataFile.RepublishedFrom)
+	assert.Equal(t, "staging", metadataFile.RepublishedFrom.Branch)
+	assert.Equal(t, source.UpdateId, metadataFile.RepublishedFrom.UpdateId)
+	// Fields the server does not know are copied along
+	rawMetadataFile, err := resolvedBucket.GetFile("production", "1.0.0", created.UpdateId, "update-metadata.json")
+	require.NoError(t, err)
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.NewDecoder(rawMetadataFile).Decode(&fields))
+	rawMetadataFile.Close()
+	assert.JSONEq(t, `"Fix login"`, string(fields["message"]))
+
+	assert.Equal(t, created.UpdateId, servedUpdateId(t, requestManifest(t, "production", nil)))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"expo-open-ota/internal/update"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateRollbackRequest struct {
+	CommitHash string `json:"commitHash"`
+}
+
+func CreateRollbackHandler(c *gin.Context) {
+	branch := c.Param("branch")
+	runtimeVersion := c.Param("runtimeVersion")
+	if branch == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No branch provided"})
+		return
+	}
+	if runtimeVersion == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No runtime version provided"})
+		return
+	}
+
+	// The body is optional, a rollback only needs the branch and runtime version
+	var request CreateRollbackRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+			return
+		}
+	}
+
+	rollbackUpdate, directive, err := update.CreateRollback(branch, runtimeVersion, request.CommitHash)
+	if err != nil {
+		log.Printf("Error creating rollback for %s/%s: %v", branch, runtimeVersion, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating rollback"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"updateId":   rollbackUpdate.UpdateId,
+		"commitTime": directive.Parameters.CommitTime,
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackServesRollBackToEmbeddedDirective(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publishTestUpdate(t, resolvedBucket, "rollback", "1700000000000")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/rollback/:branch/:runtimeVersion", CreateRollbackHandler)
+	request := httptest.NewRequest(http.MethodPost, "/rollback/rollback/1.0.0", strings.NewReader(`{"commitHash":"abc123"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		UpdateId   string `json:"updateId"`
+		CommitTime string `json:"commitTime"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	// The rollback is an update of its own, ordered after the published one
+	rollbackUpdate, err := update.GetUpdate("rollback", "1.0.0", created.UpdateId)
+	require.NoError(t, err)
+	assert.Equal(t, types.Rollback, update.GetUpdateType(*rollbackUpdate))
+	metadataFile, err := update.ReadUpdateMetadataFile(*rollbackUpdate)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", metadataFile.CommitHash)
+	assert.Equal(t, created.CommitTime, metadataFile.CreatedAt)
+
+	parts := readMultipartParts(t, requestManifest(t, "rollback", map[string]string{
+		"expo-embedded-update-id": "embedded",
+		"expo-current-update-id":  "current",
+	}))
+	require.Contains(t, parts, "directive")
+	var directive types.RollbackDirective
+	require.NoError(t, json.Unmarshal([]byte(parts["directive"]), &directive))
+	assert.Equal(t, "rollBackToEmbedded", directive.Type)
+	assert.Equal(t, created.CommitTime, directive.Parameters.CommitTime)
+
+	// Clients already running their embedded update have nothing to do
+	parts = readMultipartParts(t, requestManifest(t, "rollback", map[string]string{
+		"expo-embedded-update-id": "embedded",
+		"expo-current-update-id":  "embedded",
+	}))
+	assert.Contains(t, parts["directive"], "noUpdateAvailable")
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetRolloutRequest struct {
+	Percentage *int `json:"percentage"`
+}
+
+func getUpdateFromParams(c *gin.Context) (*types.Update, bool) {
+	branch := c.Param("branch")
+	runtimeVersion := c.Param("runtimeVersion")
+	updateId := c.Param("updateId")
+	if branch == "" || runtimeVersion == "" || updateId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Branch, runtime version and update id are required"})
+		return nil, false
+	}
+	requestedUpdate := types.Update{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+	}
+	if !update.IsUpdateValid(requestedUpdate) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Update not found"})
+		return nil, false
+	}
+	return &requestedUpdate, true
+}
+
+func rolloutForUpdate(currentUpdate types.Update) *types.Rollout {
+	rollout, err := update.GetRollout(currentUpdate)
+	if err != nil {
+		log.Printf("Error getting rollout for update %s: %v", currentUpdate.UpdateId, err)
+		return nil
+	}
+	return rollout
+}
+
+func writeRolloutError(c *gin.Context, err error) {
+	if errors.Is(err, update.ErrInvalidRolloutPercentage) ||
+		errors.Is(err, update.ErrRolloutPercentageLowered) ||
+		errors.Is(err, update.ErrRolloutNotInProgress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Error updating rollout: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating rollout"})
+}
+
+func GetRolloutHandler(c *gin.Context) {
+	currentUpdate, ok := getUpdateFromParams(c)
+	if !ok {
+		return
+	}
+	rollout, err := update.GetRollout(*currentUpdate)
+	if err != nil {
+		log.Printf("Error getting rollout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting rollout"})
+		return
+	}
+	if rollout == nil {
+		rollout = &types.Rollout{Percentage: 100, Status: types.RolloutCompleted}
+	}
+	c.JSON(http.StatusOK, rollout)
+}
+
+func SetRolloutHandler(c *gin.Context) {
+	var request SetRolloutRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Percentage == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A rollout percentage is required"})
+		return
+	}
+	currentUpdate, ok := getUpdateFromParams(c)
+	if !ok {
+		return
+	}
+	rollout, err := update.SetRolloutPercentage(*currentUpdate, *request.Percentage)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
+
+func PromoteRolloutHandler(c *gin.Context) {
+	currentUpdate, ok := getUpdateFromParams(c)
+	if !ok {
+		return
+	}
+	rollout, err := update.PromoteRollout(*currentUpdate)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
+
+func AbortRolloutHandler(c *gin.Context) {
+	currentUpdate, ok := getUpdateFromParams(c)
+	if !ok {
+		return
+	}
+	rollout, err := update.AbortRollout(*currentUpdate)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
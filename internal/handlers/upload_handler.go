@@ -4,12 +4,12 @@ import (
 	"encoding/json"
 	"expo-open-ota/internal/auth"
 	"expo-open-ota/internal/bucket"
-	"expo-open-ota/internal/config"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
 	"fmt"
 	"log"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 
@@ -19,6 +19,9 @@ import (
 
 type FileNamesRequest struct {
 	FileNames []string `json:"fileNames"`
+	// Files announces the SHA-256 and size of each file, checked when the
+	// update is marked as uploaded
+	Files []types.UploadFile `json:"files"`
 }
 
 func UploadHandler(c *gin.Context) {
@@ -84,8 +87,8 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 	// No token verification needed if no auth header provided - similar to RequestUploadUrlHandler
 
 	// Check if we're using a local bucket
-	bucketType := config.GetEnv("BUCKET_TYPE")
-	if bucketType != string(bucket.LocalBucketType) {
+	bucketType := bucket.ResolveBucketType()
+	if bucketType != bucket.LocalBucketType {
 		log.Printf("Invalid bucket type: %s", bucketType)
 		http.Error(w, "Invalid bucket type", http.StatusInternalServerError)
 		return
@@ -136,7 +139,7 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	resolvedBucket := bucket.GetBucket()
 	errorVerify := update.VerifyUploadedUpdate(*currentUpdate)
-	if err != nil {
+	if errorVerify != nil {
 		// Delete folder and throw error
 		log.Printf("[RequestID: %s] Invalid update, deleting folder...", requestID)
 		err := resolvedBucket.DeleteUpdateFolder(branchName, runtimeVersion, updateId)
@@ -149,6 +152,11 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Invalid update %s", errorVerify), http.StatusBadRequest)
 		return
 	}
+	if err := update.IngestContentAssets(*currentUpdate); err != nil {
+		log.Printf("[RequestID: %s] Error moving update to the content store: %v", requestID, err)
+		http.Error(w, "Error storing update assets", http.StatusInternalServerError)
+		return
+	}
 	// Now we have to retrieve the latest update and compare hash changes
 	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branchName, runtimeVersion, buildNumber)
 	if err != nil || latestUpdate == nil {
@@ -291,6 +299,21 @@ func RequestUploadUrlHandler(c *gin.Context) {
 		return
 	}
 
+	if err := update.ValidateUploadFiles(request.Files); err != nil {
+		log.Printf("[RequestID: %s] Invalid files: %v", requestID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	announcedFileNames := make(map[string]bool, len(request.FileNames))
+	for _, fileName := range request.FileNames {
+		announcedFileNames[fileName] = true
+	}
+	for _, file := range request.Files {
+		if !announcedFileNames[file.Name] {
+			request.FileNames = append(request.FileNames, file.Name)
+		}
+	}
+
 	if len(request.FileNames) == 0 {
 		log.Printf("[RequestID: %s] No file names provided", requestID)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file names provided"})
@@ -313,9 +336,24 @@ func RequestUploadUrlHandler(c *gin.Context) {
 		log.Printf("[RequestID: %s] Generated standard update ID: %s", requestID, updateId)
 	}
 
+	// Skip files the content store already holds
+	deduplicatedFiles, err := update.FilterDeduplicatedFiles(request.Files)
+	if err != nil {
+		log.Printf("[RequestID: %s] Error checking the content store: %v", requestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting upload URLs"})
+		return
+	}
+	fileNamesToUpload := make([]string, 0, len(request.FileNames))
+	for _, fileName := range request.FileNames {
+		if !deduplicatedFiles[fileName] {
+			fileNamesToUpload = append(fileNamesToUpload, fileName)
+		}
+	}
+	log.Printf("[RequestID: %s] %d files to upload, %d already stored", requestID, len(fileNamesToUpload), len(deduplicatedFiles))
+
 	// Request upload URLs
 	resolvedBucket := bucket.GetBucket()
-	requests, err := resolvedBucket.RequestUploadUrlsForFileUpdates(branchName, runtimeVersion, updateId, request.FileNames)
+	requests, err := resolvedBucket.RequestUploadUrlsForFileUpdates(branchName, runtimeVersion, updateId, fileNamesToUpload)
 	if err != nil {
 		log.Printf("[RequestID: %s] Error requesting upload URLs: %v", requestID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting upload URLs"})
@@ -340,6 +378,14 @@ func RequestUploadUrlHandler(c *gin.Context) {
 		return
 	}
 
+	if len(request.Files) > 0 {
+		if err := update.SaveUploadIntegrity(newUpdate, request.Files); err != nil {
+			log.Printf("[RequestID: %s] Error saving upload integrity: %v", requestID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating update record"})
+			return
+		}
+	}
+
 	// Check if we have any URLs
 	if len(requests) == 0 {
 		log.Printf("[RequestID: %s] No URLs generated", requestID)
@@ -348,21 +394,31 @@ func RequestUploadUrlHandler(c *gin.Context) {
 	}
 
 	// Create an array of upload requests in the format expected by the client
-	uploadRequests := make([]map[string]string, 0, len(requests))
+	uploadRequests := make([]gin.H, 0, len(requests))
 
 	for _, req := range requests {
-		fileName := strings.TrimPrefix(req.Path, fmt.Sprintf("updates/%s/%s/%s/", branchName, runtimeVersion, updateId))
-		uploadRequests = append(uploadRequests, map[string]string{
+		fileName := strings.TrimPrefix(req.Path, path.Join(branchName, runtimeVersion, updateId)+"/")
+		uploadRequest := gin.H{
 			"requestUploadUrl": req.Url,
 			"fileName":         fileName,
 			"filePath":         req.Path,
-		})
+		}
+		if len(req.Headers) > 0 {
+			uploadRequest["headers"] = req.Headers
+		}
+		uploadRequests = append(uploadRequests, uploadRequest)
+	}
+
+	skippedFiles := make([]string, 0, len(deduplicatedFiles))
+	for fileName := range deduplicatedFiles {
+		skippedFiles = append(skippedFiles, fileName)
 	}
 
 	response := map[string]interface{}{
-		"updateId":       updateId,
-		"buildNumber":    buildNumber, // Include build number in response
-		"uploadRequests": uploadRequests,
+		"updateId":          updateId,
+		"buildNumber":       buildNumber, // Include build number in response
+		"uploadRequests":    uploadRequests,
+		"deduplicatedFiles": skippedFiles,
 	}
 
 	// Log the response for debugging
@@ -1,11 +1,16 @@
 package keyStore
 
-import "expo-open-ota/internal/services"
+import (
+	"expo-open-ota/config"
+	"expo-open-ota/internal/services"
+	"fmt"
+)
 
 type AWSSMKeysStorage struct {
 	publicExpoKeySecretID        string
 	privateExpoKeySecretID       string
 	privateCloudfrontKeySecretID string
+	certificateChainSecretID     string
 }
 
 func (c *AWSSMKeysStorage) GetPublicExpoKey() string {
@@ -28,3 +33,63 @@ func (c *AWSSMKeysStorage) GetPrivateCloudfrontKey() string {
 	}
 	return services.FetchSecret(c.privateCloudfrontKeySecretID)
 }
+
+func (c *AWSSMKeysStorage) GetPublicExpoKeyById(keyId string) string {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.GetPublicExpoKey()
+	}
+	secretID := config.GetEnv(KeyIdEnvName("AWSSM_EXPO_PUBLIC_KEY_SECRET_ID", keyId))
+	if secretID == "" {
+		return ""
+	}
+	return services.FetchSecret(secretID)
+}
+
+func (c *AWSSMKeysStorage) GetPrivateExpoKeyById(keyId string) string {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.GetPrivateExpoKey()
+	}
+	secretID := config.GetEnv(KeyIdEnvName("AWSSM_EXPO_PRIVATE_KEY_SECRET_ID", keyId))
+	if secretID == "" {
+		return ""
+	}
+	return services.FetchSecret(secretID)
+}
+
+func (c *AWSSMKeysStorage) secretIDs(keyId string) (string, string, string) {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.publicExpoKeySecretID, c.privateExpoKeySecretID, c.certificateChainSecretID
+	}
+	return config.GetEnv(KeyIdEnvName("AWSSM_EXPO_PUBLIC_KEY_SECRET_ID", keyId)),
+		config.GetEnv(KeyIdEnvName("AWSSM_EXPO_PRIVATE_KEY_SECRET_ID", keyId)),
+		config.GetEnv(KeyIdEnvName("AWSSM_EXPO_CERTIFICATE_CHAIN_SECRET_ID", keyId))
+}
+
+func (c *AWSSMKeysStorage) GetExpoCertificateChainById(keyId string) string {
+	_, _, certificateChainSecretID := c.secretIDs(keyId)
+	if certificateChainSecretID == "" {
+		return ""
+	}
+	return services.FetchSecret(certificateChainSecretID)
+}
+
+func (c *AWSSMKeysStorage) StoreExpoKeys(keyId string, keys ExpoKeys) error {
+	publicKeySecretID, privateKeySecretID, certificateChainSecretID := c.secretIDs(keyId)
+	if publicKeySecretID == "" || privateKeySecretID == "" {
+		return fmt.Errorf("%s and %s must be set in environment",
+			KeyIdEnvName("AWSSM_EXPO_PUBLIC_KEY_SECRET_ID", keyId), KeyIdEnvName("AWSSM_EXPO_PRIVATE_KEY_SECRET_ID", keyId))
+	}
+	if keys.CertificateChain != "" && certificateChainSecretID == "" {
+		return fmt.Errorf("%s must be set in environment", KeyIdEnvName("AWSSM_EXPO_CERTIFICATE_CHAIN_SECRET_ID", keyId))
+	}
+	if err := services.StoreSecret(privateKeySecretID, keys.PrivateKey); err != nil {
+		return err
+	}
+	if err := services.StoreSecret(publicKeySecretID, keys.PublicKey); err != nil {
+		return err
+	}
+	if keys.CertificateChain != "" {
+		return services.StoreSecret(certificateChainSecretID, keys.CertificateChain)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ type EnvironmentKeysStorage struct {
 	publicExpoKeyBase64Key        string
 	privateExpoKeyBase64Key       string
 	privateCloudfrontKeyBase64Key string
+	certificateChainBase64Key     string
 }
 
 func decodeKey(key string) string {
@@ -35,3 +36,21 @@ func (c *EnvironmentKeysStorage) GetPrivateExpoKey() string {
 func (c *EnvironmentKeysStorage) GetPrivateCloudfrontKey() string {
 	return decodeKey(config.GetEnv(c.privateCloudfrontKeyBase64Key))
 }
+
+func (c *EnvironmentKeysStorage) GetPublicExpoKeyById(keyId string) string {
+	return decodeKey(config.GetEnv(KeyIdEnvName(c.publicExpoKeyBase64Key, keyId)))
+}
+
+func (c *EnvironmentKeysStorage) GetPrivateExpoKeyById(keyId string) string {
+	return decodeKey(config.GetEnv(KeyIdEnvName(c.privateExpoKeyBase64Key, keyId)))
+}
+
+func (c *EnvironmentKeysStorage) GetExpoCertificateChainById(keyId string) string {
+	return decodeKey(config.GetEnv(KeyIdEnvName(c.certificateChainBase64Key, keyId)))
+}
+
+// StoreExpoKeys cannot write environment variables, they have to be set from
+// the values printed by the certificate generation command.
+func (c *EnvironmentKeysStorage) StoreExpoKeys(keyId string, keys ExpoKeys) error {
+	return ErrReadOnlyKeysStorage
+}
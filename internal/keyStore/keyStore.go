@@ -1,8 +1,12 @@
 package keyStore
 
 import (
+	"errors"
 	"expo-open-ota/config"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
 )
 
 type KeysStorageType string
@@ -13,10 +17,115 @@ const (
 	Environment       KeysStorageType = "environment"
 )
 
+// DefaultKeyId is the keyid of the key configured by the unsuffixed variables.
+const DefaultKeyId = "main"
+
+type KeyStatus string
+
+const (
+	// KeyActive signs responses for clients that do not ask for a specific keyid.
+	KeyActive KeyStatus = "active"
+	// KeyRetiring only signs responses for clients asking for it, i.e. builds
+	// embedding its certificate.
+	KeyRetiring KeyStatus = "retiring"
+)
+
+type SigningKey struct {
+	KeyId  string
+	Status KeyStatus
+}
+
+// ExpoKeys is the key material of a signing key. CertificateChain holds the
+// PEM certificates served in the certificate_chain part, leaf first.
+type ExpoKeys struct {
+	PublicKey        string
+	PrivateKey       string
+	CertificateChain string
+}
+
+var ErrReadOnlyKeysStorage = errors.New("keys storage does not support storing keys")
+
 type KeysStorage interface {
 	GetPublicExpoKey() string
 	GetPrivateExpoKey() string
 	GetPrivateCloudfrontKey() string
+	GetPublicExpoKeyById(keyId string) string
+	GetPrivateExpoKeyById(keyId string) string
+	GetExpoCertificateChainById(keyId string) string
+	StoreExpoKeys(keyId string, keys ExpoKeys) error
+}
+
+var keyIdSanitizer = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// KeyIdEnvName returns the variable holding a key for the given keyid: the
+// variable itself for the default key, suffixed with the upper-cased keyid
+// otherwise (PRIVATE_EXPO_KEY_B64_2025 for keyid "2025").
+func KeyIdEnvName(name string, keyId string) string {
+	if keyId == "" || keyId == DefaultKeyId {
+		return name
+	}
+	return name + "_" + strings.ToUpper(keyIdSanitizer.ReplaceAllString(keyId, "_"))
+}
+
+// GetSigningKeys parses EXPO_SIGNING_KEYS, a comma separated list of
+// keyid[:status] entries such as "2025:active,main:retiring". When it is not
+// set, the single key "main" is active. If no key is marked active, the first
+// one is.
+func GetSigningKeys() []SigningKey {
+	value := strings.TrimSpace(config.GetEnv("EXPO_SIGNING_KEYS"))
+	if value == "" {
+		return []SigningKey{{KeyId: DefaultKeyId, Status: KeyActive}}
+	}
+	var keys []SigningKey
+	hasActive := false
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if parts[0] == "" {
+			continue
+		}
+		key := SigningKey{KeyId: parts[0], Status: KeyRetiring}
+		if len(parts) == 2 {
+			switch KeyStatus(strings.TrimSpace(parts[1])) {
+			case KeyActive:
+				if hasActive {
+					log.Printf("Warning: several active signing keys configured, %s is kept as retiring", key.KeyId)
+				} else {
+					key.Status = KeyActive
+					hasActive = true
+				}
+			case KeyRetiring:
+			default:
+				log.Printf("Warning: unknown status %q for signing key %s, treating it as retiring", parts[1], key.KeyId)
+			}
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return []SigningKey{{KeyId: DefaultKeyId, Status: KeyActive}}
+	}
+	if !hasActive {
+		keys[0].Status = KeyActive
+	}
+	return keys
+}
+
+// ResolveSigningKeyId picks the key signing a response: the keyid requested by
+// the client when it is configured, the active key otherwise.
+func ResolveSigningKeyId(requestedKeyId string) string {
+	keys := GetSigningKeys()
+	activeKeyId := keys[0].KeyId
+	for _, key := range keys {
+		if requestedKeyId != "" && key.KeyId == requestedKeyId {
+			return key.KeyId
+		}
+		if key.Status == KeyActive {
+			activeKeyId = key.KeyId
+		}
+	}
+	if requestedKeyId != "" {
+		log.Printf("Warning: client requested unknown signing keyid %s, using active key %s", requestedKeyId, activeKeyId)
+	}
+	return activeKeyId
 }
 
 func getStorage() (KeysStorage, error) {
@@ -34,6 +143,7 @@ func getStorage() (KeysStorage, error) {
 		publicKeySecretID := config.GetEnv("AWSSM_EXPO_PUBLIC_KEY_SECRET_ID")
 		privateKeySecretID := config.GetEnv("AWSSM_EXPO_PRIVATE_KEY_SECRET_ID")
 		privateCloudfrontKeySecretID := config.GetEnv("AWSSM_CLOUDFRONT_PRIVATE_KEY_SECRET_ID")
+		certificateChainSecretID := config.GetEnv("AWSSM_EXPO_CERTIFICATE_CHAIN_SECRET_ID")
 		if publicKeySecretID == "" || privateKeySecretID == "" {
 			return nil, fmt.Errorf("PUBLIC_KEY_SECRET_ID, PRIVATE_KEY_SECRET_ID must be set in environment")
 		}
@@ -41,11 +151,13 @@ func getStorage() (KeysStorage, error) {
 			publicExpoKeySecretID:        publicKeySecretID,
 			privateExpoKeySecretID:       privateKeySecretID,
 			privateCloudfrontKeySecretID: privateCloudfrontKeySecretID,
+			certificateChainSecretID:     certificateChainSecretID,
 		}, nil
 	case LocalFiles:
 		publicKeyPath := config.GetEnv("PUBLIC_LOCAL_EXPO_KEY_PATH")
 		privateKeyPath := config.GetEnv("PRIVATE_LOCAL_EXPO_KEY_PATH")
 		privateCloudfrontKeyPath := config.GetEnv("PRIVATE_CLOUDFRONT_KEY_PATH")
+		certificateChainPath := config.GetEnv("LOCAL_EXPO_CERTIFICATE_CHAIN_PATH")
 		if publicKeyPath == "" || privateKeyPath == "" {
 			return nil, fmt.Errorf("PUBLIC_KEY_PATH and PRIVATE_KEY_PATH must be set in environment")
 		}
@@ -53,12 +165,14 @@ func getStorage() (KeysStorage, error) {
 			publicExpoKeyPath:        publicKeyPath,
 			privateExpoKeyPath:       privateKeyPath,
 			privateCloudfrontKeyPath: privateCloudfrontKeyPath,
+			certificateChainPath:     certificateChainPath,
 		}, nil
 	case Environment:
 		return &EnvironmentKeysStorage{
 			publicExpoKeyBase64Key:        "PUBLIC_EXPO_KEY_B64",
 			privateExpoKeyBase64Key:       "PRIVATE_EXPO_KEY_B64",
 			privateCloudfrontKeyBase64Key: "PRIVATE_CLOUDFRONT_KEY_B64",
+			certificateChainBase64Key:     "EXPO_CERTIFICATE_CHAIN_B64",
 		}, nil
 	default:
 		return nil, fmt.Errorf("unknown keyStore storage type: %s", storageType)
@@ -88,3 +202,37 @@ func GetPrivateCloudfrontKey() string {
 	}
 	return storage.GetPrivateCloudfrontKey()
 }
+
+func GetPublicExpoKeyById(keyId string) string {
+	storage, err := getStorage()
+	if err != nil {
+		return ""
+	}
+	return storage.GetPublicExpoKeyById(keyId)
+}
+
+func GetPrivateExpoKeyById(keyId string) string {
+	storage, err := getStorage()
+	if err != nil {
+		return ""
+	}
+	return storage.GetPrivateExpoKeyById(keyId)
+}
+
+// GetExpoCertificateChainById returns the certificate chain of a signing key,
+// or an empty string when the key is used without a chain.
+func GetExpoCertificateChainById(keyId string) string {
+	storage, err := getStorage()
+	if err != nil {
+		return ""
+	}
+	return storage.GetExpoCertificateChainById(keyId)
+}
+
+func StoreExpoKeys(keyId string, keys ExpoKeys) error {
+	storage, err := getStorage()
+	if err != nil {
+		return err
+	}
+	return storage.StoreExpoKeys(keyId, keys)
+}
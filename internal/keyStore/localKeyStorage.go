@@ -1,15 +1,18 @@
 package keyStore
 
 import (
+	"expo-open-ota/config"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 type LocalKeysStorage struct {
 	privateExpoKeyPath       string
 	publicExpoKeyPath        string
 	privateCloudfrontKeyPath string
+	certificateChainPath     string
 }
 
 func retrieveFileContent(path string) string {
@@ -49,3 +52,77 @@ func (c *LocalKeysStorage) GetPrivateCloudfrontKey() string {
 	}
 	return retrieveFileContent(c.privateCloudfrontKeyPath)
 }
+
+func (c *LocalKeysStorage) GetPublicExpoKeyById(keyId string) string {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.GetPublicExpoKey()
+	}
+	path := config.GetEnv(KeyIdEnvName("PUBLIC_LOCAL_EXPO_KEY_PATH", keyId))
+	if path == "" {
+		return ""
+	}
+	return retrieveFileContent(path)
+}
+
+func (c *LocalKeysStorage) GetPrivateExpoKeyById(keyId string) string {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.GetPrivateExpoKey()
+	}
+	path := config.GetEnv(KeyIdEnvName("PRIVATE_LOCAL_EXPO_KEY_PATH", keyId))
+	if path == "" {
+		return ""
+	}
+	return retrieveFileContent(path)
+}
+
+func (c *LocalKeysStorage) keyPaths(keyId string) (string, string, string) {
+	if keyId == "" || keyId == DefaultKeyId {
+		return c.publicExpoKeyPath, c.privateExpoKeyPath, c.certificateChainPath
+	}
+	return config.GetEnv(KeyIdEnvName("PUBLIC_LOCAL_EXPO_KEY_PATH", keyId)),
+		config.GetEnv(KeyIdEnvName("PRIVATE_LOCAL_EXPO_KEY_PATH", keyId)),
+		config.GetEnv(KeyIdEnvName("LOCAL_EXPO_CERTIFICATE_CHAIN_PATH", keyId))
+}
+
+func (c *LocalKeysStorage) GetExpoCertificateChainById(keyId string) string {
+	_, _, certificateChainPath := c.keyPaths(keyId)
+	if certificateChainPath == "" {
+		return ""
+	}
+	// The chain is optional, do not report a missing file on every request
+	if _, err := os.Stat(certificateChainPath); os.IsNotExist(err) {
+		return ""
+	}
+	return retrieveFileContent(certificateChainPath)
+}
+
+func writeKeyFile(path string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *LocalKeysStorage) StoreExpoKeys(keyId string, keys ExpoKeys) error {
+	publicKeyPath, privateKeyPath, certificateChainPath := c.keyPaths(keyId)
+	if publicKeyPath == "" || privateKeyPath == "" {
+		return fmt.Errorf("%s and %s must be set in environment",
+			KeyIdEnvName("PUBLIC_LOCAL_EXPO_KEY_PATH", keyId), KeyIdEnvName("PRIVATE_LOCAL_EXPO_KEY_PATH", keyId))
+	}
+	if keys.CertificateChain != "" && certificateChainPath == "" {
+		return fmt.Errorf("%s must be set in environment", KeyIdEnvName("LOCAL_EXPO_CERTIFICATE_CHAIN_PATH", keyId))
+	}
+	if err := writeKeyFile(privateKeyPath, keys.PrivateKey); err != nil {
+		return err
+	}
+	if err := writeKeyFile(publicKeyPath, keys.PublicKey); err != nil {
+		return err
+	}
+	if keys.CertificateChain != "" {
+		return writeKeyFile(certificateChainPath, keys.CertificateChain)
+	}
+	return nil
+}
@@ -18,20 +18,39 @@ var (
 	updateDownloadsVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_downloads_total",
-			Help: "Total number of update downloads per platform, runtime version, branch and update",
+			Help: "Total number of update downloads per platform, runtime version, channel, served branch and update",
 		},
-		[]string{"platform", "runtime", "branch", "update", "updateType"},
+		[]string{"platform", "runtime", "channel", "branch", "update", "updateType"},
 	)
+	cacheHitsVec      = newCacheCounterVec("cache_hits_total", "Total number of cache lookups answered per cache tier")
+	cacheMissesVec    = newCacheCounterVec("cache_misses_total", "Total number of cache lookups not answered per cache tier")
+	cacheEvictionsVec = newCacheCounterVec("cache_evictions_total", "Total number of cache entries evicted to stay within the size bound per cache tier")
 )
 
+func newCacheCounterVec(name string, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: name,
+			Help: help,
+		},
+		[]string{"tier"},
+	)
+}
+
 func InitMetrics() {
 	prometheus.MustRegister(activeUsersVec)
 	prometheus.MustRegister(updateDownloadsVec)
+	prometheus.MustRegister(cacheHitsVec)
+	prometheus.MustRegister(cacheMissesVec)
+	prometheus.MustRegister(cacheEvictionsVec)
 }
 
 func CleanupMetrics() {
 	prometheus.Unregister(activeUsersVec)
 	prometheus.Unregister(updateDownloadsVec)
+	prometheus.Unregister(cacheHitsVec)
+	prometheus.Unregister(cacheMissesVec)
+	prometheus.Unregister(cacheEvictionsVec)
 }
 
 func TrackActiveUser(clientId, platform, runtime, branch, update string) {
@@ -41,11 +60,26 @@ func TrackActiveUser(clientId, platform, runtime, branch, update string) {
 	activeUsersVec.WithLabelValues(clientId, platform, runtime, branch, update).Set(1)
 }
 
-func TrackUpdateDownload(platform, runtime, branch, update, updateType string) {
+// TrackUpdateDownload counts a download, branch being the branch the channel
+// resolved to for this client.
+func TrackUpdateDownload(platform, runtime, channel, branch, update, updateType string) {
 	if update == "" || platform == "" || branch == "" {
 		return
 	}
-	updateDownloadsVec.WithLabelValues(platform, runtime, branch, update, updateType).Inc()
+	updateDownloadsVec.WithLabelValues(platform, runtime, channel, branch, update, updateType).Inc()
+}
+
+// TrackCacheHit counts a lookup answered by a cache tier, local or redis.
+func TrackCacheHit(tier string) {
+	cacheHitsVec.WithLabelValues(tier).Inc()
+}
+
+func TrackCacheMiss(tier string) {
+	cacheMissesVec.WithLabelValues(tier).Inc()
+}
+
+func TrackCacheEviction(tier string) {
+	cacheEvictionsVec.WithLabelValues(tier).Inc()
 }
 
 func PrometheusHandler() http.Handler {
@@ -63,8 +97,11 @@ func ResetMetricsForTest() {
 	updateDownloadsVec = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "update_downloads_total",
-			Help: "Total number of update downloads per platform, runtime version, branch and update",
+			Help: "Total number of update downloads per platform, runtime version, channel, served branch and update",
 		},
-		[]string{"platform", "runtime", "branch", "update", "updateType"},
+		[]string{"platform", "runtime", "channel", "branch", "update", "updateType"},
 	)
+	cacheHitsVec = newCacheCounterVec("cache_hits_total", "Total number of cache lookups answered per cache tier")
+	cacheMissesVec = newCacheCounterVec("cache_misses_total", "Total number of cache lookups not answered per cache tier")
+	cacheEvictionsVec = newCacheCounterVec("cache_evictions_total", "Total number of cache entries evicted to stay within the size bound per cache tier")
 }
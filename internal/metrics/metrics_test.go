@@ -71,10 +71,11 @@ func getActiveUsers(platform, runtime, branch, update string) float64 {
 	})
 }
 
-func getTotalUpdateDownloads(platform, runtime, branch, update, updateType string) float64 {
+func getTotalUpdateDownloads(platform, runtime, channel, branch, update, updateType string) float64 {
 	return getMetricValue("update_downloads_total", map[string]string{
 		"platform":   platform,
 		"runtime":    runtime,
+		"channel":    channel,
 		"branch":     branch,
 		"update":     update,
 		"updateType": updateType,
@@ -86,16 +87,30 @@ func TestTrackUpdateDownload(t *testing.T) {
 	defer teardown()
 	platform := "ios"
 	runtime := "1.0.0"
+	channel := "production"
 	branch := "stable"
 	update := "update42"
 	updateType := "normal"
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
-	val := getTotalUpdateDownloads(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload(platform, runtime, channel, branch, update, updateType)
+	val := getTotalUpdateDownloads(platform, runtime, channel, branch, update, updateType)
 	if val != 1 {
 		t.Errorf("Expected update_downloads_total to be 1, got %v", val)
 	}
 }
 
+func TestTrackUpdateDownloadRecordsServedBranch(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	metrics.TrackUpdateDownload("ios", "1.0.0", "production", "main", "update42", "update")
+	metrics.TrackUpdateDownload("ios", "1.0.0", "production", "experiment", "update43", "update")
+	if got := getTotalUpdateDownloads("ios", "1.0.0", "production", "^main$", "update42", "update"); got != 1 {
+		t.Errorf("Expected 1 download served from main, got %v", got)
+	}
+	if got := getTotalUpdateDownloads("ios", "1.0.0", "production", "^experiment$", "update43", "update"); got != 1 {
+		t.Errorf("Expected 1 download served from experiment, got %v", got)
+	}
+}
+
 func TestTrackActiveUser(t *testing.T) {
 	teardown := setupMetrics(t)
 	defer teardown()
@@ -137,18 +152,19 @@ func TestGetTotalUpdateDownloadsByUpdate(t *testing.T) {
 	defer teardown()
 	platform := "ios"
 	runtime := "1.0.0"
+	channel := "production"
 	branch := "stable"
 	update := "update42"
 	updateType := "normal"
-	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 0 {
+	if got := getTotalUpdateDownloads(platform, runtime, channel, branch, update, updateType); got != 0 {
 		t.Errorf("Expected total update downloads to be 0, got %v", got)
 	}
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
-	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 1 {
+	metrics.TrackUpdateDownload(platform, runtime, channel, branch, update, updateType)
+	if got := getTotalUpdateDownloads(platform, runtime, channel, branch, update, updateType); got != 1 {
 		t.Errorf("Expected total update downloads to be 1, got %v", got)
 	}
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
-	if got := getTotalUpdateDownloads(platform, runtime, branch, update, updateType); got != 2 {
+	metrics.TrackUpdateDownload(platform, runtime, channel, branch, update, updateType)
+	if got := getTotalUpdateDownloads(platform, runtime, channel, branch, update, updateType); got != 2 {
 		t.Errorf("Expected total update downloads to be 2, got %v", got)
 	}
 }
@@ -158,10 +174,11 @@ func TestPrometheusHandler(t *testing.T) {
 	defer teardown()
 	platform := "ios"
 	runtime := "1.0.0"
+	channel := "production"
 	branch := "stable"
 	update := "update42"
 	updateType := "normal"
-	metrics.TrackUpdateDownload(platform, runtime, branch, update, updateType)
+	metrics.TrackUpdateDownload(platform, runtime, channel, branch, update, updateType)
 	req := httptest.NewRequest("GET", "/metrics", nil)
 	rr := httptest.NewRecorder()
 	handler := promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})
@@ -171,3 +188,21 @@ func TestPrometheusHandler(t *testing.T) {
 		t.Errorf("Expected update_downloads_total in metrics, got %s", body)
 	}
 }
+
+func TestTrackCacheCounters(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	metrics.TrackCacheHit("local")
+	metrics.TrackCacheHit("local")
+	metrics.TrackCacheMiss("redis")
+	metrics.TrackCacheEviction("local")
+	if got := getMetricValue("cache_hits_total", map[string]string{"tier": "^local$"}); got != 2 {
+		t.Errorf("Expected 2 local cache hits, got %v", got)
+	}
+	if got := getMetricValue("cache_misses_total", map[string]string{"tier": "^redis$"}); got != 1 {
+		t.Errorf("Expected 1 redis cache miss, got %v", got)
+	}
+	if got := getMetricValue("cache_evictions_total", map[string]string{"tier": "^local$"}); got != 1 {
+		t.Errorf("Expected 1 local cache eviction, got %v", got)
+	}
+}
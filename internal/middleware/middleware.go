@@ -30,3 +30,21 @@ func AuthMiddleware(c *gin.Context) {
 	}
 	c.Next()
 }
+
+// DashboardAuthMiddleware only lets through requests carrying a valid
+// dashboard access token.
+func DashboardAuthMiddleware(c *gin.Context) {
+	authHeader := c.GetHeader("Authorization")
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if authHeader == "" || token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization token"})
+		c.Abort()
+		return
+	}
+	if _, err := auth.NewAuth().ValidateToken(token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization token"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,110 @@
+package retention
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// leaseObjectKey is the lock object processes take before pruning, so a single
+// one deletes at a time.
+const leaseObjectKey = "locks/retention.json"
+
+var instanceId = uuid.New().String()
+
+// ErrLeaseHeld is returned when another process holds the retention lease.
+var ErrLeaseHeld = errors.New("another process holds the retention lease")
+
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// readLease returns the current lease, nil when none was ever taken, and the
+// version of the lease object writes are conditioned on.
+func readLease() (*lease, string, error) {
+	object, version, err := bucket.GetBucket().GetObjectWithVersion(leaseObjectKey)
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading retention lease: %w", err)
+	}
+	defer object.Close()
+	var current lease
+	if err := json.NewDecoder(object).Decode(&current); err != nil {
+		return nil, "", fmt.Errorf("error decoding retention lease: %w", err)
+	}
+	return &current, version, nil
+}
+
+// writeLease replaces the lease object read at version. It returns false
+// when another process wrote it meanwhile.
+func writeLease(next lease, version string) (bool, error) {
+	content, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	err = bucket.GetBucket().PutObjectIfVersion(leaseObjectKey, bytes.NewReader(content), version)
+	if errors.Is(err, bucket.ErrVersionConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error writing retention lease: %w", err)
+	}
+	return true, nil
+}
+
+// acquireLease takes the retention lease for ttl on behalf of holder. It
+// returns false while another holder has an unexpired lease, or when another
+// process took it between the read and the write.
+func acquireLease(holder string, ttl time.Duration) (bool, error) {
+	current, version, err := readLease()
+	if err != nil {
+		return false, err
+	}
+	if current != nil && current.Holder != holder && time.Now().Before(current.ExpiresAt) {
+		return false, nil
+	}
+	return writeLease(lease{Holder: holder, ExpiresAt: time.Now().Add(ttl)}, version)
+}
+
+// releaseLease expires the lease of holder so others can take it right away.
+// Leases taken over meanwhile are left alone.
+func releaseLease(holder string) error {
+	current, version, err := readLease()
+	if err != nil || current == nil || current.Holder != holder {
+		return err
+	}
+	_, err = writeLease(lease{Holder: holder, ExpiresAt: time.Now()}, version)
+	return err
+}
+
+// PruneExclusively runs Prune while holding the retention lease for ttl, so
+// it never deletes alongside the background job of a server. It returns
+// ErrLeaseHeld while another process prunes. Dry runs delete nothing and
+// skip the lease.
+func PruneExclusively(policies Policies, dryRun bool, ttl time.Duration) (*Report, error) {
+	if dryRun {
+		return Prune(policies, dryRun)
+	}
+	acquired, err := acquireLease(instanceId, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLeaseHeld
+	}
+	defer func() {
+		if err := releaseLease(instanceId); err != nil {
+			log.Printf("Error releasing the retention lease: %v", err)
+		}
+	}()
+	return Prune(policies, dryRun)
+}
@@ -0,0 +1,73 @@
+package retention
+
+import (
+	"expo-open-ota/internal/bucket"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useLocalBucket(t *testing.T) {
+	t.Setenv("BUCKET_TYPE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	bucket.ResetBucketInstance()
+	t.Cleanup(bucket.ResetBucketInstance)
+}
+
+func TestLeaseHasOneHolderUntilItExpires(t *testing.T) {
+	useLocalBucket(t)
+
+	acquired, err := acquireLease("replica-a", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = acquireLease("replica-b", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	// The holder renews its own lease
+	acquired, err = acquireLease("replica-a", -time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = acquireLease("replica-b", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	acquired, err = acquireLease("replica-a", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+}
+
+func TestLeaseWriteLosesToAWriteMadeSinceItsRead(t *testing.T) {
+	useLocalBucket(t)
+	// Both replicas find no lease, replica-a writes it first
+	_, version, err := readLease()
+	require.NoError(t, err)
+	acquired, err := acquireLease("replica-a", time.Hour)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	acquired, err = writeLease(lease{Holder: "replica-b", ExpiresAt: time.Now().Add(time.Hour)}, version)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+	current, _, err := readLease()
+	require.NoError(t, err)
+	assert.Equal(t, "replica-a", current.Holder)
+}
+
+func TestPruneExclusivelyWaitsForTheLease(t *testing.T) {
+	useLocalBucket(t)
+	acquired, err := acquireLease("replica-a", time.Hour)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	_, err = PruneExclusively(Policies{}, false, time.Hour)
+	assert.ErrorIs(t, err, ErrLeaseHeld)
+
+	require.NoError(t, releaseLease("replica-a"))
+	_, err = PruneExclusively(Policies{}, false, time.Hour)
+	require.NoError(t, err)
+	// The lease is released once pruned
+	acquired, err = acquireLease("replica-b", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
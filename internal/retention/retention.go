@@ -0,0 +1,411 @@
+package retention
+
+import (
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orphanGracePeriod keeps recently stored content assets, which an upload in
+// progress may reference without its integrity file being listed yet.
+const orphanGracePeriod = 24 * time.Hour
+
+var ErrInvalidPolicy = errors.New("invalid retention policy")
+
+// Policy decides which updates of a runtime version are kept: the KeepLast
+// newest ones and the ones younger than MaxAge. A zero field disables its rule,
+// a policy without rules keeps everything.
+type Policy struct {
+	KeepLast int           `json:"keepLast,omitempty"`
+	MaxAge   time.Duration `json:"maxAge,omitempty"`
+}
+
+func (p Policy) IsEnabled() bool {
+	return p.KeepLast > 0 || p.MaxAge > 0
+}
+
+// Policies holds the default policy and the per-branch ones replacing it.
+type Policies struct {
+	Default  Policy
+	Branches map[string]Policy
+}
+
+func (p Policies) ForBranch(branch string) Policy {
+	if policy, ok := p.Branches[branch]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+func (p Policies) IsEnabled() bool {
+	if p.Default.IsEnabled() {
+		return true
+	}
+	for _, policy := range p.Branches {
+		if policy.IsEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRule(value string) (int, error) {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%w: %q is not a positive number", ErrInvalidPolicy, value)
+	}
+	return number, nil
+}
+
+// parsePolicy reads rules formatted as keepLast=N,maxAgeDays=D.
+func parsePolicy(rules string) (Policy, error) {
+	var policy Policy
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, value, found := strings.Cut(rule, "=")
+		if !found {
+			return policy, fmt.Errorf("%w: %q", ErrInvalidPolicy, rule)
+		}
+		number, err := parseRule(value)
+		if err != nil {
+			return policy, err
+		}
+		switch strings.TrimSpace(name) {
+		case "keepLast":
+			policy.KeepLast = number
+		case "maxAgeDays":
+			policy.MaxAge = time.Duration(number) * 24 * time.Hour
+		default:
+			return policy, fmt.Errorf("%w: unknown rule %q", ErrInvalidPolicy, name)
+		}
+	}
+	return policy, nil
+}
+
+// ParsePolicies builds the policies from the default rules and the per-branch
+// ones, formatted as branch:keepLast=N,maxAgeDays=D;other:keepLast=N.
+func ParsePolicies(defaultKeepLast string, defaultMaxAgeDays string, branchPolicies string) (Policies, error) {
+	policies := Policies{Branches: map[string]Policy{}}
+	if defaultKeepLast != "" {
+		keepLast, err := parseRule(defaultKeepLast)
+		if err != nil {
+			return policies, err
+		}
+		policies.Default.KeepLast = keepLast
+	}
+	if defaultMaxAgeDays != "" {
+		maxAgeDays, err := parseRule(defaultMaxAgeDays)
+		if err != nil {
+			return policies, err
+		}
+		policies.Default.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	}
+	for _, entry := range strings.Split(branchPolicies, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		branch, rules, _ := strings.Cut(entry, ":")
+		branch = strings.TrimSpace(branch)
+		if branch == "" {
+			return policies, fmt.Errorf("%w: missing branch in %q", ErrInvalidPolicy, entry)
+		}
+		policy, err := parsePolicy(rules)
+		if err != nil {
+			return policies, err
+		}
+		policies.Branches[branch] = policy
+	}
+	return policies, nil
+}
+
+func LoadPolicies() (Policies, error) {
+	return ParsePolicies(
+		config.GetEnv("RETENTION_KEEP_LAST"),
+		config.GetEnv("RETENTION_MAX_AGE_DAYS"),
+		config.GetEnv("RETENTION_POLICIES"),
+	)
+}
+
+type Report struct {
+	DryRun         bool                    `json:"dryRun"`
+	ExpiredUpdates []types.UpdateReference `json:"expiredUpdates"`
+	OrphanedAssets []string                `json:"orphanedAssets"`
+	Errors         []string                `json:"errors,omitempty"`
+}
+
+type candidate struct {
+	update    types.Update
+	createdAt time.Time
+	rollout   *types.Rollout
+}
+
+// protectedCandidates returns the updates that must survive any policy, given
+// candidates ordered as they are served, newest first. Updates down to the
+// first one served to every client are still served, to part of the clients
+// for staged rollouts. The next served update is the one clients go back to
+// when the current one is aborted.
+func protectedCandidates(candidates []candidate) map[int]bool {
+	protected := map[int]bool{}
+	servedToEveryone := 0
+	for i, current := range candidates {
+		if current.rollout != nil && current.rollout.Status == types.RolloutAborted {
+			continue
+		}
+		protected[i] = true
+		if current.rollout == nil || current.rollout.Status == types.RolloutCompleted {
+			servedToEveryone++
+			if servedToEveryone == 2 {
+				break
+			}
+		}
+	}
+	return protected
+}
+
+// selectExpired returns the candidates, ordered newest first, the policy does
+// not keep.
+func selectExpired(candidates []candidate, policy Policy, now time.Time) []types.Update {
+	if !policy.IsEnabled() {
+		return nil
+	}
+	protected := protectedCandidates(candidates)
+	var expired []types.Update
+	for i, current := range candidates {
+		if protected[i] {
+			continue
+		}
+		if policy.KeepLast > 0 && i < policy.KeepLast {
+			continue
+		}
+		if policy.MaxAge > 0 && (current.createdAt.IsZero() || now.Sub(current.createdAt) < policy.MaxAge) {
+			continue
+		}
+		expired = append(expired, current.update)
+	}
+	return expired
+}
+
+func updateCreatedAt(currentUpdate types.Update) time.Time {
+	metadataFile, err := update.ReadUpdateMetadataFile(currentUpdate)
+	if err == nil && metadataFile.CreatedAt != "" {
+		if createdAt, err := time.Parse("2006-01-02T15:04:05.000Z", metadataFile.CreatedAt); err == nil {
+			return createdAt
+		}
+	}
+	if currentUpdate.CreatedAt > 0 {
+		return time.UnixMilli(currentUpdate.CreatedAt.Milliseconds())
+	}
+	return time.Time{}
+}
+
+func loadCandidates(branch string, runtimeVersion string) ([]candidate, error) {
+	updates, err := update.GetValidUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]candidate, 0, len(updates))
+	for _, currentUpdate := range updates {
+		rollout, err := update.GetRollout(currentUpdate)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate{
+			update:    currentUpdate,
+			createdAt: updateCreatedAt(currentUpdate),
+			rollout:   rollout,
+		})
+	}
+	return candidates, nil
+}
+
+// pruneRuntimeVersion deletes the expired updates of a runtime version and
+// returns the ids of the updates gone, or that would be in a dry run.
+func pruneRuntimeVersion(branch string, runtimeVersion string, policy Policy, dryRun bool, report *Report) (map[string]bool, error) {
+	removed := map[string]bool{}
+	if !policy.IsEnabled() {
+		return removed, nil
+	}
+	candidates, err := loadCandidates(branch, runtimeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	var deleted []types.Update
+	for _, expired := range selectExpired(candidates, policy, time.Now()) {
+		report.ExpiredUpdates = append(report.ExpiredUpdates, types.UpdateReference{
+			Branch:         expired.Branch,
+			RuntimeVersion: expired.RuntimeVersion,
+			UpdateId:       expired.UpdateId,
+		})
+		if dryRun {
+			removed[expired.UpdateId] = true
+			continue
+		}
+		if err := resolvedBucket.DeleteUpdateFolder(expired.Branch, expired.RuntimeVersion, expired.UpdateId); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error deleting update %s/%s/%s: %v", expired.Branch, expired.RuntimeVersion, expired.UpdateId, err))
+			continue
+		}
+		removed[expired.UpdateId] = true
+		deleted = append(deleted, expired)
+		log.Printf("Retention: deleted update %s/%s/%s", expired.Branch, expired.RuntimeVersion, expired.UpdateId)
+	}
+	if len(deleted) > 0 {
+		update.InvalidateUpdateCache(cache.InvalidationDelete, deleted...)
+		if err := update.RefreshLatestPointers(branch, runtimeVersion, cache.InvalidationDelete); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error rebuilding latest pointers of %s/%s: %v", branch, runtimeVersion, err))
+		}
+	}
+	return removed, nil
+}
+
+// collectReferencedAssets adds the content hashes used by the remaining
+// updates of a runtime version. Folders are listed in every way the bucket
+// allows, so that an update missed by one listing does not lose its assets.
+func collectReferencedAssets(branch string, runtimeVersion string, removed map[string]bool, referenced map[string]bool) error {
+	resolvedBucket := bucket.GetBucket()
+	updateIds, err := resolvedBucket.ListUpdates(branch, runtimeVersion)
+	if err != nil {
+		return fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	updates, err := update.GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	for _, listedUpdate := range updates {
+		updateIds = append(updateIds, listedUpdate.UpdateId)
+	}
+	for _, updateId := range updateIds {
+		if removed[updateId] {
+			continue
+		}
+		hashes, err := update.ContentAssetHashes(types.Update{
+			Branch:         branch,
+			RuntimeVersion: runtimeVersion,
+			UpdateId:       updateId,
+		})
+		if err != nil {
+			return fmt.Errorf("error reading assets of update %s/%s/%s: %w", branch, runtimeVersion, updateId, err)
+		}
+		for _, sha256Hex := range hashes {
+			referenced[sha256Hex] = true
+		}
+	}
+	return nil
+}
+
+// Prune applies the retention policies to every branch, then removes the
+// content assets no remaining update references. A dry run only reports what
+// would be deleted. Any error while collecting references stops the run
+// before assets are deleted.
+func Prune(policies Policies, dryRun bool) (*Report, error) {
+	report := &Report{
+		DryRun:         dryRun,
+		ExpiredUpdates: []types.UpdateReference{},
+		OrphanedAssets: []string{},
+	}
+	// Listed before the references, assets stored meanwhile are never orphans
+	assets, err := update.ListContentAssets()
+	if err != nil {
+		return nil, fmt.Errorf("error listing content assets: %w", err)
+	}
+
+	resolvedBucket := bucket.GetBucket()
+	branches, err := resolvedBucket.GetBranches()
+	if err != nil {
+		return nil, fmt.Errorf("error listing branches: %w", err)
+	}
+	referenced := map[string]bool{}
+	for _, branch := range branches {
+		runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branch)
+		if err != nil {
+			return nil, fmt.Errorf("error listing runtime versions of %s: %w", branch, err)
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			removed, err := pruneRuntimeVersion(branch, runtimeVersion.RuntimeVersion, policies.ForBranch(branch), dryRun, report)
+			if err != nil {
+				return nil, err
+			}
+			if err := collectReferencedAssets(branch, runtimeVersion.RuntimeVersion, removed, referenced); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, asset := range assets {
+		if referenced[asset.SHA256] || now.Sub(asset.LastModified) < orphanGracePeriod {
+			continue
+		}
+		report.OrphanedAssets = append(report.OrphanedAssets, asset.SHA256)
+		if dryRun {
+			continue
+		}
+		if err := update.DeleteContentAsset(asset.SHA256); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("error deleting content asset %s: %v", asset.SHA256, err))
+		}
+	}
+	log.Printf("Retention: %d expired updates and %d orphaned assets (dry run: %t)",
+		len(report.ExpiredUpdates), len(report.OrphanedAssets), dryRun)
+	return report, nil
+}
+
+// StartBackgroundJob prunes the bucket every RETENTION_INTERVAL when a
+// retention policy is configured. Replicas share a lease in the bucket so only
+// one of them prunes each interval.
+func StartBackgroundJob() {
+	interval := config.GetEnv("RETENTION_INTERVAL")
+	if interval == "" {
+		return
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid RETENTION_INTERVAL %q, retention job disabled", interval)
+		return
+	}
+	policies, err := LoadPolicies()
+	if err != nil {
+		log.Printf("Error loading retention policies, retention job disabled: %v", err)
+		return
+	}
+	if !policies.IsEnabled() {
+		log.Printf("No retention policy configured, retention job disabled")
+		return
+	}
+	log.Printf("Retention job scheduled every %s", duration)
+	go func() {
+		ticker := time.NewTicker(duration)
+		defer ticker.Stop()
+		for range ticker.C {
+			// Every replica runs this loop, the lease holder prunes
+			acquired, err := acquireLease(instanceId, duration)
+			if err != nil {
+				log.Printf("Retention job skipped, error taking the lease: %v", err)
+				continue
+			}
+			if !acquired {
+				log.Printf("Retention job skipped, another replica holds the lease")
+				continue
+			}
+			report, err := Prune(policies, false)
+			if err != nil {
+				log.Printf("Retention job failed: %v", err)
+				continue
+			}
+			for _, reportError := range report.Errors {
+				log.Printf("Retention job: %s", reportError)
+			}
+		}
+	}()
+}
@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"expo-open-ota/internal/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func candidates(now time.Time, ages ...int) []candidate {
+	result := make([]candidate, 0, len(ages))
+	for i, ageDays := range ages {
+		result = append(result, candidate{
+			update:    types.Update{UpdateId: string(rune('a' + i))},
+			createdAt: now.Add(-time.Duration(ageDays) * 24 * time.Hour),
+		})
+	}
+	return result
+}
+
+func updateIds(updates []types.Update) []string {
+	ids := []string{}
+	for _, currentUpdate := range updates {
+		ids = append(ids, currentUpdate.UpdateId)
+	}
+	return ids
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("10", "", "production:keepLast=20,maxAgeDays=90; staging:")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{KeepLast: 10}, policies.ForBranch("feature"))
+	assert.Equal(t, Policy{KeepLast: 20, MaxAge: 90 * 24 * time.Hour}, policies.ForBranch("production"))
+	assert.False(t, policies.ForBranch("staging").IsEnabled())
+	assert.True(t, policies.IsEnabled())
+
+	_, err = ParsePolicies("", "", "production:keep=3")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+	_, err = ParsePolicies("-1", "", "")
+	assert.ErrorIs(t, err, ErrInvalidPolicy)
+}
+
+func TestSelectExpiredKeepsLastOrRecentUpdates(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, []string{"c", "d", "e"}, updateIds(selectExpired(candidates(now, 1, 2, 3, 40, 50), Policy{KeepLast: 2}, now)))
+	assert.Equal(t, []string{"d", "e"}, updateIds(selectExpired(candidates(now, 1, 2, 3, 40, 50), Policy{MaxAge: 30 * 24 * time.Hour}, now)))
+	assert.Equal(t, []string{"d", "e"}, updateIds(selectExpired(candidates(now, 1, 2, 3, 40, 50), Policy{KeepLast: 2, MaxAge: 30 * 24 * time.Hour}, now)))
+	assert.Empty(t, selectExpired(candidates(now, 1, 2, 3, 40, 50), Policy{}, now))
+}
+
+func TestSelectExpiredProtectsServedAndRollbackUpdates(t *testing.T) {
+	now := time.Now()
+	staged := candidates(now, 100, 101, 102, 103, 104, 105)
+	staged[0].rollout = &types.Rollout{Percentage: 10, Status: types.RolloutInProgress}
+	staged[1].rollout = &types.Rollout{Percentage: 50, Status: types.RolloutAborted}
+	// a is staged, c is served to the other clients and d is the rollback target
+	assert.Equal(t, []string{"b", "e", "f"}, updateIds(selectExpired(staged, Policy{KeepLast: 1}, now)))
+}
@@ -85,6 +85,25 @@ func SetupRoutes(router *gin.Engine) {
 		api.GET("/dashboard/runtime-versions/:branch", handlers.GetRuntimeVersionsHandler)
 		api.GET("/dashboard/updates/:branch/:runtimeVersion", handlers.GetUpdatesHandler)
 
+		// Staged rollout routes
+		api.GET("/dashboard/rollout/:branch/:runtimeVersion/:updateId", middleware.DashboardAuthMiddleware, handlers.GetRolloutHandler)
+		api.PUT("/dashboard/rollout/:branch/:runtimeVersion/:updateId", middleware.DashboardAuthMiddleware, handlers.SetRolloutHandler)
+		api.POST("/dashboard/rollout/:branch/:runtimeVersion/:updateId/promote", middleware.DashboardAuthMiddleware, handlers.PromoteRolloutHandler)
+		api.POST("/dashboard/rollout/:branch/:runtimeVersion/:updateId/abort", middleware.DashboardAuthMiddleware, handlers.AbortRolloutHandler)
+
+		// Rollback publishing
+		api.POST("/dashboard/rollback/:branch/:runtimeVersion", middleware.DashboardAuthMiddleware, handlers.CreateRollbackHandler)
+
+		// Republish an update to another branch
+		api.POST("/dashboard/republish/:branch/:runtimeVersion/:updateId", middleware.DashboardAuthMiddleware, handlers.RepublishUpdateHandler)
+
+		// Channel registry routes
+		api.GET("/channels", handlers.GetChannelsHandler)
+		api.GET("/channels/:channel", handlers.GetChannelHandler)
+		api.POST("/channels", middleware.DashboardAuthMiddleware, handlers.CreateChannelHandler)
+		api.PUT("/channels/:channel", middleware.DashboardAuthMiddleware, handlers.UpdateChannelHandler)
+		api.DELETE("/channels/:channel", middleware.DashboardAuthMiddleware, handlers.DeleteChannelHandler)
+
 		// Aliases for dashboard endpoints (to match client expectations)
 		api.GET("/settings", handlers.GetSettingsHandler)
 		api.GET("/branches", handlers.GetBranchesHandler)
@@ -97,8 +116,10 @@ func SetupRoutes(router *gin.Engine) {
 		api.POST("/update/request-upload-urls/:branch", handlers.RequestUploadUrlHandler)
 		api.POST("/update/mark-uploaded/:branch", middleware.AuthMiddleware, handlers.MarkUpdateAsUploadedHandler)
 		api.GET("/update/manifest/:branch/:runtimeVersion", debugLoggerMiddleware(), handlers.ManifestHandler)
+		api.GET("/update/manifest", debugLoggerMiddleware(), handlers.ManifestHandler)
 		api.GET("/update/assets/:path", debugLoggerMiddleware(), handlers.AssetsHandler)
 		api.GET("/update/assets", debugLoggerMiddleware(), handlers.AssetsHandler)
+		api.GET("/assets/content/:file", handlers.ContentAssetHandler)
 		api.GET("/debug/updates/:branch/:runtimeVersion", handlers.ListUpdatesHandler)
 	}
 
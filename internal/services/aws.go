@@ -2,50 +2,100 @@ package services
 
 import (
 	"context"
+	"errors"
 	"expo-open-ota/config"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	"log"
 	"sync"
 )
 
 var (
 	s3Client     *s3.Client
+	s3ClientErr  error
 	initS3Client sync.Once
 )
 
-func GetS3Client() (*s3.Client, error) {
-	var err error
+// S3Options configures the S3 client. Endpoint, path-style addressing and a
+// custom signing region let it target S3-compatible stores (MinIO, R2, Ceph).
+type S3Options struct {
+	Region          string
+	Endpoint        string
+	ForcePathStyle  bool
+	AccessKeyID     string
+	SecretAccessKey string
+}
 
-	initS3Client.Do(func() {
-		var cfg aws.Config
-		opts := []func(*awsconfig.LoadOptions) error{
-			awsconfig.WithRegion(config.GetEnv("AWS_REGION")),
+// firstEnv returns the first of the environment variables that is set.
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := config.GetEnv(key); value != "" {
+			return value
 		}
-		accessKey := config.GetEnv("AWS_ACCESS_KEY_ID")
-		secretKey := config.GetEnv("AWS_SECRET_ACCESS_KEY")
-		if accessKey != "" && secretKey != "" {
-			opts = append(opts, awsconfig.WithCredentialsProvider(
-				aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-					return aws.Credentials{
-						AccessKeyID:     accessKey,
-						SecretAccessKey: secretKey,
-					}, nil
-				}),
-			))
+	}
+	return ""
+}
+
+// LoadS3Options reads the S3 settings. The KEYS_STORAGE_* variables shown in
+// the dashboard are accepted as fallbacks of the S3_* ones.
+func LoadS3Options() S3Options {
+	return S3Options{
+		Region:          firstEnv("S3_REGION", "KEYS_STORAGE_REGION", "AWS_REGION"),
+		Endpoint:        firstEnv("S3_ENDPOINT", "KEYS_STORAGE_ENDPOINT"),
+		ForcePathStyle:  firstEnv("S3_FORCE_PATH_STYLE", "KEYS_STORAGE_FORCE_PATH_STYLE") == "true",
+		AccessKeyID:     firstEnv("S3_ACCESS_KEY_ID", "KEYS_STORAGE_ACCESS_KEY", "AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: firstEnv("S3_SECRET_ACCESS_KEY", "KEYS_STORAGE_SECRET_KEY", "AWS_SECRET_ACCESS_KEY"),
+	}
+}
+
+func NewS3Client(options S3Options) (*s3.Client, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(options.Region),
+	}
+	if options.AccessKeyID != "" && options.SecretAccessKey != "" {
+		accessKey := options.AccessKeyID
+		secretKey := options.SecretAccessKey
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{
+					AccessKeyID:     accessKey,
+					SecretAccessKey: secretKey,
+				}, nil
+			}),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = options.ForcePathStyle
+		if options.Endpoint != "" {
+			o.BaseEndpoint = aws.String(options.Endpoint)
+			// S3-compatible stores do not all support the checksums the SDK
+			// adds by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
 		}
+	}), nil
+}
 
-		cfg, err = awsconfig.LoadDefaultConfig(context.TODO(), opts...)
-		if err == nil {
-			s3Client = s3.NewFromConfig(cfg)
+func GetS3Client() (*s3.Client, error) {
+	initS3Client.Do(func() {
+		options := LoadS3Options()
+		if options.Endpoint != "" {
+			log.Printf("Using S3 endpoint %s (path-style: %t, region: %s)", options.Endpoint, options.ForcePathStyle, options.Region)
 		}
+		s3Client, s3ClientErr = NewS3Client(options)
 	})
 
-	if err != nil {
-		return nil, fmt.Errorf("error loading AWS configuration: %w", err)
+	if s3ClientErr != nil {
+		return nil, fmt.Errorf("error loading AWS configuration: %w", s3ClientErr)
 	}
 	return s3Client, nil
 }
@@ -71,3 +121,29 @@ func FetchSecret(secretName string) string {
 
 	return *resp.SecretString
 }
+
+// StoreSecret writes a new version of a secret, creating it if needed.
+func StoreSecret(secretName string, value string) error {
+	cfg, err := awsconfig.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return fmt.Errorf("error loading AWS configuration: %w", err)
+	}
+
+	client := secretsmanager.NewFromConfig(cfg)
+
+	_, err = client.PutSecretValue(context.TODO(), &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secretName),
+		SecretString: aws.String(value),
+	})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		_, err = client.CreateSecret(context.TODO(), &secretsmanager.CreateSecretInput{
+			Name:         aws.String(secretName),
+			SecretString: aws.String(value),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error storing secret %s: %w", secretName, err)
+	}
+	return nil
+}
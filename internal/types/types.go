@@ -41,6 +41,36 @@ const (
 	Rollback
 )
 
+// UpdateMetadataFile is the update-metadata.json file the server writes next
+// to the files uploaded by the client.
+type UpdateMetadataFile struct {
+	Platform   string `json:"platform,omitempty"`
+	CommitHash string `json:"commitHash,omitempty"`
+	// CreatedAt is persisted once so the manifest createdAt never changes
+	CreatedAt       string           `json:"createdAt,omitempty"`
+	RepublishedFrom *UpdateReference `json:"republishedFrom,omitempty"`
+}
+
+type UpdateReference struct {
+	Branch         string `json:"branch"`
+	RuntimeVersion string `json:"runtimeVersion"`
+	UpdateId       string `json:"updateId"`
+}
+
+type RolloutStatus string
+
+const (
+	RolloutInProgress RolloutStatus = "inProgress"
+	RolloutCompleted  RolloutStatus = "completed"
+	RolloutAborted    RolloutStatus = "aborted"
+)
+
+type Rollout struct {
+	Percentage int           `json:"percentage"`
+	Status     RolloutStatus `json:"status"`
+	UpdatedAt  string        `json:"updatedAt"`
+}
+
 type ManifestAsset struct {
 	Hash          string `json:"hash"`
 	Key           string `json:"key"`
@@ -87,9 +117,19 @@ type Update struct {
 	Platform       string        `json:"platform,omitempty"`
 }
 
+// BucketFile is a bundle or asset, described by the object holding it, which
+// is only read once the request is known to need its content. Encoding is set
+// when the object is a precompressed variant.
 type BucketFile struct {
-	Reader    io.ReadCloser
-	CreatedAt time.Time
+	// Open reads length bytes of the object from offset.
+	Open func(offset int64, length int64) (io.ReadCloser, error)
+	// Key is the object key relative to the bucket root, which CDNs having the
+	// bucket as origin sign.
+	Key          string
+	SHA256       string
+	Size         int64
+	LastModified time.Time
+	Encoding     string
 }
 
 type ExpoAuth struct {
@@ -100,4 +140,82 @@ type ExpoAuth struct {
 type FileUpdateRequest struct {
 	Url  string `json:"url"`
 	Path string `json:"path"`
+	// Headers the upload request must carry for the storage to accept it.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// UploadFile is a file the client announces when requesting upload URLs, with
+// the hex SHA-256 and byte length the uploaded object must have.
+type UploadFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type FileIntegrityStatus string
+
+const (
+	FileIntegrityOK           FileIntegrityStatus = "ok"
+	FileIntegrityMissing      FileIntegrityStatus = "missing"
+	FileIntegritySizeMismatch FileIntegrityStatus = "sizeMismatch"
+	FileIntegrityHashMismatch FileIntegrityStatus = "hashMismatch"
+	FileIntegrityUnreadable   FileIntegrityStatus = "unreadable"
+)
+
+type FileIntegrityResult struct {
+	Name           string              `json:"name"`
+	Status         FileIntegrityStatus `json:"status"`
+	ExpectedSHA256 string              `json:"expectedSha256,omitempty"`
+	ActualSHA256   string              `json:"actualSha256,omitempty"`
+	ExpectedSize   int64               `json:"expectedSize"`
+	ActualSize     int64               `json:"actualSize"`
+	Error          string              `json:"error,omitempty"`
+}
+
+type IntegrityReport struct {
+	Valid bool                  `json:"valid"`
+	Files []FileIntegrityResult `json:"files"`
+}
+
+type AssetStore string
+
+const (
+	// AssetStoreUpdate objects are files of the update folder
+	AssetStoreUpdate AssetStore = "update"
+	// AssetStoreContent objects are server-owned content store objects
+	AssetStoreContent AssetStore = "content"
+)
+
+// AssetIndexEntry locates a file of an update: Object is a file name of the
+// update folder or a content store key, depending on Store.
+type AssetIndexEntry struct {
+	Store  AssetStore `json:"store"`
+	Object string     `json:"object"`
+	SHA256 string     `json:"sha256"`
+	// MD5 is the manifest key of the file.
+	MD5  string `json:"md5"`
+	Size int64  `json:"size"`
+	// Encodings maps a content encoding to the object of Store holding the
+	// precompressed variant of the file.
+	Encodings map[string]string `json:"encodings,omitempty"`
+}
+
+// AssetIndex maps the bundles and assets referenced by the metadata.json of
+// an update, keyed by their path in it, to the exact object serving them.
+type AssetIndex struct {
+	Assets map[string]AssetIndexEntry `json:"assets"`
+	// Compressed is set once the precompressed variants are generated.
+	Compressed bool `json:"compressed,omitempty"`
+}
+
+// LatestUpdatePointer is the latest.json object of a branch, runtime version
+// and platform, rewritten whenever its updates change so manifest requests do
+// not list the bucket. Updates are the ones a client may be served, newest
+// first: all but the last one are staged rollouts the client may not be part of.
+type LatestUpdatePointer struct {
+	Branch         string   `json:"branch"`
+	RuntimeVersion string   `json:"runtimeVersion"`
+	Platform       string   `json:"platform"`
+	Updates        []Update `json:"updates"`
+	UpdatedAt      string   `json:"updatedAt"`
 }
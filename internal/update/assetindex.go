@@ -0,0 +1,439 @@
+package update
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/compression"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+)
+
+// assetIndexFileName is written when an update is marked as uploaded, files
+// of the update are only served through it.
+const assetIndexFileName = "asset-index.json"
+
+var ErrAssetNotIndexed = errors.New("asset not in the update index")
+
+var ErrAssetIndexNotFound = errors.New("update has no asset index")
+
+func ComputeAssetIndexCacheKey(update types.Update) string {
+	return fmt.Sprintf("assetIndex:%s:%s:%s", update.Branch, update.RuntimeVersion, update.UpdateId)
+}
+
+// BuildAssetIndex locates every bundle and asset referenced by the metadata of
+// an update at its exact path, in the content store or the update folder.
+func BuildAssetIndex(update types.Update) (types.AssetIndex, error) {
+	index := types.AssetIndex{Assets: map[string]types.AssetIndexEntry{}}
+	metadata, err := GetMetadata(update)
+	if err != nil {
+		return index, fmt.Errorf("error reading metadata: %w", err)
+	}
+	files, err := getUploadIntegrity(update)
+	if err != nil {
+		return index, err
+	}
+	announced := make(map[string]types.UploadFile, len(files))
+	for _, file := range files {
+		announced[file.Name] = file
+	}
+
+	for _, fileName := range updateFileNames(metadata) {
+		if isUpdateSpecificFile(fileName) {
+			continue
+		}
+		if file, ok := announced[fileName]; ok {
+			exists, err := HasContentAsset(file.SHA256)
+			if err != nil {
+				return index, err
+			}
+			if exists {
+				object := ContentAssetKey(file.SHA256)
+				sha256Hex, md5Hex, size, err := hashIndexedObject(update, types.AssetStoreContent, object)
+				if err != nil {
+					return index, fmt.Errorf("error reading %s: %w", fileName, err)
+				}
+				if sha256Hex != file.SHA256 {
+					return index, fmt.Errorf("content store object %s does not match its hash", object)
+				}
+				index.Assets[fileName] = types.AssetIndexEntry{
+					Store:  types.AssetStoreContent,
+					Object: object,
+					SHA256: sha256Hex,
+					MD5:    md5Hex,
+					Size:   size,
+				}
+				continue
+			}
+		}
+		sha256Hex, md5Hex, size, err := hashIndexedObject(update, types.AssetStoreUpdate, fileName)
+		if err != nil {
+			return index, fmt.Errorf("error reading %s: %w", fileName, err)
+		}
+		index.Assets[fileName] = types.AssetIndexEntry{
+			Store:  types.AssetStoreUpdate,
+			Object: fileName,
+			SHA256: sha256Hex,
+			MD5:    md5Hex,
+			Size:   size,
+		}
+	}
+	return index, nil
+}
+
+// hashIndexedObject streams an object and returns its sha256, its md5, which
+// manifests use as the asset key, and its size.
+func hashIndexedObject(update types.Update, store types.AssetStore, object string) (string, string, int64, error) {
+	reader, err := openIndexedObject(update, store, object)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer reader.Close()
+	sha256Hasher, md5Hasher := sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hasher, md5Hasher), reader)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return hex.EncodeToString(sha256Hasher.Sum(nil)), hex.EncodeToString(md5Hasher.Sum(nil)), size, nil
+}
+
+func SaveAssetIndex(update types.Update, index types.AssetIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("error marshalling asset index: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	if err := resolvedBucket.UploadFileIntoUpdate(update, assetIndexFileName, strings.NewReader(string(content))); err != nil {
+		return fmt.Errorf("error saving asset index: %w", err)
+	}
+	cache2.Invalidate(cache2.InvalidationIndex, ComputeAssetIndexCacheKey(update))
+	return nil
+}
+
+// IndexUpdateAssets builds the asset index of an update, compresses its
+// variants and saves it.
+func IndexUpdateAssets(update types.Update) (types.AssetIndex, error) {
+	index, err := BuildAssetIndex(update)
+	if err != nil {
+		return index, err
+	}
+	if err := CompressAssetVariants(update, &index); err != nil {
+		return index, err
+	}
+	return index, SaveAssetIndex(update, index)
+}
+
+// compressibleFileNames returns the bundles of an update and the assets whose
+// type is worth compressing.
+func compressibleFileNames(metadata types.UpdateMetadata) map[string]bool {
+	compressible := map[string]bool{}
+	for _, platformMetadata := range []types.PlatformMetadata{
+		metadata.MetadataJSON.FileMetadata.IOS,
+		metadata.MetadataJSON.FileMetadata.Android,
+	} {
+		if platformMetadata.Bundle != "" {
+			compressible[platformMetadata.Bundle] = true
+		}
+		for _, asset := range platformMetadata.Assets {
+			if compression.IsCompressible(mime.TypeByExtension("." + string(asset.Ext))) {
+				compressible[asset.Path] = true
+			}
+		}
+	}
+	return compressible
+}
+
+// CompressAssetVariants stores a variant of every compressible file of an
+// index in each of compression.Encodings, next to the object it compresses,
+// and records them in the index. Variants not smaller than their file are
+// not kept.
+func CompressAssetVariants(update types.Update, index *types.AssetIndex) error {
+	metadata, err := GetMetadata(update)
+	if err != nil {
+		return fmt.Errorf("error reading metadata: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	for assetPath := range compressibleFileNames(metadata) {
+		entry, ok := index.Assets[assetPath]
+		if !ok {
+			continue
+		}
+		encodings := map[string]string{}
+		for _, encoding := range compression.Encodings {
+			variantObject := entry.Object + compression.FileExtension(encoding)
+			if entry.Store == types.AssetStoreContent {
+				// Content store variants are shared by every update holding the asset
+				exists, err := resolvedBucket.ObjectExists(variantObject)
+				if err != nil {
+					return err
+				}
+				if exists {
+					encodings[encoding] = variantObject
+					continue
+				}
+			}
+			stored, err := storeCompressedVariant(update, entry, variantObject, encoding)
+			if err != nil {
+				return fmt.Errorf("error compressing %s with %s: %w", assetPath, encoding, err)
+			}
+			if stored {
+				encodings[encoding] = variantObject
+			}
+		}
+		entry.Encodings = nil
+		if len(encodings) > 0 {
+			entry.Encodings = encodings
+		}
+		index.Assets[assetPath] = entry
+	}
+	index.Compressed = true
+	return nil
+}
+
+// storeCompressedVariant compresses a file into variantObject, unless the
+// result is not smaller. Compressed variants are small enough to be buffered.
+func storeCompressedVariant(update types.Update, entry types.AssetIndexEntry, variantObject string, encoding string) (bool, error) {
+	source, err := openIndexedObject(update, entry.Store, entry.Object)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+	var compressed bytes.Buffer
+	if err := compression.Compress(&compressed, source, encoding); err != nil {
+		return false, err
+	}
+	if int64(compressed.Len()) >= entry.Size {
+		return false, nil
+	}
+	resolvedBucket := bucket.GetBucket()
+	if entry.Store == types.AssetStoreContent {
+		return true, resolvedBucket.PutObject(variantObject, &compressed)
+	}
+	return true, resolvedBucket.UploadFileIntoUpdate(update, variantObject, &compressed)
+}
+
+// readAssetIndex reads the saved asset index of an update, found is false
+// when it has none.
+func readAssetIndex(update types.Update) (index types.AssetIndex, found bool, err error) {
+	file, err := bucket.GetBucket().GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, assetIndexFileName)
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return index, false, nil
+	}
+	if err != nil {
+		return index, false, fmt.Errorf("error reading asset index: %w", err)
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&index); err != nil {
+		return index, true, fmt.Errorf("error decoding asset index: %w", err)
+	}
+	return index, true, nil
+}
+
+// GetAssetIndex returns the asset index of an update. Indexes are only built
+// when an update is marked as uploaded and by the asset index backfill, an
+// update without one is an error wrapping ErrAssetIndexNotFound.
+func GetAssetIndex(update types.Update) (types.AssetIndex, error) {
+	cacheKey := ComputeAssetIndexCacheKey(update)
+	cache := cache2.GetCache()
+	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
+		var index types.AssetIndex
+		if err := json.Unmarshal([]byte(cachedValue), &index); err == nil {
+			return index, nil
+		}
+	}
+	index, found, err := readAssetIndex(update)
+	if err != nil {
+		return index, err
+	}
+	if !found {
+		return index, fmt.Errorf("%w: update %s/%s/%s, run the asset index backfill",
+			ErrAssetIndexNotFound, update.Branch, update.RuntimeVersion, update.UpdateId)
+	}
+	if cacheValue, err := json.Marshal(index); err == nil {
+		_ = cache.Set(cacheKey, string(cacheValue), nil)
+	}
+	return index, nil
+}
+
+// LookupAsset returns the index entry of a bundle or asset of an update.
+func LookupAsset(update types.Update, assetPath string) (types.AssetIndexEntry, error) {
+	index, err := GetAssetIndex(update)
+	if err != nil {
+		return types.AssetIndexEntry{}, err
+	}
+	entry, ok := index.Assets[assetPath]
+	if !ok {
+		return types.AssetIndexEntry{}, fmt.Errorf("%w: %s in update %s", ErrAssetNotIndexed, assetPath, update.UpdateId)
+	}
+	return entry, nil
+}
+
+// OpenIndexedAsset opens a bundle or asset of an update from the object its
+// index entry points at.
+func OpenIndexedAsset(update types.Update, assetPath string) (io.ReadCloser, error) {
+	entry, err := LookupAsset(update, assetPath)
+	if err != nil {
+		return nil, err
+	}
+	return openIndexedObject(update, entry.Store, entry.Object)
+}
+
+func openIndexedObject(update types.Update, store types.AssetStore, object string) (io.ReadCloser, error) {
+	if store == types.AssetStoreContent {
+		return bucket.GetBucket().GetObject(object)
+	}
+	return bucket.GetBucket().GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, object)
+}
+
+// indexedObjectKey is the key of an object of the asset index relative to the
+// bucket root, as laid out by the object storages a CDN can have as origin.
+func indexedObjectKey(update types.Update, store types.AssetStore, object string) string {
+	if store == types.AssetStoreContent {
+		return path.Join(bucket.SystemPrefix, object)
+	}
+	return path.Join(update.Branch, update.RuntimeVersion, update.UpdateId, object)
+}
+
+// indexedObjectOpener reads an object of the asset index, with a ranged read
+// for anything but the whole object.
+func indexedObjectOpener(update types.Update, store types.AssetStore, object string, size int64) func(offset int64, length int64) (io.ReadCloser, error) {
+	return func(offset int64, length int64) (io.ReadCloser, error) {
+		if offset == 0 && length == size {
+			return openIndexedObject(update, store, object)
+		}
+		if store == types.AssetStoreContent {
+			return bucket.GetBucket().GetObjectRange(object, offset, length)
+		}
+		return bucket.GetBucket().GetFileRange(update.Branch, update.RuntimeVersion, update.UpdateId, object, offset, length)
+	}
+}
+
+// ResolveIndexedAssetFile describes a bundle or asset of an update by the
+// hash, size and modification time of the object holding it, without reading
+// it. The first of encodings with a precompressed variant is served instead of
+// the file.
+func ResolveIndexedAssetFile(update types.Update, assetPath string, encodings []string) (*types.BucketFile, error) {
+	entry, err := LookupAsset(update, assetPath)
+	if err != nil {
+		return nil, err
+	}
+	object := entry.Object
+	selectedEncoding := ""
+	for _, encoding := range encodings {
+		if variantObject, ok := entry.Encodings[encoding]; ok {
+			object = variantObject
+			selectedEncoding = encoding
+			break
+		}
+	}
+	resolvedBucket := bucket.GetBucket()
+	var info bucket.ObjectInfo
+	if entry.Store == types.AssetStoreContent {
+		info, err = resolvedBucket.StatObject(object)
+	} else {
+		info, err = resolvedBucket.StatFile(update.Branch, update.RuntimeVersion, update.UpdateId, object)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &types.BucketFile{
+		Open:         indexedObjectOpener(update, entry.Store, object, info.Size),
+		Key:          indexedObjectKey(update, entry.Store, object),
+		SHA256:       entry.SHA256,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+		Encoding:     selectedEncoding,
+	}, nil
+}
+
+func hasUpdateFile(update types.Update, fileName string) bool {
+	file, err := bucket.GetBucket().GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
+}
+
+// hasManifestKeys reports whether an index holds the md5 of every file,
+// indexes saved before it was recorded are rebuilt by the backfill.
+func hasManifestKeys(index types.AssetIndex) bool {
+	for _, entry := range index.Assets {
+		if entry.MD5 == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// BackfillReport lists the updates a backfill indexed, skipped because they
+// already had an index, or failed to index.
+type BackfillReport struct {
+	DryRun  bool                    `json:"dryRun"`
+	Indexed []types.UpdateReference `json:"indexed"`
+	Skipped int                     `json:"skipped"`
+	Errors  []string                `json:"errors"`
+}
+
+// BackfillAssetIndexes writes the asset index of every update missing one or
+// saved without md5 keys, and the precompressed variants of indexes saved
+// without them. Rollbacks and
+// updates that were never marked as uploaded are left alone.
+func BackfillAssetIndexes(dryRun bool) (BackfillReport, error) {
+	report := BackfillReport{DryRun: dryRun, Indexed: []types.UpdateReference{}, Errors: []string{}}
+	resolvedBucket := bucket.GetBucket()
+	branches, err := resolvedBucket.GetBranches()
+	if err != nil {
+		return report, fmt.Errorf("error listing branches: %w", err)
+	}
+	for _, branch := range branches {
+		runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branch)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", branch, err))
+			continue
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			updates, err := resolvedBucket.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", branch, runtimeVersion.RuntimeVersion, err))
+				continue
+			}
+			for _, update := range updates {
+				reference := types.UpdateReference{Branch: update.Branch, RuntimeVersion: update.RuntimeVersion, UpdateId: update.UpdateId}
+				if GetUpdateType(update) == types.Rollback || !hasUpdateFile(update, ".check") {
+					report.Skipped++
+					continue
+				}
+				index, found, err := readAssetIndex(update)
+				if err == nil && found && index.Compressed && hasManifestKeys(index) {
+					report.Skipped++
+					continue
+				}
+				if err == nil && (!found || !hasManifestKeys(index)) {
+					index, err = BuildAssetIndex(update)
+				}
+				if err == nil && !dryRun {
+					err = CompressAssetVariants(update, &index)
+				}
+				if err == nil && !dryRun {
+					err = SaveAssetIndex(update, index)
+				}
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s/%s/%s: %v", update.Branch, update.RuntimeVersion, update.UpdateId, err))
+					continue
+				}
+				report.Indexed = append(report.Indexed, reference)
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,159 @@
+package update
+
+import (
+	"compress/gzip"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useLocalBucket(t *testing.T) bucket.Bucket {
+	t.Setenv("BUCKET_TYPE", "local")
+	t.Setenv("STORAGE_MODE", "local")
+	t.Setenv("LOCAL_BUCKET_BASE_PATH", t.TempDir())
+	bucket.ResetBucketInstance()
+	t.Cleanup(bucket.ResetBucketInstance)
+	// Cached entries of another test would name objects of its bucket
+	_ = cache2.GetCache().Clear()
+	return bucket.GetBucket()
+}
+
+func TestAssetIndexResolvesExactObjects(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	upload := func(fileName string, content string) {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, fileName, strings.NewReader(content)))
+	}
+	upload("metadata.json", `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[{"path":"assets/abc","ext":"png"}]}}}`)
+	upload("bundles/ios.js", "bundle")
+	// A file the old fallbacks would have served for a missing bundle
+	upload("bundle.js", "stale bundle")
+	require.NoError(t, resolvedBucket.PutObject(ContentAssetKey(sha256Hex("icon")), strings.NewReader("icon")))
+	require.NoError(t, SaveUploadIntegrity(update, []types.UploadFile{{Name: "assets/abc", SHA256: sha256Hex("icon"), Size: 4}}))
+
+	index, err := IndexUpdateAssets(update)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.AssetIndexEntry{
+		"bundles/ios.js": {Store: types.AssetStoreUpdate, Object: "bundles/ios.js", SHA256: sha256Hex("bundle"), MD5: md5Hex("bundle"), Size: 6},
+		"assets/abc":     {Store: types.AssetStoreContent, Object: ContentAssetKey(sha256Hex("icon")), SHA256: sha256Hex("icon"), MD5: md5Hex("icon"), Size: 4},
+	}, index.Assets)
+
+	for assetPath, expected := range map[string]string{"bundles/ios.js": "bundle", "assets/abc": "icon"} {
+		file, err := OpenIndexedAsset(update, assetPath)
+		require.NoError(t, err)
+		content, err := io.ReadAll(file)
+		file.Close()
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+	_, err = OpenIndexedAsset(update, "bundle.js")
+	assert.ErrorIs(t, err, ErrAssetNotIndexed)
+
+	// Indexing fails rather than pointing at another file
+	update.UpdateId = "1700000000001"
+	upload("metadata.json", `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/missing.js","assets":[]}}}`)
+	upload("bundle.js", "stale bundle")
+	_, err = BuildAssetIndex(update)
+	assert.Error(t, err)
+	// Updates are not indexed on request
+	_, err = OpenIndexedAsset(update, "bundles/missing.js")
+	assert.ErrorIs(t, err, ErrAssetIndexNotFound)
+}
+
+func TestAssetIndexCompressesVariants(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	bundle := strings.Repeat("var bundle = 1;\n", 200)
+	translations := strings.Repeat(`{"hello":"world"}`, 50)
+	upload := func(fileName string, content string) {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, fileName, strings.NewReader(content)))
+	}
+	upload("metadata.json", `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[{"path":"assets/abc","ext":"json"},{"path":"assets/def","ext":"png"}]}}}`)
+	upload("bundles/ios.js", bundle)
+	upload("assets/def", strings.Repeat("png", 100))
+	require.NoError(t, resolvedBucket.PutObject(ContentAssetKey(sha256Hex(translations)), strings.NewReader(translations)))
+	require.NoError(t, SaveUploadIntegrity(update, []types.UploadFile{{Name: "assets/abc", SHA256: sha256Hex(translations), Size: int64(len(translations))}}))
+
+	index, err := IndexUpdateAssets(update)
+	require.NoError(t, err)
+	assert.True(t, index.Compressed)
+	assert.Equal(t, map[string]string{"br": "bundles/ios.js.br", "gzip": "bundles/ios.js.gz"}, index.Assets["bundles/ios.js"].Encodings)
+	contentKey := ContentAssetKey(sha256Hex(translations))
+	assert.Equal(t, map[string]string{"br": contentKey + ".br", "gzip": contentKey + ".gz"}, index.Assets["assets/abc"].Encodings)
+	// Images are not compressed
+	assert.Nil(t, index.Assets["assets/def"].Encodings)
+
+	file, err := ResolveIndexedAssetFile(update, "bundles/ios.js", []string{"gzip"})
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", file.Encoding)
+	assert.Equal(t, sha256Hex(bundle), file.SHA256)
+	opened, err := file.Open(0, file.Size)
+	require.NoError(t, err)
+	reader, err := gzip.NewReader(opened)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	opened.Close()
+	require.NoError(t, err)
+	assert.Equal(t, bundle, string(content))
+	assert.Less(t, file.Size, int64(len(bundle)))
+
+	file, err = ResolveIndexedAssetFile(update, "assets/def", []string{"br", "gzip"})
+	require.NoError(t, err)
+	assert.Empty(t, file.Encoding)
+	assert.Equal(t, int64(300), file.Size)
+	opened, err = file.Open(297, 3)
+	require.NoError(t, err)
+	content, err = io.ReadAll(opened)
+	opened.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(content))
+
+	file, err = ResolveContentAssetFile(sha256Hex(translations), []string{"br"})
+	require.NoError(t, err)
+	assert.Equal(t, "br", file.Encoding)
+	file, err = ResolveContentAssetFile(sha256Hex(translations), nil)
+	require.NoError(t, err)
+	opened, err = file.Open(2, 5)
+	require.NoError(t, err)
+	content, err = io.ReadAll(opened)
+	opened.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// Retention removes the variants along with the content asset
+	require.NoError(t, DeleteContentAsset(sha256Hex(translations)))
+	exists, err := resolvedBucket.ObjectExists(contentKey + ".br")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestBackfillRebuildsIndexesWithoutManifestKeys(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	upload := func(fileName string, content string) {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, fileName, strings.NewReader(content)))
+	}
+	upload("metadata.json", `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[]}}}`)
+	upload("bundles/ios.js", "bundle")
+	upload(".check", ".check")
+	require.NoError(t, SaveAssetIndex(update, types.AssetIndex{
+		Assets: map[string]types.AssetIndexEntry{
+			"bundles/ios.js": {Store: types.AssetStoreUpdate, Object: "bundles/ios.js", SHA256: sha256Hex("bundle"), Size: 6},
+		},
+		Compressed: true,
+	}))
+
+	report, err := BackfillAssetIndexes(false)
+	require.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Len(t, report.Indexed, 1)
+	entry, err := LookupAsset(update, "bundles/ios.js")
+	require.NoError(t, err)
+	assert.Equal(t, md5Hex("bundle"), entry.MD5)
+}
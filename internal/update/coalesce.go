@@ -0,0 +1,21 @@
+package update
+
+import (
+	"golang.org/x/sync/singleflight"
+)
+
+// lookups coalesces concurrent identical lookups, such as every device asking
+// for the update that was just published, into a single backend fetch.
+var lookups singleflight.Group
+
+// coalesce runs fetch once for the callers asking for the same key at the
+// same time, all of them get its result. Keys are the cache keys of the
+// results, so lookups of different layers never share a flight. Results are
+// shared between callers and must not be modified.
+func coalesce[T any](key string, fetch func() (T, error)) (T, error) {
+	value, err, _ := lookups.Do(key, func() (interface{}, error) {
+		return fetch()
+	})
+	result, _ := value.(T)
+	return result, err
+}
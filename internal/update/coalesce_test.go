@@ -0,0 +1,52 @@
+package update
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalesceSharesOneFetch(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (string, error) {
+		fetches.Add(1)
+		<-release
+		return "manifest", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			results[index], _ = coalesce("manifest:main:1.0.0:1700000000000:ios", fetch)
+		}(i)
+	}
+	// Let every caller join the flight before the fetch completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load())
+	for _, result := range results {
+		assert.Equal(t, "manifest", result)
+	}
+
+	// A later lookup fetches again, and errors reach the callers
+	errFetch := errors.New("bucket unavailable")
+	result, err := coalesce("manifest:main:1.0.0:1700000000000:ios", func() (string, error) {
+		return "", errFetch
+	})
+	assert.ErrorIs(t, err, errFetch)
+	assert.Empty(t, result)
+
+	pointer, err := coalesce("lastUpdate:main:1.0.0", func() (*int, error) { return nil, nil })
+	assert.NoError(t, err)
+	assert.Nil(t, pointer)
+}
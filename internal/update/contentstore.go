@@ -0,0 +1,221 @@
+package update
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/compression"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// Content-addressed assets are stored once under assets/<sha256>, next to the
+// per-update folders, and shared by every update referencing them.
+const contentAssetPrefix = "assets"
+
+func ContentAssetKey(sha256Hex string) string {
+	return contentAssetPrefix + "/" + sha256Hex
+}
+
+func IsValidContentHash(sha256Hex string) bool {
+	return sha256HexPattern.MatchString(sha256Hex)
+}
+
+// isUpdateSpecificFile reports files that describe an update and are never
+// shared through the content store.
+func isUpdateSpecificFile(fileName string) bool {
+	switch fileName {
+	case "metadata.json", "expoConfig.json":
+		return true
+	}
+	return false
+}
+
+func HasContentAsset(sha256Hex string) (bool, error) {
+	return bucket.GetBucket().ObjectExists(ContentAssetKey(sha256Hex))
+}
+
+// FilterDeduplicatedFiles splits announced files between the ones the client
+// has to upload and the ones the content store already holds.
+func FilterDeduplicatedFiles(files []types.UploadFile) (map[string]bool, error) {
+	deduplicated := map[string]bool{}
+	for _, file := range files {
+		if isUpdateSpecificFile(file.Name) {
+			continue
+		}
+		exists, err := HasContentAsset(file.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			deduplicated[file.Name] = true
+		}
+	}
+	return deduplicated, nil
+}
+
+func GetContentAsset(sha256Hex string) (io.ReadCloser, error) {
+	if !IsValidContentHash(sha256Hex) {
+		return nil, fmt.Errorf("invalid content hash %s", sha256Hex)
+	}
+	return bucket.GetBucket().GetObject(ContentAssetKey(sha256Hex))
+}
+
+// ResolveContentAssetFile describes an object of the content store by its
+// size and modification time, or the first of encodings it has a
+// precompressed variant in, without reading it.
+func ResolveContentAssetFile(sha256Hex string, encodings []string) (*types.BucketFile, error) {
+	if !IsValidContentHash(sha256Hex) {
+		return nil, fmt.Errorf("invalid content hash %s", sha256Hex)
+	}
+	resolvedBucket := bucket.GetBucket()
+	// The identity encoding comes last, a missing asset is an error
+	candidates := append(append([]string{}, encodings...), "")
+	for _, encoding := range candidates {
+		key := ContentAssetKey(sha256Hex)
+		if encoding != "" {
+			key += compression.FileExtension(encoding)
+		}
+		info, err := resolvedBucket.StatObject(key)
+		if errors.Is(err, bucket.ErrObjectNotFound) && encoding != "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &types.BucketFile{
+			Open:         indexedObjectOpener(types.Update{}, types.AssetStoreContent, key, info.Size),
+			Key:          indexedObjectKey(types.Update{}, types.AssetStoreContent, key),
+			SHA256:       sha256Hex,
+			Size:         info.Size,
+			LastModified: info.LastModified,
+			Encoding:     encoding,
+		}, nil
+	}
+	return nil, bucket.ErrObjectNotFound
+}
+
+// ContentAsset is an object of the content store.
+type ContentAsset struct {
+	SHA256       string
+	LastModified time.Time
+}
+
+// ListContentAssets returns every object of the content store.
+func ListContentAssets() ([]ContentAsset, error) {
+	objects, err := bucket.GetBucket().ListObjects(contentAssetPrefix + "/")
+	if err != nil {
+		return nil, err
+	}
+	assets := make([]ContentAsset, 0, len(objects))
+	for _, object := range objects {
+		sha256Hex := strings.TrimPrefix(object.Key, contentAssetPrefix+"/")
+		if !IsValidContentHash(sha256Hex) {
+			continue
+		}
+		assets = append(assets, ContentAsset{SHA256: sha256Hex, LastModified: object.LastModified})
+	}
+	return assets, nil
+}
+
+// DeleteContentAsset removes an object of the content store along with its
+// precompressed variants.
+func DeleteContentAsset(sha256Hex string) error {
+	if !IsValidContentHash(sha256Hex) {
+		return fmt.Errorf("invalid content hash %s", sha256Hex)
+	}
+	resolvedBucket := bucket.GetBucket()
+	for _, encoding := range compression.Encodings {
+		if err := resolvedBucket.DeleteObject(ContentAssetKey(sha256Hex) + compression.FileExtension(encoding)); err != nil {
+			return err
+		}
+	}
+	return resolvedBucket.DeleteObject(ContentAssetKey(sha256Hex))
+}
+
+// ContentAssetHashes maps the files of an update to their content hash, for
+// updates whose upload announced hashes.
+func ContentAssetHashes(update types.Update) (map[string]string, error) {
+	files, err := getUploadIntegrity(update)
+	if err != nil {
+		return nil, err
+	}
+	return contentAssetHashes(files), nil
+}
+
+func contentAssetHashes(files []types.UploadFile) map[string]string {
+	hashes := make(map[string]string, len(files))
+	for _, file := range files {
+		if !isUpdateSpecificFile(file.Name) {
+			hashes[file.Name] = file.SHA256
+		}
+	}
+	return hashes
+}
+
+// OpenUpdateFile opens a file of an update, from the update folder or, once it
+// has been moved there, from the content store. hashes are the ones returned
+// by ContentAssetHashes for the update.
+func OpenUpdateFile(update types.Update, hashes map[string]string, fileName string) (io.ReadCloser, error) {
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+	if err == nil && file != nil {
+		return file, nil
+	}
+	if sha256Hex, ok := hashes[fileName]; ok {
+		return GetContentAsset(sha256Hex)
+	}
+	if err == nil {
+		err = fmt.Errorf("file %s not found", fileName)
+	}
+	return nil, err
+}
+
+// IngestContentAssets moves the verified files of an update into the content
+// store. Files the store already holds only lose their per-update copy.
+func IngestContentAssets(update types.Update) error {
+	hashes, err := ContentAssetHashes(update)
+	if err != nil {
+		return err
+	}
+	resolvedBucket := bucket.GetBucket()
+	moved := 0
+	for fileName, sha256Hex := range hashes {
+		file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
+		if err != nil || file == nil {
+			// Deduplicated at upload time
+			continue
+		}
+		file.Close()
+		if err := resolvedBucket.MoveFileToObject(update, fileName, ContentAssetKey(sha256Hex)); err != nil {
+			return fmt.Errorf("error moving %s to the content store: %w", fileName, err)
+		}
+		moved++
+	}
+	log.Printf("Update %s/%s/%s: %d files moved to the content store, %d shared with previous updates",
+		update.Branch, update.RuntimeVersion, update.UpdateId, moved, len(hashes)-moved)
+	return nil
+}
+
+// ContentAssetManifestHash converts a hex SHA-256 into the base64url form used
+// by manifest asset hashes.
+func ContentAssetManifestHash(sha256Hex string) (string, error) {
+	sum, err := hex.DecodeString(sha256Hex)
+	if err != nil {
+		return "", err
+	}
+	if len(sum) != 32 {
+		return "", errors.New("invalid sha256 length")
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+func BuildContentAssetUrl(sha256Hex string, fileExtension string) string {
+	return config.GetEnv("BASE_URL") + "/api/assets/content/" + sha256Hex + fileExtension
+}
@@ -0,0 +1,166 @@
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// integrityFileName holds the hashes and sizes announced when upload URLs
+// were requested.
+const integrityFileName = "integrity.json"
+
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidateUploadFiles checks the files announced by an upload request.
+func ValidateUploadFiles(files []types.UploadFile) error {
+	seen := map[string]bool{}
+	for _, file := range files {
+		if file.Name == "" {
+			return fmt.Errorf("file name is required")
+		}
+		if seen[file.Name] {
+			return fmt.Errorf("file %s is listed twice", file.Name)
+		}
+		seen[file.Name] = true
+		if !sha256HexPattern.MatchString(strings.ToLower(file.SHA256)) {
+			return fmt.Errorf("invalid sha256 for file %s", file.Name)
+		}
+		if file.Size < 0 {
+			return fmt.Errorf("invalid size for file %s", file.Name)
+		}
+	}
+	return nil
+}
+
+func SaveUploadIntegrity(update types.Update, files []types.UploadFile) error {
+	normalizedFiles := make([]types.UploadFile, 0, len(files))
+	for _, file := range files {
+		file.SHA256 = strings.ToLower(file.SHA256)
+		normalizedFiles = append(normalizedFiles, file)
+	}
+	content, err := json.Marshal(normalizedFiles)
+	if err != nil {
+		return fmt.Errorf("error marshalling upload integrity: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	return resolvedBucket.UploadFileIntoUpdate(update, integrityFileName, strings.NewReader(string(content)))
+}
+
+// getUploadIntegrity returns the files announced for an update, or nil when
+// the upload did not announce any.
+func getUploadIntegrity(update types.Update) ([]types.UploadFile, error) {
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, integrityFileName)
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload integrity: %w", err)
+	}
+	defer file.Close()
+	var files []types.UploadFile
+	if err := json.NewDecoder(file).Decode(&files); err != nil {
+		return nil, fmt.Errorf("error decoding upload integrity: %w", err)
+	}
+	return files, nil
+}
+
+// checkFileContent streams a file and compares it with what was announced.
+// Without an expectation, the file only has to be readable.
+func checkFileContent(name string, content io.Reader, expected *types.UploadFile) types.FileIntegrityResult {
+	result := types.FileIntegrityResult{Name: name, Status: types.FileIntegrityOK}
+	if expected != nil {
+		result.ExpectedSHA256 = expected.SHA256
+		result.ExpectedSize = expected.Size
+	}
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, content)
+	result.ActualSize = size
+	if err != nil {
+		result.Status = types.FileIntegrityUnreadable
+		result.Error = err.Error()
+		return result
+	}
+	result.ActualSHA256 = hex.EncodeToString(hasher.Sum(nil))
+	if expected == nil {
+		return result
+	}
+	if size != expected.Size {
+		result.Status = types.FileIntegritySizeMismatch
+	} else if result.ActualSHA256 != expected.SHA256 {
+		result.Status = types.FileIntegrityHashMismatch
+	}
+	return result
+}
+
+func verifyFile(update types.Update, hashes map[string]string, name string, expected *types.UploadFile) types.FileIntegrityResult {
+	file, err := OpenUpdateFile(update, hashes, name)
+	if err != nil || file == nil {
+		result := types.FileIntegrityResult{Name: name, Status: types.FileIntegrityMissing}
+		if expected != nil {
+			result.ExpectedSHA256 = expected.SHA256
+			result.ExpectedSize = expected.Size
+		}
+		return result
+	}
+	defer file.Close()
+	return checkFileContent(name, file, expected)
+}
+
+// VerifyUpdateIntegrity streams every file of an uploaded update from the
+// bucket and checks it against the hashes and sizes announced at upload time.
+// Files referenced by metadata.json but not announced must exist.
+func VerifyUpdateIntegrity(update types.Update) (types.IntegrityReport, error) {
+	report := types.IntegrityReport{Valid: true, Files: []types.FileIntegrityResult{}}
+	expectedFiles, err := getUploadIntegrity(update)
+	if err != nil {
+		return report, err
+	}
+	hashes := contentAssetHashes(expectedFiles)
+	verified := map[string]bool{}
+	for i := range expectedFiles {
+		result := verifyFile(update, hashes, expectedFiles[i].Name, &expectedFiles[i])
+		verified[expectedFiles[i].Name] = true
+		report.Files = append(report.Files, result)
+		if result.Status != types.FileIntegrityOK {
+			report.Valid = false
+		}
+	}
+	if !report.Valid {
+		return report, nil
+	}
+
+	// Drop metadata cached before the client replaced the placeholder metadata.json
+	cache2.Invalidate(cache2.InvalidationPublish, ComputeMetadataCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId))
+	metadata, err := GetMetadata(update)
+	if err != nil {
+		return report, fmt.Errorf("error reading metadata: %w", err)
+	}
+	if metadata.MetadataJSON.FileMetadata.IOS.Bundle == "" && metadata.MetadataJSON.FileMetadata.Android.Bundle == "" {
+		return report, fmt.Errorf("missing bundle path in metadata")
+	}
+	for _, name := range updateFileNames(metadata) {
+		if verified[name] {
+			continue
+		}
+		result := verifyFile(update, hashes, name, nil)
+		report.Files = append(report.Files, result)
+		if result.Status != types.FileIntegrityOK {
+			report.Valid = false
+		}
+	}
+	if !report.Valid {
+		log.Printf("Update %s/%s/%s failed integrity verification", update.Branch, update.RuntimeVersion, update.UpdateId)
+	}
+	return report, nil
+}
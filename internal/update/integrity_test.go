@@ -0,0 +1,59 @@
+package update
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"expo-open-ota/internal/types"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func md5Hex(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckFileContent(t *testing.T) {
+	content := "console.log('bundle')"
+	expected := &types.UploadFile{Name: "bundle.js", SHA256: sha256Hex(content), Size: int64(len(content))}
+
+	result := checkFileContent("bundle.js", strings.NewReader(content), expected)
+	assert.Equal(t, types.FileIntegrityOK, result.Status)
+
+	result = checkFileContent("bundle.js", strings.NewReader(content[:10]), expected)
+	assert.Equal(t, types.FileIntegritySizeMismatch, result.Status)
+	assert.Equal(t, int64(10), result.ActualSize)
+
+	altered := strings.Replace(content, "bundle", "BUNDLE", 1)
+	result = checkFileContent("bundle.js", strings.NewReader(altered), expected)
+	assert.Equal(t, types.FileIntegrityHashMismatch, result.Status)
+	assert.Equal(t, sha256Hex(altered), result.ActualSHA256)
+}
+
+func TestValidateUploadFiles(t *testing.T) {
+	valid := types.UploadFile{Name: "bundle.js", SHA256: sha256Hex("a"), Size: 1}
+	assert.NoError(t, ValidateUploadFiles([]types.UploadFile{valid}))
+	assert.Error(t, ValidateUploadFiles([]types.UploadFile{valid, valid}))
+	assert.Error(t, ValidateUploadFiles([]types.UploadFile{{Name: "bundle.js", SHA256: "abc", Size: 1}}))
+	assert.Error(t, ValidateUploadFiles([]types.UploadFile{{Name: "bundle.js", SHA256: sha256Hex("a"), Size: -1}}))
+}
+
+func TestContentAssetManifestHash(t *testing.T) {
+	content := "icon"
+	sum := sha256.Sum256([]byte(content))
+	manifestHash, err := ContentAssetManifestHash(sha256Hex(content))
+	assert.NoError(t, err)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), manifestHash)
+
+	_, err = ContentAssetManifestHash("abcd")
+	assert.Error(t, err)
+}
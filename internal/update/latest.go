@@ -0,0 +1,283 @@
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"log"
+	"path"
+	"time"
+)
+
+const latestPointerFileName = "latest.json"
+
+// Platforms are the platforms a latest update pointer is kept for.
+var Platforms = []string{"ios", "android"}
+
+// LatestPointerKey is the object key, relative to SystemPrefix, of the latest
+// update pointer of a branch, runtime version and platform.
+func LatestPointerKey(branch string, runtimeVersion string, platform string) string {
+	return path.Join("latest", branch, runtimeVersion, platform, latestPointerFileName)
+}
+
+func ComputeLatestPointerCacheKey(branch string, runtimeVersion string, platform string) string {
+	return fmt.Sprintf("latestPointer:%s:%s:%s", branch, runtimeVersion, platform)
+}
+
+func isKnownPlatform(platform string) bool {
+	for _, known := range Platforms {
+		if platform == known {
+			return true
+		}
+	}
+	return false
+}
+
+// updateTargetsPlatform reports whether an update can be served to a
+// platform: rollbacks apply to every platform, other updates need a bundle.
+func updateTargetsPlatform(update types.Update, platform string) bool {
+	if GetUpdateType(update) == types.Rollback {
+		return true
+	}
+	metadata, err := GetMetadata(update)
+	if err != nil {
+		log.Printf("Error reading metadata of update %s, leaving it out of the latest pointer: %v", update.UpdateId, err)
+		return false
+	}
+	switch platform {
+	case "ios":
+		return metadata.MetadataJSON.FileMetadata.IOS.Bundle != ""
+	case "android":
+		return metadata.MetadataJSON.FileMetadata.Android.Bundle != ""
+	}
+	return false
+}
+
+// BuildLatestPointer computes the pointer of a platform from the valid
+// updates of a runtime version, highest build number first. It keeps the
+// staged rollouts newer than the first update every client gets, and that
+// update.
+func BuildLatestPointer(branch string, runtimeVersion string, platform string, validUpdates []types.Update) (types.LatestUpdatePointer, error) {
+	pointer := types.LatestUpdatePointer{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		Platform:       platform,
+		Updates:        []types.Update{},
+		UpdatedAt:      time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+	for _, candidate := range validUpdates {
+		if !updateTargetsPlatform(candidate, platform) {
+			continue
+		}
+		rollout, err := GetRollout(candidate)
+		if err != nil {
+			return pointer, fmt.Errorf("error reading rollout of update %s: %w", candidate.UpdateId, err)
+		}
+		if rollout != nil && rollout.Status == types.RolloutAborted {
+			continue
+		}
+		pointer.Updates = append(pointer.Updates, candidate)
+		if rollout == nil || rollout.Status == types.RolloutCompleted {
+			break
+		}
+	}
+	return pointer, nil
+}
+
+func saveLatestPointer(pointer types.LatestUpdatePointer) error {
+	content, err := json.Marshal(pointer)
+	if err != nil {
+		return fmt.Errorf("error marshalling latest pointer: %w", err)
+	}
+	// Objects are replaced whole, readers see the old pointer or the new one
+	resolvedBucket := bucket.GetBucket()
+	key := LatestPointerKey(pointer.Branch, pointer.RuntimeVersion, pointer.Platform)
+	if err := resolvedBucket.PutObject(key, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("error saving latest pointer %s: %w", key, err)
+	}
+	return nil
+}
+
+// maxPointerWrites bounds how many times RebuildLatestPointers rewrites the
+// pointers of a runtime version whose updates keep changing.
+const maxPointerWrites = 3
+
+func buildLatestPointers(branch string, runtimeVersion string) ([]types.LatestUpdatePointer, error) {
+	// Not coalesced: a publish must see the update it just made valid
+	validUpdates, err := getValidUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error listing updates of %s/%s: %w", branch, runtimeVersion, err)
+	}
+	pointers := make([]types.LatestUpdatePointer, 0, len(Platforms))
+	for _, platform := range Platforms {
+		pointer, err := BuildLatestPointer(branch, runtimeVersion, platform, validUpdates)
+		if err != nil {
+			return nil, err
+		}
+		pointers = append(pointers, pointer)
+	}
+	return pointers, nil
+}
+
+// sameLatestPointers reports whether two sets of pointers point to the same
+// updates, whenever they were built.
+func sameLatestPointers(a []types.LatestUpdatePointer, b []types.LatestUpdatePointer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Platform != b[i].Platform || len(a[i].Updates) != len(b[i].Updates) {
+			return false
+		}
+		for j := range a[i].Updates {
+			if a[i].Updates[j].UpdateId != b[i].Updates[j].UpdateId {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// saveLatestPointers writes pointers, then builds them again from a fresh
+// listing. A publish, rollout change or concurrent rebuild that happened
+// meanwhile may have been overwritten by an older listing, so the fresh
+// pointers are written until two listings agree.
+func saveLatestPointers(pointers []types.LatestUpdatePointer, build func() ([]types.LatestUpdatePointer, error)) ([]types.LatestUpdatePointer, error) {
+	for attempt := 0; attempt < maxPointerWrites; attempt++ {
+		for _, pointer := range pointers {
+			if err := saveLatestPointer(pointer); err != nil {
+				return nil, err
+			}
+		}
+		current, err := build()
+		if err != nil {
+			return nil, err
+		}
+		if sameLatestPointers(pointers, current) {
+			return pointers, nil
+		}
+		pointers = current
+	}
+	branch, runtimeVersion := pointers[0].Branch, pointers[0].RuntimeVersion
+	return nil, fmt.Errorf("updates of %s/%s kept changing while saving their latest pointers", branch, runtimeVersion)
+}
+
+// RebuildLatestPointers scans the updates of a runtime version and rewrites
+// the pointer of every platform. Callers invalidate the cached pointers.
+func RebuildLatestPointers(branch string, runtimeVersion string) ([]types.LatestUpdatePointer, error) {
+	build := func() ([]types.LatestUpdatePointer, error) {
+		return buildLatestPointers(branch, runtimeVersion)
+	}
+	pointers, err := build()
+	if err != nil {
+		return nil, err
+	}
+	return saveLatestPointers(pointers, build)
+}
+
+// GetLatestPointer reads the latest update pointer of a platform, nil when it
+// was never written.
+func GetLatestPointer(branch string, runtimeVersion string, platform string) (*types.LatestUpdatePointer, error) {
+	cacheKey := ComputeLatestPointerCacheKey(branch, runtimeVersion, platform)
+	cache := cache2.GetCache()
+	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
+		var pointer types.LatestUpdatePointer
+		if err := json.Unmarshal([]byte(cachedValue), &pointer); err == nil {
+			return &pointer, nil
+		}
+	}
+	resolvedBucket := bucket.GetBucket()
+	object, err := resolvedBucket.GetObject(LatestPointerKey(branch, runtimeVersion, platform))
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading latest pointer: %w", err)
+	}
+	defer object.Close()
+	var pointer types.LatestUpdatePointer
+	if err := json.NewDecoder(object).Decode(&pointer); err != nil {
+		return nil, fmt.Errorf("error decoding latest pointer: %w", err)
+	}
+	if cacheValue, err := json.Marshal(pointer); err == nil {
+		_ = cache.Set(cacheKey, string(cacheValue), nil)
+	}
+	return &pointer, nil
+}
+
+// RefreshLatestPointers rewrites the pointers of a runtime version after its
+// updates changed and drops its cached entries on every instance.
+func RefreshLatestPointers(branch string, runtimeVersion string, reason cache2.InvalidationReason) error {
+	_, err := RebuildLatestPointers(branch, runtimeVersion)
+	if err != nil {
+		// Stale pointers are dropped so the next request rebuilds them
+		resolvedBucket := bucket.GetBucket()
+		for _, platform := range Platforms {
+			if errDelete := resolvedBucket.DeleteObject(LatestPointerKey(branch, runtimeVersion, platform)); errDelete != nil && !errors.Is(errDelete, bucket.ErrObjectNotFound) {
+				log.Printf("Error deleting stale latest pointer of %s/%s/%s: %v", branch, runtimeVersion, platform, errDelete)
+			}
+		}
+	}
+	InvalidateRuntimeVersionCache(branch, runtimeVersion, reason)
+	return err
+}
+
+// resolveLatestPointer returns the pointer of a platform, writing the pointers
+// of runtime versions published before they existed on first request.
+func resolveLatestPointer(branch string, runtimeVersion string, platform string) (*types.LatestUpdatePointer, error) {
+	pointer, err := GetLatestPointer(branch, runtimeVersion, platform)
+	if err != nil || pointer != nil {
+		return pointer, err
+	}
+	flightKey := fmt.Sprintf("latestPointers:%s:%s", branch, runtimeVersion)
+	pointers, err := coalesce(flightKey, func() ([]types.LatestUpdatePointer, error) {
+		return RebuildLatestPointers(branch, runtimeVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pointers {
+		if pointers[i].Platform == platform {
+			rebuilt := pointers[i]
+			return &rebuilt, nil
+		}
+	}
+	return nil, nil
+}
+
+// RepairReport lists the runtime versions whose pointers a repair rewrote,
+// and the ones it failed to.
+type RepairReport struct {
+	Repaired []string `json:"repaired"`
+	Errors   []string `json:"errors"`
+}
+
+// RepairLatestPointers rebuilds the latest update pointers of every branch and
+// runtime version from a full scan of the bucket.
+func RepairLatestPointers() (RepairReport, error) {
+	report := RepairReport{Repaired: []string{}, Errors: []string{}}
+	resolvedBucket := bucket.GetBucket()
+	branches, err := resolvedBucket.GetBranches()
+	if err != nil {
+		return report, fmt.Errorf("error listing branches: %w", err)
+	}
+	for _, branch := range branches {
+		runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branch)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", branch, err))
+			continue
+		}
+		for _, runtimeVersion := range runtimeVersions {
+			if err := RefreshLatestPointers(branch, runtimeVersion.RuntimeVersion, cache2.InvalidationPublish); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", branch, runtimeVersion.RuntimeVersion, err))
+				continue
+			}
+			report.Repaired = append(report.Repaired, branch+"/"+runtimeVersion.RuntimeVersion)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,147 @@
+package update
+
+import (
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestPointersFollowPublishedUpdates(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publish := func(updateId string, platforms ...string) types.Update {
+		published := types.Update{Branch: "pointers", RuntimeVersion: "1.0.0", UpdateId: updateId}
+		fileMetadata := []string{}
+		for _, platform := range platforms {
+			fileMetadata = append(fileMetadata, `"`+platform+`":{"bundle":"bundles/`+platform+`.js","assets":[]}`)
+		}
+		metadata := `{"version":0,"fileMetadata":{` + strings.Join(fileMetadata, ",") + `}}`
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, "metadata.json", strings.NewReader(metadata)))
+		require.NoError(t, MarkUpdateAsChecked(published))
+		return published
+	}
+	pointerIds := func(platform string) []string {
+		pointer, err := GetLatestPointer("pointers", "1.0.0", platform)
+		require.NoError(t, err)
+		require.NotNil(t, pointer)
+		ids := []string{}
+		for _, pointed := range pointer.Updates {
+			ids = append(ids, pointed.UpdateId)
+		}
+		return ids
+	}
+	resolve := func(platform string) string {
+		resolved, err := ResolveUpdateForClient("pointers", "1.0.0", platform, "client-1")
+		require.NoError(t, err)
+		if resolved == nil {
+			return ""
+		}
+		return resolved.UpdateId
+	}
+
+	publish("1700000000000", "ios", "android")
+	publish("1700000000001", "ios")
+	assert.Equal(t, []string{"1700000000001"}, pointerIds("ios"))
+	assert.Equal(t, []string{"1700000000000"}, pointerIds("android"))
+
+	// A staged rollout keeps the update every client gets after it
+	staged := publish("1700000000002", "ios", "android")
+	_, err := SetRolloutPercentage(staged, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1700000000002", "1700000000001"}, pointerIds("ios"))
+	assert.Equal(t, "1700000000001", resolve("ios"))
+	_, err = PromoteRollout(staged)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1700000000002"}, pointerIds("android"))
+	assert.Equal(t, "1700000000002", resolve("android"))
+	assert.Equal(t, "", resolve("web"))
+
+	// Requests read the pointer only, the bucket is not listed
+	require.NoError(t, resolvedBucket.DeleteUpdateFolder("pointers", "1.0.0", "1700000000002"))
+	assert.Equal(t, "1700000000002", resolve("ios"))
+
+	// The repair rebuilds them from a full scan, and missing pointers are
+	// rebuilt on first request
+	report, err := RepairLatestPointers()
+	require.NoError(t, err)
+	assert.Contains(t, report.Repaired, "pointers/1.0.0")
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, "1700000000001", resolve("ios"))
+	require.NoError(t, resolvedBucket.DeleteObject(LatestPointerKey("pointers", "1.0.0", "android")))
+	require.NoError(t, cache2.GetCache().Clear())
+	assert.Equal(t, "1700000000000", resolve("android"))
+	assert.Equal(t, []string{"1700000000000"}, pointerIds("android"))
+}
+
+func TestSaveLatestPointersRewritesPointersThatChangedMeanwhile(t *testing.T) {
+	useLocalBucket(t)
+	pointerTo := func(updateId string) []types.LatestUpdatePointer {
+		return []types.LatestUpdatePointer{{
+			Branch:         "race",
+			RuntimeVersion: "1.0.0",
+			Platform:       "ios",
+			Updates:        []types.Update{{Branch: "race", RuntimeVersion: "1.0.0", UpdateId: updateId}},
+		}}
+	}
+
+	// A publish lands between the listing and the write of an older rebuild
+	builds := 0
+	saved, err := saveLatestPointers(pointerTo("1700000000000"), func() ([]types.LatestUpdatePointer, error) {
+		builds++
+		return pointerTo("1700000000001"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, builds)
+	assert.Equal(t, "1700000000001", saved[0].Updates[0].UpdateId)
+	pointer, err := GetLatestPointer("race", "1.0.0", "ios")
+	require.NoError(t, err)
+	require.NotNil(t, pointer)
+	assert.Equal(t, "1700000000001", pointer.Updates[0].UpdateId)
+
+	// Listings that never settle are reported
+	builds = 0
+	_, err = saveLatestPointers(pointerTo("1700000000000"), func() ([]types.LatestUpdatePointer, error) {
+		builds++
+		return pointerTo("17000000000" + strconv.Itoa(10+builds)), nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, maxPointerWrites, builds)
+}
+
+func TestUpdatesSharingABuildNumberAreOrderedByCreationTime(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	publish := func(updateId string, createdAt string) {
+		published := types.Update{Branch: "ties", RuntimeVersion: "1.0.0", UpdateId: updateId}
+		metadata := `{"version":0,"fileMetadata":{"ios":{"bundle":"bundles/ios.js","assets":[]}}}`
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(published, "metadata.json", strings.NewReader(metadata)))
+		require.NoError(t, WriteUpdateMetadataFile(published, types.UpdateMetadataFile{CreatedAt: createdAt}))
+		require.NoError(t, MarkUpdateAsChecked(published))
+	}
+	latestId := func() string {
+		latest, err := GetLatestUpdateBundlePathForRuntimeVersion("ties", "1.0.0", "")
+		require.NoError(t, err)
+		require.NotNil(t, latest)
+		return latest.UpdateId
+	}
+
+	publish("build-5-a", "2023-11-14T22:13:20.000Z")
+	rollback, _, err := CreateRollback("ties", "1.0.0", "abc123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rollback.UpdateId, "build-6-"))
+	assert.Equal(t, rollback.UpdateId, latestId())
+
+	// The next build takes the number of the rollback and its id sorts first,
+	// being published after the rollback is what makes it the latest
+	next := "build-6-00000000-0000-0000-0000-000000000000"
+	publish(next, time.Now().Add(time.Minute).UTC().Format("2006-01-02T15:04:05.000Z"))
+	assert.Equal(t, next, latestId())
+	pointer, err := GetLatestPointer("ties", "1.0.0", "ios")
+	require.NoError(t, err)
+	require.NotNil(t, pointer)
+	assert.Equal(t, next, pointer.Updates[0].UpdateId)
+}
@@ -0,0 +1,126 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrCannotRepublishRollback = errors.New("rollbacks cannot be republished")
+
+// updateFileNames lists the files making up an update: its metadata, expo
+// config, and the bundles and assets of every platform.
+func updateFileNames(metadata types.UpdateMetadata) []string {
+	fileNames := []string{"metadata.json", "expoConfig.json"}
+	seen := map[string]bool{"metadata.json": true, "expoConfig.json": true}
+	add := func(fileName string) {
+		if fileName != "" && !seen[fileName] {
+			seen[fileName] = true
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	for _, platformMetadata := range []types.PlatformMetadata{
+		metadata.MetadataJSON.FileMetadata.IOS,
+		metadata.MetadataJSON.FileMetadata.Android,
+	} {
+		add(platformMetadata.Bundle)
+		for _, asset := range platformMetadata.Assets {
+			add(asset.Path)
+		}
+	}
+	return fileNames
+}
+
+// RepublishUpdate copies an update to another branch under a new update id,
+// without the client uploading it again. The new update keeps a reference to
+// the update it was copied from.
+func RepublishUpdate(source types.Update, targetBranch string) (*types.Update, error) {
+	if GetUpdateType(source) == types.Rollback {
+		return nil, ErrCannotRepublishRollback
+	}
+	metadata, err := GetMetadata(source)
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata of update %s: %w", source.UpdateId, err)
+	}
+	updateId, err := GenerateUpdateId(targetBranch, source.RuntimeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error generating update id: %w", err)
+	}
+	target := types.Update{
+		Branch:         targetBranch,
+		RuntimeVersion: source.RuntimeVersion,
+		UpdateId:       updateId,
+		CreatedAt:      time.Duration(time.Now().UnixMilli()) * time.Millisecond,
+	}
+
+	hashes, err := ContentAssetHashes(source)
+	if err != nil {
+		return nil, err
+	}
+	fileNames := updateFileNames(metadata)
+	if len(hashes) > 0 {
+		// The copy resolves its assets from the content store like the source
+		fileNames = append(fileNames, integrityFileName)
+	}
+
+	resolvedBucket := bucket.GetBucket()
+	for _, fileName := range fileNames {
+		if sha256Hex, shared := hashes[fileName]; shared {
+			exists, err := HasContentAsset(sha256Hex)
+			if err != nil {
+				_ = resolvedBucket.DeleteUpdateFolder(target.Branch, target.RuntimeVersion, target.UpdateId)
+				return nil, fmt.Errorf("error checking the content store for %s: %w", fileName, err)
+			}
+			if exists {
+				continue
+			}
+		}
+		if err := resolvedBucket.CopyFile(source, target, fileName); err != nil {
+			// Do not leave a half-copied update behind
+			_ = resolvedBucket.DeleteUpdateFolder(target.Branch, target.RuntimeVersion, target.UpdateId)
+			return nil, fmt.Errorf("error copying %s: %w", fileName, err)
+		}
+	}
+
+	sourceMetadataFile, err := ReadUpdateMetadataFile(source)
+	if err != nil {
+		log.Printf("No update metadata for update %s, republishing without it: %v", source.UpdateId, err)
+	}
+	// The copy carries the fields of the source this server does not know
+	sourceFields, err := readUpdateMetadataFields(source)
+	if err != nil {
+		sourceFields = map[string]json.RawMessage{}
+	}
+	target.Platform = sourceMetadataFile.Platform
+	target.CommitHash = sourceMetadataFile.CommitHash
+	err = writeUpdateMetadataFields(target, sourceFields, types.UpdateMetadataFile{
+		Platform:   sourceMetadataFile.Platform,
+		CommitHash: sourceMetadataFile.CommitHash,
+		CreatedAt:  time.UnixMilli(target.CreatedAt.Milliseconds()).UTC().Format("2006-01-02T15:04:05.000Z"),
+		RepublishedFrom: &types.UpdateReference{
+			Branch:         source.Branch,
+			RuntimeVersion: source.RuntimeVersion,
+			UpdateId:       source.UpdateId,
+		},
+	})
+	if err != nil {
+		_ = resolvedBucket.DeleteUpdateFolder(target.Branch, target.RuntimeVersion, target.UpdateId)
+		return nil, fmt.Errorf("error writing update metadata: %w", err)
+	}
+
+	if _, err := IndexUpdateAssets(target); err != nil {
+		_ = resolvedBucket.DeleteUpdateFolder(target.Branch, target.RuntimeVersion, target.UpdateId)
+		return nil, fmt.Errorf("error indexing assets: %w", err)
+	}
+
+	if err := MarkUpdateAsChecked(target); err != nil {
+		return nil, err
+	}
+	log.Printf("Update %s/%s/%s republished as %s/%s/%s", source.Branch, source.RuntimeVersion, source.UpdateId,
+		target.Branch, target.RuntimeVersion, target.UpdateId)
+	return &target, nil
+}
@@ -0,0 +1,55 @@
+package update
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// CreateRollback publishes a rollback update on a branch/runtime version, so
+// that clients checking for updates are sent back to their embedded update.
+func CreateRollback(branch string, runtimeVersion string, commitHash string) (*types.Update, *types.RollbackDirective, error) {
+	updateId, err := GenerateUpdateId(branch, runtimeVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating rollback update id: %w", err)
+	}
+	now := time.Now()
+	rollbackUpdate := types.Update{
+		Branch:         branch,
+		RuntimeVersion: runtimeVersion,
+		UpdateId:       updateId,
+		CreatedAt:      time.Duration(now.UnixMilli()) * time.Millisecond,
+		CommitHash:     commitHash,
+	}
+	directive := types.RollbackDirective{
+		Type: "rollBackToEmbedded",
+		Parameters: types.RollbackDirectiveParameters{
+			CommitTime: now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		},
+	}
+	content, err := json.Marshal(directive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshalling rollback directive: %w", err)
+	}
+
+	resolvedBucket := bucket.GetBucket()
+	if err := resolvedBucket.UploadFileIntoUpdate(rollbackUpdate, "rollback", strings.NewReader(string(content))); err != nil {
+		return nil, nil, fmt.Errorf("error writing rollback directive: %w", err)
+	}
+	if err := WriteUpdateMetadataFile(rollbackUpdate, types.UpdateMetadataFile{
+		CommitHash: commitHash,
+		CreatedAt:  directive.Parameters.CommitTime,
+	}); err != nil {
+		return nil, nil, fmt.Errorf("error writing rollback metadata: %w", err)
+	}
+	if err := markUpdateAsChecked(rollbackUpdate, cache2.InvalidationRollback); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Rollback %s published on %s/%s", updateId, branch, runtimeVersion)
+	return &rollbackUpdate, &directive, nil
+}
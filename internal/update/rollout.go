@@ -0,0 +1,220 @@
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const rolloutFileName = "rollout.json"
+
+var (
+	ErrInvalidRolloutPercentage = errors.New("rollout percentage must be between 0 and 100")
+	ErrRolloutPercentageLowered = errors.New("rollout percentage can only be raised, abort the rollout instead")
+	ErrRolloutNotInProgress     = errors.New("rollout is not in progress")
+)
+
+func ComputeRolloutCacheKey(branch string, runtimeVersion string, updateId string) string {
+	return fmt.Sprintf("rollout:%s:%s:%s", branch, runtimeVersion, updateId)
+}
+
+// GetRollout returns the rollout attached to an update, or nil when the update
+// is not staged and should be served to every client.
+func GetRollout(update types.Update) (*types.Rollout, error) {
+	cache := cache2.GetCache()
+	cacheKey := ComputeRolloutCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId)
+	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
+		if cachedValue == "none" {
+			return nil, nil
+		}
+		var rollout types.Rollout
+		if err := json.Unmarshal([]byte(cachedValue), &rollout); err == nil {
+			return &rollout, nil
+		}
+	}
+
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, rolloutFileName)
+	if err != nil || file == nil {
+		_ = cache.Set(cacheKey, "none", nil)
+		return nil, nil
+	}
+	defer file.Close()
+
+	var rollout types.Rollout
+	if err := json.NewDecoder(file).Decode(&rollout); err != nil {
+		return nil, fmt.Errorf("error decoding rollout for update %s: %w", update.UpdateId, err)
+	}
+	cacheValue, _ := json.Marshal(rollout)
+	_ = cache.Set(cacheKey, string(cacheValue), nil)
+	return &rollout, nil
+}
+
+func saveRollout(update types.Update, rollout types.Rollout) error {
+	rollout.UpdatedAt = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	content, err := json.Marshal(rollout)
+	if err != nil {
+		return fmt.Errorf("error marshalling rollout: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	if err := resolvedBucket.UploadFileIntoUpdate(update, rolloutFileName, strings.NewReader(string(content))); err != nil {
+		return fmt.Errorf("error saving rollout: %w", err)
+	}
+	// The pointers are rebuilt from the new rollout
+	cache2.Invalidate(cache2.InvalidationRollout, ComputeRolloutCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId))
+	return RefreshLatestPointers(update.Branch, update.RuntimeVersion, cache2.InvalidationRollout)
+}
+
+// SetRolloutPercentage starts a staged rollout for an update or raises the
+// percentage of the one already in progress.
+func SetRolloutPercentage(update types.Update, percentage int) (*types.Rollout, error) {
+	if percentage < 0 || percentage > 100 {
+		return nil, ErrInvalidRolloutPercentage
+	}
+	current, err := GetRollout(update)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		if current.Status != types.RolloutInProgress {
+			return nil, ErrRolloutNotInProgress
+		}
+		if percentage < current.Percentage {
+			return nil, ErrRolloutPercentageLowered
+		}
+	}
+	rollout := types.Rollout{
+		Percentage: percentage,
+		Status:     types.RolloutInProgress,
+	}
+	if percentage == 100 {
+		rollout.Status = types.RolloutCompleted
+	}
+	if err := saveRollout(update, rollout); err != nil {
+		return nil, err
+	}
+	log.Printf("Rollout of update %s/%s/%s set to %d%%", update.Branch, update.RuntimeVersion, update.UpdateId, percentage)
+	return &rollout, nil
+}
+
+// PromoteRollout serves the update to every client.
+func PromoteRollout(update types.Update) (*types.Rollout, error) {
+	current, err := GetRollout(update)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Status == types.RolloutAborted {
+		return nil, ErrRolloutNotInProgress
+	}
+	rollout := types.Rollout{
+		Percentage: 100,
+		Status:     types.RolloutCompleted,
+	}
+	if err := saveRollout(update, rollout); err != nil {
+		return nil, err
+	}
+	log.Printf("Rollout of update %s/%s/%s promoted", update.Branch, update.RuntimeVersion, update.UpdateId)
+	return &rollout, nil
+}
+
+// AbortRollout stops serving the update, clients fall back to the previous one.
+func AbortRollout(update types.Update) (*types.Rollout, error) {
+	current, err := GetRollout(update)
+	if err != nil {
+		return nil, err
+	}
+	rollout := types.Rollout{
+		Status: types.RolloutAborted,
+	}
+	if current != nil {
+		rollout.Percentage = current.Percentage
+	}
+	if err := saveRollout(update, rollout); err != nil {
+		return nil, err
+	}
+	log.Printf("Rollout of update %s/%s/%s aborted", update.Branch, update.RuntimeVersion, update.UpdateId)
+	return &rollout, nil
+}
+
+// ComputeRolloutBucket deterministically places a client in [0, 100) for a
+// given update, so that raising the percentage only ever adds clients.
+func ComputeRolloutBucket(updateId string, clientKey string) int {
+	sum := sha256.Sum256([]byte(updateId + ":" + clientKey))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+func IsClientInRollout(rollout *types.Rollout, updateId string, clientKey string) bool {
+	if rollout == nil {
+		return true
+	}
+	switch rollout.Status {
+	case types.RolloutCompleted:
+		return true
+	case types.RolloutAborted:
+		return false
+	}
+	if clientKey == "" {
+		return rollout.Percentage >= 100
+	}
+	return ComputeRolloutBucket(updateId, clientKey) < rollout.Percentage
+}
+
+// GetValidUpdatesForRuntimeVersion returns the valid updates of a runtime
+// version, highest build number first.
+func GetValidUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]types.Update, error) {
+	flightKey := fmt.Sprintf("validUpdates:%s:%s", branch, runtimeVersion)
+	updates, err := coalesce(flightKey, func() ([]types.Update, error) {
+		return getValidUpdatesForRuntimeVersion(branch, runtimeVersion)
+	})
+	// Callers keep pointers into the slice, each gets its own
+	return append([]types.Update(nil), updates...), err
+}
+
+func getValidUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]types.Update, error) {
+	updates, err := GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return nil, err
+	}
+	validUpdates := make([]types.Update, 0, len(updates))
+	for _, update := range updates {
+		if IsUpdateValid(update) {
+			validUpdates = append(validUpdates, update)
+		}
+	}
+	sortUpdatesByBuildNumber(validUpdates)
+	return validUpdates, nil
+}
+
+// ResolveUpdateForClient returns the newest update the client is eligible for,
+// skipping staged updates whose rollout does not include it. Only the latest
+// update pointer of the platform is read, the bucket is not listed.
+func ResolveUpdateForClient(branch string, runtimeVersion string, platform string, clientKey string) (*types.Update, error) {
+	if !isKnownPlatform(platform) {
+		return nil, nil
+	}
+	pointer, err := resolveLatestPointer(branch, runtimeVersion, platform)
+	if err != nil || pointer == nil {
+		return nil, err
+	}
+	updates := pointer.Updates
+	for i := range updates {
+		rollout, err := GetRollout(updates[i])
+		if err != nil {
+			log.Printf("Error reading rollout for update %s: %v", updates[i].UpdateId, err)
+			continue
+		}
+		if IsClientInRollout(rollout, updates[i].UpdateId, clientKey) {
+			return &updates[i], nil
+		}
+		log.Printf("Client not included in rollout of update %s, trying previous update", updates[i].UpdateId)
+	}
+	return nil, nil
+}
@@ -0,0 +1,46 @@
+package update
+
+import (
+	"expo-open-ota/internal/types"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeRolloutBucketIsDeterministic(t *testing.T) {
+	first := ComputeRolloutBucket("build-3-abc", "client-1")
+	second := ComputeRolloutBucket("build-3-abc", "client-1")
+	assert.Equal(t, first, second)
+	assert.GreaterOrEqual(t, first, 0)
+	assert.Less(t, first, 100)
+}
+
+func TestIsClientInRolloutPercentage(t *testing.T) {
+	rollout := &types.Rollout{Percentage: 10, Status: types.RolloutInProgress}
+	included := 0
+	for i := 0; i < 10000; i++ {
+		if IsClientInRollout(rollout, "build-3-abc", fmt.Sprintf("client-%d", i)) {
+			included++
+		}
+	}
+	assert.InDelta(t, 1000, included, 150)
+}
+
+func TestRaisingRolloutKeepsIncludedClients(t *testing.T) {
+	low := &types.Rollout{Percentage: 20, Status: types.RolloutInProgress}
+	high := &types.Rollout{Percentage: 50, Status: types.RolloutInProgress}
+	for i := 0; i < 1000; i++ {
+		clientKey := fmt.Sprintf("client-%d", i)
+		if IsClientInRollout(low, "build-3-abc", clientKey) {
+			assert.True(t, IsClientInRollout(high, "build-3-abc", clientKey))
+		}
+	}
+}
+
+func TestIsClientInRolloutStatus(t *testing.T) {
+	assert.True(t, IsClientInRollout(nil, "build-3-abc", "client-1"))
+	assert.True(t, IsClientInRollout(&types.Rollout{Percentage: 0, Status: types.RolloutCompleted}, "build-3-abc", "client-1"))
+	assert.False(t, IsClientInRollout(&types.Rollout{Percentage: 100, Status: types.RolloutAborted}, "build-3-abc", "client-1"))
+	assert.False(t, IsClientInRollout(&types.Rollout{Percentage: 50, Status: types.RolloutInProgress}, "build-3-abc", ""))
+}
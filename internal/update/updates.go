@@ -2,6 +2,7 @@ package update
 
 import (
 	"encoding/json"
+	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
@@ -18,10 +19,12 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func sortUpdates(updates []types.Update) []types.Update {
-	sort.Slice(updates, func(i, j int) bool {
+	sort.SliceStable(updates, func(i, j int) bool {
 		return updates[i].CreatedAt > updates[j].CreatedAt
 	})
 	return updates
@@ -52,18 +55,53 @@ func GetAllUpdatesForRuntimeVersion(branch string, runtimeVersion string) ([]typ
 	return updates, nil
 }
 
-func MarkUpdateAsChecked(update types.Update) error {
-	cache := cache2.GetCache()
+func runtimeVersionCacheKeys(branch string, runtimeVersion string) []string {
 	branchesCacheKey := dashboard.ComputeGetBranchesCacheKey()
-	runTimeVersionsCacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(update.Branch)
-	updatesCacheKey := dashboard.ComputeGetUpdatesCacheKey(update.Branch, update.RuntimeVersion)
-	cacheKeys := []string{ComputeLastUpdateCacheKey(update.Branch, update.RuntimeVersion), branchesCacheKey, runTimeVersionsCacheKey, updatesCacheKey}
-	for _, cacheKey := range cacheKeys {
-		cache.Delete(cacheKey)
+	runTimeVersionsCacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(branch)
+	updatesCacheKey := dashboard.ComputeGetUpdatesCacheKey(branch, runtimeVersion)
+	cacheKeys := []string{ComputeLastUpdateCacheKey(branch, runtimeVersion), branchesCacheKey, runTimeVersionsCacheKey, updatesCacheKey}
+	for _, platform := range Platforms {
+		cacheKeys = append(cacheKeys, ComputeLatestPointerCacheKey(branch, runtimeVersion, platform))
+	}
+	return cacheKeys
+}
+
+// InvalidateRuntimeVersionCache drops the cached latest update and dashboard
+// listings of a branch/runtime version on every instance after its updates
+// changed.
+func InvalidateRuntimeVersionCache(branch string, runtimeVersion string, reason cache2.InvalidationReason) {
+	cache2.Invalidate(reason, runtimeVersionCacheKeys(branch, runtimeVersion)...)
+}
+
+// InvalidateUpdateCache drops the cached metadata, asset index and rollout of
+// updates on every instance, once they are deleted.
+func InvalidateUpdateCache(reason cache2.InvalidationReason, updates ...types.Update) {
+	cacheKeys := make([]string, 0, 3*len(updates))
+	for _, deleted := range updates {
+		cacheKeys = append(cacheKeys,
+			ComputeMetadataCacheKey(deleted.Branch, deleted.RuntimeVersion, deleted.UpdateId),
+			ComputeAssetIndexCacheKey(deleted),
+			ComputeRolloutCacheKey(deleted.Branch, deleted.RuntimeVersion, deleted.UpdateId))
+	}
+	cache2.Invalidate(reason, cacheKeys...)
+}
+
+func MarkUpdateAsChecked(update types.Update) error {
+	return markUpdateAsChecked(update, cache2.InvalidationPublish)
+}
+
+func markUpdateAsChecked(update types.Update, reason cache2.InvalidationReason) error {
+	if _, err := EnsureUpdateCreatedAt(update); err != nil {
+		return err
+	}
+	if err := RefreshLatestPointers(update.Branch, update.RuntimeVersion, reason); err != nil {
+		return err
 	}
 	resolvedBucket := bucket.GetBucket()
 	reader := strings.NewReader(".check")
-	_ = resolvedBucket.UploadFileIntoUpdate(update, ".check", reader)
+	if err := resolvedBucket.UploadFileIntoUpdate(update, ".check", reader); err != nil {
+		return fmt.Errorf("error marking update %s as checked: %w", update.UpdateId, err)
+	}
 	return nil
 }
 
@@ -114,49 +152,39 @@ func ComputeManifestAssetCacheKey(update types.Update, assetPath string) string
 	return fmt.Sprintf("asset:%s:%s:%s:%s", update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
 }
 
+// VerifyUploadedUpdate returns an error naming the files of the update that
+// failed integrity verification.
 func VerifyUploadedUpdate(update types.Update) error {
-	metadata, errMetadata := GetMetadata(update)
-	if errMetadata != nil {
-		return errMetadata
-	}
-	if metadata.MetadataJSON.FileMetadata.IOS.Bundle == "" && metadata.MetadataJSON.FileMetadata.Android.Bundle == "" {
-		return fmt.Errorf("missing bundle path in metadata")
-	}
-	files := []string{}
-	if metadata.MetadataJSON.FileMetadata.IOS.Bundle != "" {
-		files = append(files, metadata.MetadataJSON.FileMetadata.IOS.Bundle)
-		for _, asset := range metadata.MetadataJSON.FileMetadata.IOS.Assets {
-			files = append(files, asset.Path)
-		}
+	report, err := VerifyUpdateIntegrity(update)
+	if err != nil {
+		return err
 	}
-	if metadata.MetadataJSON.FileMetadata.Android.Bundle != "" {
-		files = append(files, metadata.MetadataJSON.FileMetadata.Android.Bundle)
-		for _, asset := range metadata.MetadataJSON.FileMetadata.Android.Assets {
-			files = append(files, asset.Path)
-		}
+	if report.Valid {
+		return nil
 	}
-
-	resolvedBucket := bucket.GetBucket()
-	for _, file := range files {
-		_, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, file)
-		if err != nil {
-			return fmt.Errorf("missing file: %s in update", file)
+	var failures []string
+	for _, file := range report.Files {
+		if file.Status != types.FileIntegrityOK {
+			failures = append(failures, fmt.Sprintf("%s: %s", file.Name, file.Status))
 		}
 	}
-	return nil
+	return fmt.Errorf("invalid files in update: %s", strings.Join(failures, ", "))
 }
 
 func GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error) {
-	updateIdInt64, err := strconv.ParseInt(updateId, 10, 64)
-	if err != nil {
-		return nil, err
+	if updateId == "" {
+		return nil, fmt.Errorf("update id is required")
 	}
-	return &types.Update{
+	update := &types.Update{
 		Branch:         branch,
 		RuntimeVersion: runtimeVersion,
 		UpdateId:       updateId,
-		CreatedAt:      time.Duration(updateIdInt64) * time.Millisecond,
-	}, nil
+	}
+	// Timestamp ids carry their creation time, build-N-uuid and uuid ids do not
+	if updateIdInt64, err := strconv.ParseInt(updateId, 10, 64); err == nil {
+		update.CreatedAt = time.Duration(updateIdInt64) * time.Millisecond
+	}
+	return update, nil
 }
 
 func AreUpdatesIdentical(update1, update2 types.Update, platform string) (bool, error) {
@@ -191,11 +219,23 @@ func AreUpdatesIdentical(update1, update2 types.Update, platform string) (bool,
 }
 
 func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion string, buildNumber string) (*types.Update, error) {
-	cache := cache2.GetCache()
-	cacheKey := fmt.Sprintf(ComputeLastUpdateCacheKey(branch, runtimeVersion))
-	if buildNumber != "" {
-		cacheKey = fmt.Sprintf("%s:%s", cacheKey, buildNumber)
+	// The latest update does not depend on the client build either
+	latest, err := coalesce(ComputeLastUpdateCacheKey(branch, runtimeVersion), func() (*types.Update, error) {
+		return getLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion, buildNumber)
+	})
+	if latest == nil {
+		return nil, err
 	}
+	// Every caller gets its own copy of the shared result
+	latestCopy := *latest
+	return &latestCopy, err
+}
+
+func getLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion string, buildNumber string) (*types.Update, error) {
+	cache := cache2.GetCache()
+	// The latest update does not depend on the client build, keep a single key
+	// so publishing or rolling back invalidates it for every client
+	cacheKey := ComputeLastUpdateCacheKey(branch, runtimeVersion)
 
 	log.Printf("Searching for updates in branch=%s, runtimeVersion=%s, buildNumber=%s", branch, runtimeVersion, buildNumber)
 
@@ -247,6 +287,9 @@ func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion st
 				log.Printf("Found higher build number: %d > %d", buildNum, highestBuildNum)
 				highestBuildNum = buildNum
 				highestBuildUpdate = &update
+			} else if buildNum >= 0 && buildNum == highestBuildNum && updateCreationTime(update).After(updateCreationTime(*highestBuildUpdate)) {
+				log.Printf("Found newer update with build number %d: %s", buildNum, update.UpdateId)
+				highestBuildUpdate = &update
 			}
 		} else {
 			log.Printf("INVALID UPDATE: %s", update.UpdateId)
@@ -302,6 +345,44 @@ func extractBuildNumber(str string) int {
 	return -1
 }
 
+// updateCreationTime returns the creation time of an update, the zero time
+// when it cannot be read.
+func updateCreationTime(update types.Update) time.Time {
+	createdAt, err := UpdateCreatedAt(update)
+	if err != nil {
+		log.Printf("Error reading creation time of update %s: %v", update.UpdateId, err)
+		return time.Time{}
+	}
+	parsed, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		log.Printf("Invalid creation time %q of update %s", createdAt, update.UpdateId)
+		return time.Time{}
+	}
+	return parsed
+}
+
+// sortUpdatesByBuildNumber orders updates highest build number first. Updates
+// sharing a build number, like a rollback and the build published after it,
+// are ordered newest first. Updates without one keep their order.
+func sortUpdatesByBuildNumber(updates []types.Update) {
+	creationTimes := map[string]time.Time{}
+	creationTime := func(update types.Update) time.Time {
+		if createdAt, ok := creationTimes[update.UpdateId]; ok {
+			return createdAt
+		}
+		createdAt := updateCreationTime(update)
+		creationTimes[update.UpdateId] = createdAt
+		return createdAt
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
+		buildI, buildJ := extractBuildNumber(updates[i].UpdateId), extractBuildNumber(updates[j].UpdateId)
+		if buildI != buildJ {
+			return buildI > buildJ
+		}
+		return buildI >= 0 && creationTime(updates[i]).After(creationTime(updates[j]))
+	})
+}
+
 func GetUpdateType(update types.Update) types.UpdateType {
 	resolvedBucket := bucket.GetBucket()
 	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "rollback")
@@ -329,6 +410,12 @@ func GetExpoConfig(update types.Update) (json.RawMessage, error) {
 
 func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 	metadataCacheKey := ComputeMetadataCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId)
+	return coalesce(metadataCacheKey, func() (types.UpdateMetadata, error) {
+		return getMetadata(update, metadataCacheKey)
+	})
+}
+
+func getMetadata(update types.Update, metadataCacheKey string) (types.UpdateMetadata, error) {
 	cache := cache2.GetCache()
 	if cachedValue := cache.Get(metadataCacheKey); cachedValue != "" {
 		var metadata types.UpdateMetadata
@@ -374,12 +461,18 @@ func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 	extraData, _ := json.MarshalIndent(metadataJson.Extra, "", "  ")
 	log.Printf("DEBUG: Extra fields in metadata: %s", string(extraData))
 
-	metadata.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	createdAt, err := UpdateCreatedAt(update)
+	if err != nil {
+		return types.UpdateMetadata{}, err
+	}
+	metadata.CreatedAt = createdAt
 	metadata.MetadataJSON = metadataJson
 	stringifiedMetadata, err := json.Marshal(metadata.MetadataJSON)
 	if err != nil {
 		return types.UpdateMetadata{}, err
 	}
+	// The id only depends on the metadata content, so it is identical on every
+	// replica and survives cache evictions
 	id, errHash := crypto.CreateHash(stringifiedMetadata, "sha256", "hex")
 
 	if errHash != nil {
@@ -410,12 +503,37 @@ func BuildFinalManifestAssetUrlURL(baseURL, assetFilePath, runtimeVersion, platf
 	return parsedURL.String(), nil
 }
 
+// BuildUpdateAssetUrl is the URL of a file of an update folder. It names the
+// update, so a client downloading it is never served the file of an update
+// published meanwhile, and the response can be cached forever.
+func BuildUpdateAssetUrl(update types.Update, assetFilePath string, platform string) (string, error) {
+	assetUrl, err := BuildFinalManifestAssetUrlURL(GetAssetEndpoint(), assetFilePath, update.RuntimeVersion, platform)
+	if err != nil {
+		return "", err
+	}
+	parsedURL, err := url.Parse(assetUrl)
+	if err != nil {
+		return "", err
+	}
+	query := parsedURL.Query()
+	query.Set("branch", update.Branch)
+	query.Set("updateId", update.UpdateId)
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), nil
+}
+
 func GetAssetEndpoint() string {
 	return config.GetEnv("BASE_URL") + "/api/update/assets"
 }
 
 func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset bool, platform string) (types.ManifestAsset, error) {
 	cacheKey := ComputeManifestAssetCacheKey(update, asset.Path)
+	return coalesce(cacheKey, func() (types.ManifestAsset, error) {
+		return buildManifestAsset(update, asset, isLaunchAsset, platform, cacheKey)
+	})
+}
+
+func buildManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset bool, platform string, cacheKey string) (types.ManifestAsset, error) {
 	cache := cache2.GetCache()
 	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
 		var manifestAsset types.ManifestAsset
@@ -425,70 +543,6 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 		}
 		return manifestAsset, nil
 	}
-	resolvedBucket := bucket.GetBucket()
-
-	// Path to try
-	assetPath := asset.Path
-
-	// Try to get the file at specified path
-	assetFile, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
-
-	// If file not found and it's a bundle file, try alternate locations
-	if err != nil && isLaunchAsset {
-		log.Printf("Bundle file not found at path %s, trying alternative locations", assetPath)
-
-		// Try common alternative locations
-		alternativePaths := []string{
-			// Custom path for app bundles
-			fmt.Sprintf("bundles/%s-bundle.js", platform),
-			// Default names
-			"bundle.js",
-			"index.js",
-			fmt.Sprintf("%s-bundle.js", platform),
-		}
-
-		// Try extracting filename from the path and looking for it directly
-		parts := strings.Split(assetPath, "/")
-		if len(parts) > 0 {
-			filename := parts[len(parts)-1]
-			alternativePaths = append(alternativePaths, filename)
-		}
-
-		// Try each alternative path
-		for _, altPath := range alternativePaths {
-			log.Printf("Trying alternative path for bundle: %s", altPath)
-			altFile, altErr := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, altPath)
-			if altErr == nil {
-				log.Printf("Found bundle at alternative path: %s", altPath)
-				assetFile = altFile
-				assetPath = altPath // Update the path for URL generation
-				err = nil
-				break
-			}
-		}
-	}
-
-	if err != nil {
-		return types.ManifestAsset{}, err
-	}
-	defer assetFile.Close()
-
-	// Read the file content
-	content, err := io.ReadAll(assetFile)
-	if err != nil {
-		return types.ManifestAsset{}, err
-	}
-
-	assetHash, errHash := crypto.CreateHash(content, "sha256", "base64")
-	if errHash != nil {
-		return types.ManifestAsset{}, errHash
-	}
-	urlEncodedHash := crypto.GetBase64URLEncoding(assetHash)
-	key, errKey := crypto.CreateHash(content, "md5", "hex")
-	if errKey != nil {
-		return types.ManifestAsset{}, errKey
-	}
-
 	keyExtensionSuffix := asset.Ext
 	if isLaunchAsset {
 		keyExtensionSuffix = "bundle"
@@ -498,16 +552,29 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 	if isLaunchAsset {
 		contentType = mime.TypeByExtension(asset.Ext)
 	}
-	finalUrl, errUrl := BuildFinalManifestAssetUrlURL(GetAssetEndpoint(), assetPath, update.RuntimeVersion, platform)
-	if errUrl != nil {
-		return types.ManifestAsset{}, errUrl
+
+	// The index holds the hash of every asset, they are not read to build the manifest
+	entry, err := LookupAsset(update, asset.Path)
+	if err != nil {
+		return types.ManifestAsset{}, err
+	}
+	manifestHash, errHash := ContentAssetManifestHash(entry.SHA256)
+	if errHash != nil {
+		return types.ManifestAsset{}, errHash
+	}
+	assetUrl := BuildContentAssetUrl(entry.SHA256, keyExtensionSuffix)
+	if entry.Store == types.AssetStoreUpdate {
+		assetUrl, err = BuildUpdateAssetUrl(update, entry.Object, platform)
+		if err != nil {
+			return types.ManifestAsset{}, err
+		}
 	}
 	manifestAsset := types.ManifestAsset{
-		Hash:          urlEncodedHash,
-		Key:           key,
+		Hash:          manifestHash,
+		Key:           entry.MD5,
 		FileExtension: keyExtensionSuffix,
 		ContentType:   contentType,
-		Url:           finalUrl,
+		Url:           assetUrl,
 	}
 	cacheValue, err := json.Marshal(manifestAsset)
 	if err != nil {
@@ -521,10 +588,21 @@ func ComposeUpdateManifest(
 	metadata *types.UpdateMetadata,
 	update types.Update,
 	platform string,
+) (types.UpdateManifest, error) {
+	cacheKey := ComputeUpdataManifestCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId, platform)
+	return coalesce(cacheKey, func() (types.UpdateManifest, error) {
+		return composeUpdateManifest(metadata, update, platform, cacheKey)
+	})
+}
+
+func composeUpdateManifest(
+	metadata *types.UpdateMetadata,
+	update types.Update,
+	platform string,
+	cacheKey string,
 ) (types.UpdateManifest, error) {
 	log.Printf("MANIFEST-DEBUG: Creating manifest for update ID: %s, platform: %s", update.UpdateId, platform)
 	cache := cache2.GetCache()
-	cacheKey := ComputeUpdataManifestCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId, platform)
 	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
 		var manifest types.UpdateManifest
 		err := json.Unmarshal([]byte(cachedValue), &manifest)
@@ -626,9 +704,23 @@ func CreateRollbackDirective(update types.Update) (types.RollbackDirective, erro
 	}
 
 	var rollbackDirective types.RollbackDirective
-	err = json.Unmarshal(content, &rollbackDirective)
-	if err != nil {
-		return types.RollbackDirective{}, err
+	if len(strings.TrimSpace(string(content))) > 0 {
+		err = json.Unmarshal(content, &rollbackDirective)
+		if err != nil {
+			return types.RollbackDirective{}, err
+		}
+	}
+
+	// Rollback files placed by hand may be empty, derive the directive from the update
+	if rollbackDirective.Type == "" {
+		rollbackDirective.Type = "rollBackToEmbedded"
+	}
+	if rollbackDirective.Parameters.CommitTime == "" {
+		commitTime, err := UpdateCreatedAt(update)
+		if err != nil {
+			return types.RollbackDirective{}, err
+		}
+		rollbackDirective.Parameters.CommitTime = commitTime
 	}
 
 	return rollbackDirective, nil
@@ -687,7 +779,155 @@ func CreateUpdate(update types.Update) error {
 	}
 
 	reader := strings.NewReader(string(metadataBytes))
-	return resolvedBucket.UploadFileIntoUpdate(update, "metadata.json", reader)
+	if err := resolvedBucket.UploadFileIntoUpdate(update, "metadata.json", reader); err != nil {
+		return err
+	}
+	return WriteUpdateMetadataFile(update, types.UpdateMetadataFile{
+		Platform:   update.Platform,
+		CommitHash: update.CommitHash,
+		CreatedAt:  time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+	})
+}
+
+// UpdateCreatedAt returns the creation time of an update without writing
+// anything: the persisted one when update-metadata.json holds it, otherwise
+// the one derived from the update id or, for other ids, from the upload time
+// of metadata.json. Every replica derives the same time.
+func UpdateCreatedAt(update types.Update) (string, error) {
+	metadataFile, err := ReadUpdateMetadataFile(update)
+	if err != nil && !errors.Is(err, bucket.ErrObjectNotFound) {
+		return "", err
+	}
+	if metadataFile.CreatedAt != "" {
+		return metadataFile.CreatedAt, nil
+	}
+	return deriveUpdateCreatedAt(update)
+}
+
+// EnsureUpdateCreatedAt persists the creation time of an update when
+// update-metadata.json does not hold one yet, keeping the other fields of the
+// file. It is called when an update is marked as uploaded, reads use
+// UpdateCreatedAt.
+func EnsureUpdateCreatedAt(update types.Update) (string, error) {
+	metadataFile, err := ReadUpdateMetadataFile(update)
+	if err != nil && !errors.Is(err, bucket.ErrObjectNotFound) {
+		return "", err
+	}
+	if metadataFile.CreatedAt != "" {
+		return metadataFile.CreatedAt, nil
+	}
+	createdAt, err := deriveUpdateCreatedAt(update)
+	if err != nil {
+		return "", err
+	}
+	metadataFile.CreatedAt = createdAt
+	if err := WriteUpdateMetadataFile(update, metadataFile); err != nil {
+		return "", fmt.Errorf("error persisting creation time of update %s: %w", update.UpdateId, err)
+	}
+	log.Printf("Persisted creation time %s for update %s/%s/%s", createdAt, update.Branch, update.RuntimeVersion, update.UpdateId)
+	return createdAt, nil
+}
+
+func deriveUpdateCreatedAt(update types.Update) (string, error) {
+	if timestamp, err := strconv.ParseInt(update.UpdateId, 10, 64); err == nil {
+		return time.UnixMilli(timestamp).UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	}
+	resolvedBucket := bucket.GetBucket()
+	info, err := resolvedBucket.StatFile(update.Branch, update.RuntimeVersion, update.UpdateId, "metadata.json")
+	if err != nil {
+		return "", fmt.Errorf("error deriving creation time of update %s: %w", update.UpdateId, err)
+	}
+	return info.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"), nil
+}
+
+// GenerateUpdateId returns the id of a new update published by the server,
+// ordered after the existing updates of the runtime version: the next build
+// number when updates use build-NUMBER ids, a millisecond timestamp otherwise.
+func GenerateUpdateId(branch string, runtimeVersion string) (string, error) {
+	updates, err := GetAllUpdatesForRuntimeVersion(branch, runtimeVersion)
+	if err != nil {
+		return "", err
+	}
+	highestBuildNum := -1
+	for _, update := range updates {
+		if !strings.HasPrefix(update.UpdateId, "build-") {
+			continue
+		}
+		if buildNum := extractBuildNumber(update.UpdateId); buildNum > highestBuildNum {
+			highestBuildNum = buildNum
+		}
+	}
+	if highestBuildNum >= 0 {
+		return fmt.Sprintf("build-%d-%s", highestBuildNum+1, uuid.New().String()), nil
+	}
+	return strconv.FormatInt(time.Now().UnixMilli(), 10), nil
+}
+
+// ReadUpdateMetadataFile loads the server-side update-metadata.json of an update.
+func ReadUpdateMetadataFile(update types.Update) (types.UpdateMetadataFile, error) {
+	var metadataFile types.UpdateMetadataFile
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "update-metadata.json")
+	if err != nil {
+		return metadataFile, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&metadataFile); err != nil {
+		return metadataFile, fmt.Errorf("error decoding update metadata: %w", err)
+	}
+	return metadataFile, nil
+}
+
+// readUpdateMetadataFields loads update-metadata.json field by field, so the
+// fields UpdateMetadataFile does not know survive rewrites.
+func readUpdateMetadataFields(update types.Update) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "update-metadata.json")
+	if errors.Is(err, bucket.ErrObjectNotFound) {
+		return fields, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&fields); err != nil {
+		return nil, fmt.Errorf("error decoding update metadata: %w", err)
+	}
+	return fields, nil
+}
+
+// writeUpdateMetadataFields stores fields as the update-metadata.json of an
+// update, with the non-empty fields of metadataFile set over them.
+func writeUpdateMetadataFields(update types.Update, fields map[string]json.RawMessage, metadataFile types.UpdateMetadataFile) error {
+	content, err := json.Marshal(metadataFile)
+	if err != nil {
+		return fmt.Errorf("error marshalling update metadata: %w", err)
+	}
+	var known map[string]json.RawMessage
+	if err := json.Unmarshal(content, &known); err != nil {
+		return fmt.Errorf("error marshalling update metadata: %w", err)
+	}
+	for name, value := range known {
+		fields[name] = value
+	}
+	content, err = json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("error marshalling update metadata: %w", err)
+	}
+	resolvedBucket := bucket.GetBucket()
+	return resolvedBucket.UploadFileIntoUpdate(update, "update-metadata.json", strings.NewReader(string(content)))
+}
+
+// WriteUpdateMetadataFile stores the server-side update-metadata.json of an
+// update. The fields of the existing file that metadataFile leaves empty or
+// does not know are kept.
+func WriteUpdateMetadataFile(update types.Update, metadataFile types.UpdateMetadataFile) error {
+	fields, err := readUpdateMetadataFields(update)
+	if err != nil {
+		return err
+	}
+	return writeUpdateMetadataFields(update, fields, metadataFile)
 }
 
 // DumpSpecificUpdateMetadata dumps the complete metadata for the specific update ID
@@ -0,0 +1,101 @@
+package update
+
+import (
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateCreatedAtDoesNotWrite(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	timestamped := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	named := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "build-1-abc"}
+	for _, update := range []types.Update{timestamped, named} {
+		require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader(`{"version":0}`)))
+	}
+
+	createdAt, err := UpdateCreatedAt(timestamped)
+	require.NoError(t, err)
+	assert.Equal(t, "2023-11-14T22:13:20.000Z", createdAt)
+
+	createdAt, err = UpdateCreatedAt(named)
+	require.NoError(t, err)
+	info, err := resolvedBucket.StatFile(named.Branch, named.RuntimeVersion, named.UpdateId, "metadata.json")
+	require.NoError(t, err)
+	assert.Equal(t, info.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"), createdAt)
+	parsed, err := time.Parse("2006-01-02T15:04:05.000Z", createdAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), parsed, time.Hour)
+
+	for _, update := range []types.Update{timestamped, named} {
+		_, err := ReadUpdateMetadataFile(update)
+		assert.ErrorIs(t, err, bucket.ErrObjectNotFound)
+	}
+}
+
+func TestEnsureUpdateCreatedAtKeepsMetadata(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader(`{"version":0}`)))
+	republishedFrom := &types.UpdateReference{Branch: "staging", RuntimeVersion: "1.0.0", UpdateId: "1600000000000"}
+	require.NoError(t, WriteUpdateMetadataFile(update, types.UpdateMetadataFile{
+		Platform:        "ios",
+		CommitHash:      "abc123",
+		RepublishedFrom: republishedFrom,
+	}))
+
+	createdAt, err := EnsureUpdateCreatedAt(update)
+	require.NoError(t, err)
+	assert.Equal(t, "2023-11-14T22:13:20.000Z", createdAt)
+	metadataFile, err := ReadUpdateMetadataFile(update)
+	require.NoError(t, err)
+	assert.Equal(t, types.UpdateMetadataFile{
+		Platform:        "ios",
+		CommitHash:      "abc123",
+		CreatedAt:       createdAt,
+		RepublishedFrom: republishedFrom,
+	}, metadataFile)
+
+	// A persisted time is never replaced
+	metadataFile.CreatedAt = "2024-01-01T00:00:00.000Z"
+	require.NoError(t, WriteUpdateMetadataFile(update, metadataFile))
+	createdAt, err = EnsureUpdateCreatedAt(update)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01T00:00:00.000Z", createdAt)
+}
+
+func TestEnsureUpdateCreatedAtKeepsUnknownFields(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, "metadata.json", strings.NewReader(`{"version":0}`)))
+	require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, "update-metadata.json", strings.NewReader(`{"platform":"ios","message":"Fix login","gitBranch":{"name":"main"}}`)))
+
+	_, err := EnsureUpdateCreatedAt(update)
+	require.NoError(t, err)
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "update-metadata.json")
+	require.NoError(t, err)
+	content, err := bucket.ConvertReadCloserToBytes(file)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"platform":"ios","message":"Fix login","gitBranch":{"name":"main"},"createdAt":"2023-11-14T22:13:20.000Z"}`, string(content))
+}
+
+func TestEnsureUpdateCreatedAtKeepsUnreadableMetadata(t *testing.T) {
+	resolvedBucket := useLocalBucket(t)
+	update := types.Update{Branch: "main", RuntimeVersion: "1.0.0", UpdateId: "1700000000000"}
+	require.NoError(t, resolvedBucket.UploadFileIntoUpdate(update, "update-metadata.json", strings.NewReader(`{"platform":`)))
+
+	_, err := UpdateCreatedAt(update)
+	assert.Error(t, err)
+	_, err = EnsureUpdateCreatedAt(update)
+	assert.Error(t, err)
+	file, err := resolvedBucket.GetFile(update.Branch, update.RuntimeVersion, update.UpdateId, "update-metadata.json")
+	require.NoError(t, err)
+	content, err := bucket.ConvertReadCloserToBytes(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"platform":`, string(content))
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"expo-open-ota/config"
+	"expo-open-ota/internal/cache"
+	"expo-open-ota/internal/retention"
 	infrastructure "expo-open-ota/internal/router"
 	"expo-open-ota/internal/update"
 	"log"
@@ -14,6 +16,9 @@ func main() {
 	log.Println("Starting server initialization...")
 	log.Println("Loading configuration...")
 	config.LoadConfig()
+	if err := cache.ValidateCacheConfig(); err != nil {
+		log.Fatalf("Invalid cache configuration: %v", err)
+	}
 
 	// Log important environment variables (without exposing secrets)
 	logEnvironmentStatus()
@@ -22,6 +27,11 @@ func main() {
 	log.Println("Initializing router...")
 	router := infrastructure.NewRouter()
 
+	// Drop the cache keys other replicas invalidate
+	cache.StartInvalidationListener()
+
+	retention.StartBackgroundJob()
+
 	// Dump metadata for the specific update
 	go func() {
 		// Wait a bit to make sure everything is initialized
@@ -72,7 +82,7 @@ func logEnvironmentStatus() {
 	log.Printf("BASE_URL: %s", baseURL)
 
 	// Log storage configuration
-	storageMode := config.GetEnv("STORAGE_MODE")
+	storageMode := config.ResolveStorageMode()
 	log.Printf("Storage mode: %s", storageMode)
 
 	// Log keys storage configuration
@@ -84,7 +84,7 @@ func IsMultipartPartWithName(part MultipartPart, name string) bool {
 func ValidateSignatureHeader(signature string, content string) bool {
 	publicCert := keyStore.GetPublicExpoKey()
 	signatureParts := strings.Split(signature, ",")
-	if len(signatureParts) != 2 {
+	if len(signatureParts) < 2 {
 		fmt.Println("Invalid signature format")
 		return false
 	}